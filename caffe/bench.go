@@ -0,0 +1,111 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jvlmdr/go-cv/featset"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// DurationStats summarizes repeated measurements of a duration.
+// All times are in seconds.
+type DurationStats struct {
+	N                   int
+	Median, P90         float64
+	Mean, Std, Min, Max float64
+}
+
+// ComputeDurationStats summarizes a list of durations.
+// Percentiles use the nearest rank.
+func ComputeDurationStats(durs []time.Duration) DurationStats {
+	s := DurationStats{N: len(durs)}
+	if len(durs) == 0 {
+		return s
+	}
+	x := make([]float64, len(durs))
+	var sum, sumSqr float64
+	for i, d := range durs {
+		x[i] = d.Seconds()
+		sum += x[i]
+		sumSqr += x[i] * x[i]
+	}
+	sort.Float64s(x)
+	n := float64(len(x))
+	s.Mean = sum / n
+	s.Std = math.Sqrt(math.Max(0, sumSqr/n-s.Mean*s.Mean))
+	s.Min, s.Max = x[0], x[len(x)-1]
+	s.Median = percentile(x, 0.5)
+	s.P90 = percentile(x, 0.9)
+	return s
+}
+
+// percentile gives the nearest-rank percentile of sorted values.
+func percentile(x []float64, p float64) float64 {
+	i := int(math.Ceil(p*float64(len(x)))) - 1
+	return x[clampInt(i, 0, len(x)-1)]
+}
+
+func (s DurationStats) String() string {
+	return fmt.Sprintf("median %.3g s, p90 %.3g s, std %.3g s (n=%d)", s.Median, s.P90, s.Std, s.N)
+}
+
+// Stage is the part of a native feature transform
+// which computes one layer and the in-place layers that modify its output.
+type Stage struct {
+	Layer string
+	// Func is nil if the stage is the identity.
+	Func featset.Real
+}
+
+// Stages splits the transform from FromProto into preprocessing
+// and one stage for each layer in LayerChain,
+// so that the time of each layer can be measured.
+func Stages(net *NetParameter, output string, mean []float64) (featset.Image, []Stage, error) {
+	chain, err := LayerChain(net, output)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		stages []Stage
+		in     = 3
+	)
+	for _, name := range chain {
+		phi, out, err := layerStage(net, layerByName(net, name), in)
+		if err != nil {
+			return nil, nil, err
+		}
+		stages = append(stages, Stage{Layer: name, Func: phi})
+		in = out
+	}
+	return preprocess(mean), stages, nil
+}
+
+// StageTimes applies preprocessing and then every stage in order
+// and returns the duration of each stage, with preprocessing first.
+func StageTimes(pre featset.Image, stages []Stage, im image.Image) ([]time.Duration, error) {
+	durs := make([]time.Duration, len(stages)+1)
+	start := time.Now()
+	x, err := pre.Apply(im)
+	if err != nil {
+		return nil, err
+	}
+	durs[0] = time.Since(start)
+	for i, s := range stages {
+		if s.Func == nil {
+			continue
+		}
+		start := time.Now()
+		var y *rimg64.Multi
+		y, err = s.Func.Apply(x)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %v", s.Layer, err)
+		}
+		durs[i+1] = time.Since(start)
+		x = y
+	}
+	return durs, nil
+}
@@ -0,0 +1,52 @@
+package caffe
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestComputeDurationStats(t *testing.T) {
+	ms := func(xs ...int) []time.Duration {
+		durs := make([]time.Duration, len(xs))
+		for i, x := range xs {
+			durs[i] = time.Duration(x) * time.Millisecond
+		}
+		return durs
+	}
+	cases := []struct {
+		In   []time.Duration
+		Want DurationStats
+	}{
+		{nil, DurationStats{}},
+		{ms(7), DurationStats{N: 1, Median: 0.007, P90: 0.007, Mean: 0.007, Min: 0.007, Max: 0.007}},
+		// Nearest rank: the median of an even number is the lower middle value.
+		{ms(4, 1, 3, 2), DurationStats{N: 4, Median: 0.002, P90: 0.004, Mean: 0.0025, Std: math.Sqrt(1.25e-6), Min: 0.001, Max: 0.004}},
+		{ms(5, 1, 4, 2, 3), DurationStats{N: 5, Median: 0.003, P90: 0.005, Mean: 0.003, Std: math.Sqrt(2e-6), Min: 0.001, Max: 0.005}},
+		// The 90th percentile of 10 values is the 9th.
+		{ms(10, 9, 8, 7, 6, 5, 4, 3, 2, 1), DurationStats{N: 10, Median: 0.005, P90: 0.009, Mean: 0.0055, Std: math.Sqrt(8.25e-6), Min: 0.001, Max: 0.010}},
+	}
+	const eps = 1e-12
+	for _, c := range cases {
+		got := ComputeDurationStats(c.In)
+		if got.N != c.Want.N {
+			t.Errorf("%v: N: got %d, want %d", c.In, got.N, c.Want.N)
+		}
+		fields := []struct {
+			Name      string
+			Got, Want float64
+		}{
+			{"median", got.Median, c.Want.Median},
+			{"p90", got.P90, c.Want.P90},
+			{"mean", got.Mean, c.Want.Mean},
+			{"std", got.Std, c.Want.Std},
+			{"min", got.Min, c.Want.Min},
+			{"max", got.Max, c.Want.Max},
+		}
+		for _, f := range fields {
+			if math.Abs(f.Got-f.Want) > eps {
+				t.Errorf("%v: %s: got %g, want %g", c.In, f.Name, f.Got, f.Want)
+			}
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package caffe
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+const (
+	cacheExt = ".multi"
+	// Temporary files older than this are left over from a failed write.
+	staleTemp = time.Hour
+)
+
+// Cache stores feature images on disk so that they are not recomputed.
+// Entries are written atomically and the directory may be shared
+// by several processes at once.
+type Cache struct {
+	Dir string
+	// Maximum total size of the entries in bytes.
+	// If zero, the cache is not bounded.
+	// When the size is exceeded, entries are evicted
+	// until it is below nine tenths of the maximum.
+	MaxSize int64
+
+	// Estimate of the total size, which only includes the writes
+	// of this process since the directory was last scanned.
+	mu    sync.Mutex
+	size  int64
+	sized bool
+}
+
+// CacheStats describes the contents of a cache directory.
+type CacheStats struct {
+	Entries int
+	Size    int64
+	Oldest  time.Time
+	Newest  time.Time
+}
+
+// Get loads the feature image stored under key.
+// Returns false if there is no such entry.
+func (c *Cache) Get(key string) (*rimg64.Multi, bool, error) {
+	if err := checkCacheKey(key); err != nil {
+		return nil, false, err
+	}
+	fname := c.entryFile(key)
+	data, err := ioutil.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	msg := new(Multi)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, false, fmt.Errorf("cache entry %s: %v", key, err)
+	}
+	if err := checkMultiProto(msg); err != nil {
+		return nil, false, fmt.Errorf("cache entry %s: %v", key, err)
+	}
+	// Mark entry as recently used.
+	// The entry may have been evicted by another process in the meantime.
+	now := time.Now()
+	if err := os.Chtimes(fname, now, now); err != nil && !os.IsNotExist(err) {
+		return nil, false, err
+	}
+	return multiFromProto(msg), true, nil
+}
+
+// Put stores the feature image under key.
+// If the cache is bounded, old entries are evicted afterwards.
+func (c *Cache) Put(key string, f *rimg64.Multi) error {
+	if err := checkCacheKey(key); err != nil {
+		return err
+	}
+	data, err := proto.Marshal(multiToProto(f))
+	if err != nil {
+		return err
+	}
+	fname := c.entryFile(key)
+	var prev int64
+	if info, err := os.Stat(fname); err == nil {
+		prev = info.Size()
+	}
+	if err := os.MkdirAll(path.Dir(fname), 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file in the same directory and then rename,
+	// so that readers never see a partial entry.
+	tmp, err := ioutil.TempFile(path.Dir(fname), "tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), fname); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if c.MaxSize > 0 {
+		return c.grow(int64(len(data)) - prev)
+	}
+	return nil
+}
+
+// grow adds delta to the estimated size
+// and prunes the cache if it exceeds the maximum.
+// The directory is only scanned on first use and when pruning.
+func (c *Cache) grow(delta int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.sized {
+		stats, err := c.Stats()
+		if err != nil {
+			return err
+		}
+		c.size, c.sized = stats.Size, true
+	} else {
+		c.size += delta
+	}
+	if c.size <= c.MaxSize {
+		return nil
+	}
+	size, _, err := c.prune(c.MaxSize - c.MaxSize/10)
+	if err != nil {
+		return err
+	}
+	c.size = size
+	return nil
+}
+
+// Prune removes the least recently used entries
+// until the total size is at most maxSize bytes.
+// Temporary files left by failed writes are removed too.
+// Returns the number of entries which were removed.
+func (c *Cache) Prune(maxSize int64) (int, error) {
+	_, n, err := c.prune(maxSize)
+	return n, err
+}
+
+// prune returns the total size after pruning
+// and the number of entries removed.
+func (c *Cache) prune(maxSize int64) (int64, int, error) {
+	unlock, err := c.lock()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	entries, temps, err := c.walk()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, t := range temps {
+		if time.Since(t.Info.ModTime()) < staleTemp {
+			// May still be written by another process.
+			continue
+		}
+		if err := os.Remove(t.Path); err != nil && !os.IsNotExist(err) {
+			return 0, 0, err
+		}
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Info.Size()
+	}
+	// Oldest first.
+	sort.Sort(byModTime(entries))
+	var n int
+	for _, e := range entries {
+		if total <= maxSize {
+			break
+		}
+		if err := os.Remove(e.Path); err != nil && !os.IsNotExist(err) {
+			return total, n, err
+		}
+		total -= e.Info.Size()
+		n++
+	}
+	return total, n, nil
+}
+
+// Stats summarizes the current contents of the cache.
+func (c *Cache) Stats() (CacheStats, error) {
+	entries, _, err := c.walk()
+	if err != nil {
+		return CacheStats{}, err
+	}
+	var stats CacheStats
+	for _, e := range entries {
+		stats.Entries++
+		stats.Size += e.Info.Size()
+		t := e.Info.ModTime()
+		if stats.Oldest.IsZero() || t.Before(stats.Oldest) {
+			stats.Oldest = t
+		}
+		if t.After(stats.Newest) {
+			stats.Newest = t
+		}
+	}
+	return stats, nil
+}
+
+// checkCacheKey rejects keys which do not name a file
+// in a subdirectory of the cache.
+func checkCacheKey(key string) error {
+	if len(key) < 2 || strings.ContainsAny(key, "/\\") {
+		return fmt.Errorf("invalid cache key: %q", key)
+	}
+	return nil
+}
+
+// checkMultiProto checks that every element of the feature image
+// is within the message, so that a corrupt entry cannot panic.
+func checkMultiProto(msg *Multi) error {
+	var (
+		width    = int(msg.GetWidth())
+		height   = int(msg.GetHeight())
+		channels = int(msg.GetNumChannels())
+	)
+	if width < 0 || height < 0 || channels < 0 {
+		return fmt.Errorf("negative size: %dx%dx%d", width, height, channels)
+	}
+	if n := width * height * channels; len(msg.Elem) != n {
+		return fmt.Errorf("number of elements is %d, expect %d", len(msg.Elem), n)
+	}
+	if width == 0 || height == 0 || channels == 0 {
+		return nil
+	}
+	var (
+		ei = int(msg.GetXStride())
+		ej = int(msg.GetYStride())
+		ek = int(msg.GetChannelStride())
+	)
+	if ei < 0 || ej < 0 || ek < 0 {
+		return fmt.Errorf("negative stride: %d, %d, %d", ei, ej, ek)
+	}
+	if last := (width-1)*ei + (height-1)*ej + (channels-1)*ek; last >= len(msg.Elem) {
+		return fmt.Errorf("strides %d, %d, %d exceed %d elements", ei, ej, ek, len(msg.Elem))
+	}
+	return nil
+}
+
+// Returns "[Dir]/[key[:2]]/[key].multi".
+func (c *Cache) entryFile(key string) string {
+	return path.Join(c.Dir, key[:2], key+cacheExt)
+}
+
+type cacheFile struct {
+	Path string
+	Info os.FileInfo
+}
+
+// walk lists the entries and the temporary files in the cache.
+func (c *Cache) walk() (entries, temps []cacheFile, err error) {
+	err = filepath.Walk(c.Dir, func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			// Removed by another process.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		switch {
+		case strings.HasSuffix(info.Name(), cacheExt):
+			entries = append(entries, cacheFile{p, info})
+		case strings.HasPrefix(info.Name(), "tmp-"):
+			temps = append(temps, cacheFile{p, info})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, temps, nil
+}
+
+// lock obtains an exclusive lock on the cache directory
+// which is shared with other processes.
+func (c *Cache) lock() (unlock func(), err error) {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path.Join(c.Dir, "lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	unlock = func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}
+	return unlock, nil
+}
+
+type byModTime []cacheFile
+
+func (s byModTime) Len() int           { return len(s) }
+func (s byModTime) Less(i, j int) bool { return s[i].Info.ModTime().Before(s[j].Info.ModTime()) }
+func (s byModTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// featureKeyPrefix hashes everything except the image
+// which determines the output of a feature transform.
+func featureKeyPrefix(model *NetParameter, layer, weightsFile, meanFile string) ([]byte, error) {
+	subset, err := proto.Marshal(SubsetForOutput(model, layer))
+	if err != nil {
+		return nil, err
+	}
+	weights, err := fileDigest(weightsFile)
+	if err != nil {
+		return nil, err
+	}
+	mean, err := fileDigest(meanFile)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	writeField(h, subset)
+	writeField(h, weights)
+	writeField(h, mean)
+	writeField(h, []byte(layer))
+	return h.Sum(nil), nil
+}
+
+// featureKey combines the prefix with a hash of the image pixels.
+func featureKey(prefix []byte, im image.Image) string {
+	h := sha256.New()
+	writeField(h, prefix)
+	hashImage(h, im)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeField writes a length-prefixed field so that
+// the concatenation of fields is unambiguous.
+func writeField(h hash.Hash, b []byte) {
+	binary.Write(h, binary.LittleEndian, uint64(len(b)))
+	h.Write(b)
+}
+
+func hashImage(h hash.Hash, im image.Image) {
+	r := im.Bounds()
+	binary.Write(h, binary.LittleEndian, []int64{int64(r.Dx()), int64(r.Dy())})
+	buf := make([]uint16, 0, 4*r.Dx())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		buf = buf[:0]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cr, cg, cb, ca := im.At(x, y).RGBA()
+			buf = append(buf, uint16(cr), uint16(cg), uint16(cb), uint16(ca))
+		}
+		binary.Write(h, binary.LittleEndian, buf)
+	}
+}
+
+type digestKey struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+var (
+	digestMu    sync.Mutex
+	digestCache = make(map[digestKey][]byte)
+)
+
+// fileDigest returns the SHA-256 digest of a file.
+// The result is remembered until the size or modification time changes.
+func fileDigest(fname string) ([]byte, error) {
+	info, err := os.Stat(fname)
+	if err != nil {
+		return nil, err
+	}
+	key := digestKey{fname, info.Size(), info.ModTime()}
+	digestMu.Lock()
+	sum, ok := digestCache[key]
+	digestMu.Unlock()
+	if ok {
+		return sum, nil
+	}
+	err = load(fname, func(r io.ReadSeeker) error {
+		h := sha256.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		sum = h.Sum(nil)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	digestMu.Lock()
+	digestCache[key] = sum
+	digestMu.Unlock()
+	return sum, nil
+}
@@ -0,0 +1,289 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+func cacheKey(i int) string { return fmt.Sprintf("%064x", i) }
+
+func randomMulti(width, height, channels int) *rimg64.Multi {
+	f := rimg64.NewMulti(width, height, channels)
+	for i := range f.Elems {
+		f.Elems[i] = float64(i%7) - 3
+	}
+	return f
+}
+
+func equalMulti(a, b *rimg64.Multi) bool {
+	if a.Width != b.Width || a.Height != b.Height || a.Channels != b.Channels {
+		return false
+	}
+	for i := range a.Elems {
+		if a.Elems[i] != b.Elems[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCache_putGet(t *testing.T) {
+	cache := &Cache{Dir: t.TempDir()}
+	key := cacheKey(1)
+	if _, ok, err := cache.Get(key); err != nil || ok {
+		t.Fatalf("empty cache: got ok %v, err %v", ok, err)
+	}
+	want := randomMulti(4, 3, 2)
+	if err := cache.Put(key, want); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := cache.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("entry not found")
+	}
+	if !equalMulti(want, got) {
+		t.Error("entry is different")
+	}
+}
+
+// Entries which do not describe a valid feature image give an error.
+func TestCache_corrupt(t *testing.T) {
+	cache := &Cache{Dir: t.TempDir()}
+	f := randomMulti(4, 3, 2)
+	cases := map[string]func(*Multi){
+		"few elements":   func(m *Multi) { m.Elem = m.Elem[:5] },
+		"large stride":   func(m *Multi) { m.XStride = proto.Int(100) },
+		"negative size":  func(m *Multi) { m.Width = proto.Int(-4) },
+		"negative index": func(m *Multi) { m.ChannelStride = proto.Int(-1) },
+	}
+	var i int
+	for name, modify := range cases {
+		i++
+		msg := multiToProto(f)
+		modify(msg)
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := cacheKey(i)
+		fname := cache.entryFile(key)
+		if err := os.MkdirAll(path.Dir(fname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := cache.Get(key); err == nil {
+			t.Errorf("%s: expect error", name)
+		}
+	}
+
+	for _, key := range []string{"", "a", "../" + cacheKey(1)} {
+		if err := cache.Put(key, f); err == nil {
+			t.Errorf("put %q: expect error", key)
+		}
+		if _, _, err := cache.Get(key); err == nil {
+			t.Errorf("get %q: expect error", key)
+		}
+	}
+}
+
+// The least recently used entry is evicted when the size is exceeded.
+func TestCache_maxSize(t *testing.T) {
+	dir := t.TempDir()
+	f := randomMulti(4, 4, 4)
+	data, err := proto.Marshal(multiToProto(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := int64(len(data))
+	cache := &Cache{Dir: dir, MaxSize: 3*n + n/2}
+
+	past := time.Now().Add(-time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := cache.Put(cacheKey(i), f); err != nil {
+			t.Fatal(err)
+		}
+		mod := past.Add(time.Duration(i) * time.Second)
+		if err := os.Chtimes(cache.entryFile(cacheKey(i)), mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Use the oldest entry.
+	if _, ok, err := cache.Get(cacheKey(0)); err != nil || !ok {
+		t.Fatalf("get entry 0: got ok %v, err %v", ok, err)
+	}
+	if err := cache.Put(cacheKey(3), f); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{true, false, true, true} {
+		if _, ok, err := cache.Get(cacheKey(i)); err != nil {
+			t.Fatal(err)
+		} else if ok != want {
+			t.Errorf("entry %d: got present %v, want %v", i, ok, want)
+		}
+	}
+	stats, err := cache.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 3 || stats.Size != 3*n {
+		t.Errorf("got %d entries of %d bytes, want 3 of %d", stats.Entries, stats.Size, 3*n)
+	}
+}
+
+func TestCache_pruneTemp(t *testing.T) {
+	dir := t.TempDir()
+	cache := &Cache{Dir: dir}
+	if err := cache.Put(cacheKey(1), randomMulti(2, 2, 1)); err != nil {
+		t.Fatal(err)
+	}
+	sub := path.Dir(cache.entryFile(cacheKey(1)))
+	stale, fresh := path.Join(sub, "tmp-1"), path.Join(sub, "tmp-2")
+	for _, fname := range []string{stale, fresh} {
+		if err := ioutil.WriteFile(fname, []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * staleTemp)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Prune(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale temporary file not removed: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("recent temporary file removed: %v", err)
+	}
+	if _, ok, err := cache.Get(cacheKey(1)); err != nil || !ok {
+		t.Errorf("entry removed: got ok %v, err %v", ok, err)
+	}
+}
+
+// Several caches share a directory as if they were separate processes.
+// Readers must never see a partial entry.
+func TestCache_concurrent(t *testing.T) {
+	dir := t.TempDir()
+	const (
+		workers = 4
+		keys    = 8
+		rounds  = 20
+	)
+	want := randomMulti(8, 8, 3)
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			cache := &Cache{Dir: dir, MaxSize: 4000}
+			for r := 0; r < rounds; r++ {
+				key := cacheKey((w + r) % keys)
+				if err := cache.Put(key, want); err != nil {
+					errs <- err
+					return
+				}
+				got, ok, err := cache.Get(cacheKey((w + 3*r) % keys))
+				if err != nil {
+					errs <- err
+					return
+				}
+				if ok && !equalMulti(want, got) {
+					errs <- fmt.Errorf("worker %d: entry is different", w)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	cache := &Cache{Dir: dir}
+	if _, err := cache.Prune(4000); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := cache.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Size > 4000 {
+		t.Errorf("size after prune: got %d, want at most 4000", stats.Size)
+	}
+}
+
+const cacheTestNet = `
+name: "CacheNet"
+input: "data"
+input_dim: 1 input_dim: 3 input_dim: 8 input_dim: 8
+layers { name: "conv1" type: CONVOLUTION bottom: "data" top: "conv1"
+  convolution_param { num_output: 4 kernel_size: 3 } }
+layers { name: "pool1" type: POOLING bottom: "conv1" top: "pool1"
+  pooling_param { pool: MAX kernel_size: 2 stride: 2 } }
+`
+
+func TestFeatureKey(t *testing.T) {
+	net := new(NetParameter)
+	if err := proto.UnmarshalText(cacheTestNet, net); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	weights, mean := path.Join(dir, "weights"), path.Join(dir, "mean")
+	otherMean := path.Join(dir, "other-mean")
+	for fname, data := range map[string]string{weights: "weights", mean: "mean", otherMean: "other mean"} {
+		if err := ioutil.WriteFile(fname, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prefix := func(layer, mean string) []byte {
+		p, err := featureKeyPrefix(net, layer, weights, mean)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	im := randomImage(image.Pt(5, 4)).(*image.RGBA)
+	key := featureKey(prefix("conv1", mean), im)
+	if got := featureKey(prefix("conv1", mean), im); got != key {
+		t.Error("key is not deterministic")
+	}
+	// Only the pixels matter, not the position of the image.
+	moved := *im
+	moved.Rect = im.Rect.Add(image.Pt(10, 20))
+	if got := featureKey(prefix("conv1", mean), &moved); got != key {
+		t.Error("key depends on image bounds")
+	}
+
+	changed := image.NewRGBA(im.Rect)
+	copy(changed.Pix, im.Pix)
+	changed.Pix[0]++
+	others := map[string]string{
+		"layer":  featureKey(prefix("pool1", mean), im),
+		"mean":   featureKey(prefix("conv1", otherMean), im),
+		"pixels": featureKey(prefix("conv1", mean), changed),
+		"size":   featureKey(prefix("conv1", mean), im.SubImage(image.Rect(0, 0, 5, 3))),
+	}
+	for name, other := range others {
+		if other == key {
+			t.Errorf("key does not depend on %s", name)
+		}
+	}
+}
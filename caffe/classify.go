@@ -0,0 +1,80 @@
+package caffe
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// Prediction is a class and its probability.
+type Prediction struct {
+	Index int
+	Label string
+	Prob  float64
+}
+
+// Classify computes the probability of each class for an image,
+// combining the outputs of its crops.
+// The output for each crop must be a single position.
+func Classify(mapAll func([]image.Image) ([]*rimg64.Multi, error), im image.Image, t TestTransform) ([]float64, error) {
+	f, err := ApplyTransformed(mapAll, im, t)
+	if err != nil {
+		return nil, err
+	}
+	if f.Width != 1 || f.Height != 1 {
+		return nil, fmt.Errorf("output has size %v, expect 1x1", f.Size())
+	}
+	probs := make([]float64, f.Channels)
+	for k := range probs {
+		probs[k] = f.At(0, 0, k)
+	}
+	return probs, nil
+}
+
+// TopK returns the k most probable classes in order.
+// Labels may be nil.
+// If k is not positive, no classes are returned.
+func TopK(probs []float64, labels []string, k int) []Prediction {
+	if k < 0 {
+		k = 0
+	}
+	preds := make([]Prediction, len(probs))
+	for i, p := range probs {
+		preds[i] = Prediction{Index: i, Prob: p}
+		if i < len(labels) {
+			preds[i].Label = labels[i]
+		}
+	}
+	sort.Stable(byProbDesc(preds))
+	if k < len(preds) {
+		preds = preds[:k]
+	}
+	return preds
+}
+
+type byProbDesc []Prediction
+
+func (s byProbDesc) Len() int           { return len(s) }
+func (s byProbDesc) Less(i, j int) bool { return s[i].Prob > s[j].Prob }
+func (s byProbDesc) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// LoadLabels reads one class label per line, as in synset_words.txt.
+func LoadLabels(fname string) ([]string, error) {
+	var labels []string
+	err := load(fname, func(r io.ReadSeeker) error {
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			labels = append(labels, strings.TrimSpace(s.Text()))
+		}
+		return s.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
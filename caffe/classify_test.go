@@ -0,0 +1,136 @@
+package caffe
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-cv/featset"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+const classifyTestNet = `
+name: "ClassifyNet"
+input: "data"
+input_dim: 1 input_dim: 3 input_dim: 1 input_dim: 2
+layers { name: "flat" type: FLATTEN bottom: "data" top: "flat" }
+layers { name: "fc" type: INNER_PRODUCT bottom: "flat" top: "fc"
+  inner_product_param { num_output: 2 }
+  blobs { num: 1 channels: 1 height: 2 width: 6
+    data: 1 data: 0 data: 0 data: 0 data: 0 data: -1
+    data: 0 data: 1 data: 1 data: 0 data: 0 data: 0 }
+  blobs { num: 1 channels: 1 height: 1 width: 2 data: 0.5 data: -1 } }
+layers { name: "prob" type: SOFTMAX bottom: "fc" top: "prob" }
+`
+
+// The inner product takes the input in Caffe order: channel, row, column.
+func TestInnerProductSoftmax(t *testing.T) {
+	net := new(NetParameter)
+	if err := proto.UnmarshalText(classifyTestNet, net); err != nil {
+		t.Fatal(err)
+	}
+	x := rimg64.NewMulti(2, 1, 3)
+	for k := 0; k < 3; k++ {
+		for u := 0; u < 2; u++ {
+			x.Set(u, 0, k, float64(2*k+u+1))
+		}
+	}
+	// fc = (1 - 6 + 0.5, 2 + 3 - 1).
+	fc := []float64{-4.5, 4}
+	z := math.Exp(fc[0]) + math.Exp(fc[1])
+	cases := map[string][]float64{
+		"fc":   fc,
+		"prob": {math.Exp(fc[0]) / z, math.Exp(fc[1]) / z},
+	}
+	for output, want := range cases {
+		phi, _, err := fromProto(net, output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		y, err := phi.Apply(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if y.Width != 1 || y.Height != 1 || y.Channels != len(want) {
+			t.Fatalf("%s: got size %dx%dx%d, want 1x1x%d", output, y.Width, y.Height, y.Channels, len(want))
+		}
+		for k, wk := range want {
+			if d := math.Abs(y.At(0, 0, k) - wk); d > 1e-9 {
+				t.Errorf("%s channel %d: got %g, want %g", output, k, y.At(0, 0, k), wk)
+			}
+		}
+	}
+}
+
+// Softmax normalizes each position separately and does not overflow.
+func TestSoftmax(t *testing.T) {
+	x := rimg64.NewMulti(2, 1, 3)
+	in := [][]float64{{0, 0, 0}, {1000, 1001, 999}}
+	for u, xu := range in {
+		for k, xk := range xu {
+			x.Set(u, 0, k, xk)
+		}
+	}
+	y, err := new(softmax).Apply(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := math.E
+	z := 1 + e + 1/e
+	want := [][]float64{{1.0 / 3, 1.0 / 3, 1.0 / 3}, {1 / z, e / z, 1 / e / z}}
+	for u, wu := range want {
+		for k, wk := range wu {
+			if got := y.At(u, 0, k); math.Abs(got-wk) > 1e-12 {
+				t.Errorf("position %d channel %d: got %g, want %g", u, k, got, wk)
+			}
+		}
+	}
+}
+
+// Softmax can be loaded back from JSON.
+func TestSoftmax_json(t *testing.T) {
+	data, err := json.Marshal(new(softmax).Marshaler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m featset.RealMarshaler
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	x := rimg64.NewMulti(1, 1, 2)
+	x.Set(0, 0, 1, 1)
+	want, err := new(softmax).Apply(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Spec.Apply(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got.Elems, want.Elems)
+	}
+}
+
+func TestTopK(t *testing.T) {
+	probs := []float64{0.1, 0.5, 0.2, 0.2}
+	labels := []string{"a", "b", "c"}
+	cases := []struct {
+		K    int
+		Want []Prediction
+	}{
+		{2, []Prediction{{1, "b", 0.5}, {2, "c", 0.2}}},
+		// Ties keep their order and labels may be missing.
+		{3, []Prediction{{1, "b", 0.5}, {2, "c", 0.2}, {3, "", 0.2}}},
+		{10, []Prediction{{1, "b", 0.5}, {2, "c", 0.2}, {3, "", 0.2}, {0, "a", 0.1}}},
+		{0, []Prediction{}},
+		{-1, []Prediction{}},
+	}
+	for _, c := range cases {
+		if got := TopK(probs, labels, c.K); !reflect.DeepEqual(got, c.Want) {
+			t.Errorf("k %d: got %v, want %v", c.K, got, c.Want)
+		}
+	}
+}
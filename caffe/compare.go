@@ -0,0 +1,107 @@
+package caffe
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// Divergence summarizes the difference between a feature map
+// and a reference.
+type Divergence struct {
+	// Size of each feature map as width, height and channels.
+	WantSize, GotSize [3]int
+	MaxAbs, MaxRel    float64
+	// Position of the element with the largest absolute error
+	// as x, y and channel, and its values.
+	Worst     [3]int
+	Want, Got float64
+	// Number of elements which exceed both tolerances,
+	// including those where either value is NaN.
+	NumDiff int
+	NaN     int
+}
+
+// Compare measures the difference between two feature maps.
+// Relative error is measured with respect to the larger magnitude
+// of the two values, so that it is finite.
+// An element which exceeds both epsAbs and epsRel is counted as different.
+// If the sizes differ, the errors are not computed.
+func Compare(want, got *rimg64.Multi, epsAbs, epsRel float64) Divergence {
+	d := Divergence{
+		WantSize: [3]int{want.Width, want.Height, want.Channels},
+		GotSize:  [3]int{got.Width, got.Height, got.Channels},
+	}
+	if d.WantSize != d.GotSize {
+		d.NumDiff = want.Width * want.Height * want.Channels
+		return d
+	}
+	first := true
+	for i := 0; i < want.Width; i++ {
+		for j := 0; j < want.Height; j++ {
+			for k := 0; k < want.Channels; k++ {
+				x, y := want.At(i, j, k), got.At(i, j, k)
+				abs := math.Abs(x - y)
+				if math.IsNaN(abs) {
+					d.NaN++
+					d.NumDiff++
+					continue
+				}
+				rel := relErr(abs, x, y)
+				if first || abs > d.MaxAbs {
+					first = false
+					d.MaxAbs = abs
+					d.Worst = [3]int{i, j, k}
+					d.Want, d.Got = x, y
+				}
+				d.MaxRel = math.Max(d.MaxRel, rel)
+				if abs > epsAbs && rel > epsRel {
+					d.NumDiff++
+				}
+			}
+		}
+	}
+	return d
+}
+
+func relErr(abs, x, y float64) float64 {
+	if abs == 0 {
+		return 0
+	}
+	return abs / math.Max(math.Abs(x), math.Abs(y))
+}
+
+// Diverged reports whether any element is different
+// or the sizes do not match.
+func (d Divergence) Diverged() bool {
+	return d.NumDiff > 0 || d.WantSize != d.GotSize
+}
+
+func (d Divergence) String() string {
+	if d.WantSize != d.GotSize {
+		return fmt.Sprintf("size: want %v, got %v", d.WantSize, d.GotSize)
+	}
+	return fmt.Sprintf("max abs %.3g, max rel %.3g, worst at %v: want %g, got %g",
+		d.MaxAbs, d.MaxRel, d.Worst, d.Want, d.Got)
+}
+
+// LayerChain returns the layers which lead to the output in order,
+// excluding in-place layers,
+// whose effect is included in the output of the layer they modify.
+// Every layer must have one input.
+func LayerChain(net *NetParameter, output string) ([]string, error) {
+	var chain []string
+	for name := output; !isInput(net, name); {
+		layer := layerByName(net, name)
+		if layer == nil {
+			return nil, fmt.Errorf("could not find layer: %s", name)
+		}
+		if err := errIfNotOneInput(layer); err != nil {
+			return nil, fmt.Errorf("layer %s: %v", name, err)
+		}
+		chain = append([]string{name}, chain...)
+		name = layer.Bottom[0]
+	}
+	return chain, nil
+}
@@ -0,0 +1,63 @@
+package caffe
+
+// numParams counts the parameters of a layer.
+// If the layer has blobs, their elements are counted.
+// Otherwise the number is computed from the shape of the input.
+func numParams(layer *LayerParameter, in Shape) int {
+	if len(layer.Blobs) > 0 {
+		var n int
+		for _, blob := range layer.Blobs {
+			n += len(blob.Data)
+		}
+		return n
+	}
+	switch layer.GetType() {
+	case LayerParameter_CONVOLUTION:
+		param := layer.GetConvolutionParam()
+		var (
+			out    = int(param.GetNumOutput())
+			groups = int(param.GetGroup())
+			k      = param.Kernel()
+		)
+		if groups < 1 {
+			groups = 1
+		}
+		n := out * (in.Channels / groups) * k.X * k.Y
+		if param.GetBiasTerm() {
+			n += out
+		}
+		return n
+	case LayerParameter_INNER_PRODUCT:
+		param := layer.GetInnerProductParam()
+		out := int(param.GetNumOutput())
+		n := out * in.NumElems()
+		if param.GetBiasTerm() {
+			n += out
+		}
+		return n
+	default:
+		return 0
+	}
+}
+
+// numMACs counts the multiply-adds which a layer performs for one image.
+// Element-wise layers and pooling are not counted.
+func numMACs(layer *LayerParameter, in, out Shape) int64 {
+	switch layer.GetType() {
+	case LayerParameter_CONVOLUTION:
+		param := layer.GetConvolutionParam()
+		groups := int64(param.GetGroup())
+		if groups < 1 {
+			groups = 1
+		}
+		k := param.Kernel()
+		return int64(out.NumElems()) * (int64(in.Channels) / groups) * int64(k.X*k.Y)
+	case LayerParameter_INNER_PRODUCT:
+		return int64(out.Channels) * int64(in.NumElems())
+	case LayerParameter_LRN:
+		// Sum of squares over adjacent channels.
+		return int64(out.NumElems()) * int64(layer.GetLrnParam().GetLocalSize())
+	default:
+		return 0
+	}
+}
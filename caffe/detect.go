@@ -0,0 +1,184 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+	"sort"
+
+	"github.com/jvlmdr/go-cv/convfeat"
+	"github.com/jvlmdr/go-cv/featset"
+	"github.com/jvlmdr/go-cv/rimg64"
+	"github.com/jvlmdr/go-cv/slide"
+)
+
+// Detector scores every window of a feature pyramid with a linear template.
+// It can be saved as JSON since the feature is serialized through featset.
+type Detector struct {
+	Feature *featset.ImageMarshaler
+	// Receptive field of the feature in pixels.
+	Field image.Point
+	// Template whose size is measured in features.
+	Template *rimg64.Multi
+	Bias     float64
+	Pyramid  PyramidOptions
+	// Windows which score below this are discarded.
+	Threshold float64
+	// Windows which overlap a higher-scoring window by more than this
+	// (intersection over union) are suppressed.
+	// If zero, all windows above threshold are kept.
+	Overlap float64
+}
+
+// NewDetector creates a detector for a Caffe feature.
+func NewDetector(phi *Feature, tmpl *rimg64.Multi, bias float64) (*Detector, error) {
+	_, field, err := layerGeometry(phi.Model, phi.Layer)
+	if err != nil {
+		return nil, err
+	}
+	det := &Detector{
+		Feature:  phi.Marshaler(),
+		Field:    field,
+		Template: tmpl,
+		Bias:     bias,
+		Pyramid:  PyramidOptions{Step: 0.8},
+		Overlap:  0.3,
+	}
+	return det, nil
+}
+
+// Detection is a window in the original image,
+// relative to the minimum of the image bounds.
+type Detection struct {
+	Rect  image.Rectangle
+	Score float64
+	// Level of the pyramid and position in its feature map.
+	Level int
+	Pos   image.Point
+}
+
+// Detect returns the windows which score above threshold
+// after non-maximum suppression, in order of decreasing score.
+func (det *Detector) Detect(im image.Image) ([]Detection, error) {
+	phi := det.Feature.Spec
+	if det.Template == nil {
+		return nil, fmt.Errorf("no template")
+	}
+	size := image.Pt(det.Template.Width, det.Template.Height)
+	// Levels must fit the template.
+	opts := det.Pyramid
+	minSize := size.Sub(image.Pt(1, 1)).Mul(phi.Rate()).Add(det.Field)
+	if opts.MinSize.X < minSize.X {
+		opts.MinSize.X = minSize.X
+	}
+	if opts.MinSize.Y < minSize.Y {
+		opts.MinSize.Y = minSize.Y
+	}
+
+	var (
+		levels []*Level
+		err    error
+	)
+	if f, ok := phi.(*Feature); ok {
+		// Compute all levels in one batch.
+		levels, err = f.Pyramid(im, opts)
+	} else {
+		levels, err = pyramid(ApplyEach(phi), phi.Rate(), det.Field, im, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bank := &slide.MultiBank{size.X, size.Y, det.Template.Channels, []*rimg64.Multi{det.Template}}
+	conv := &convfeat.ConvMulti{Stride: 1, Filters: bank}
+	var (
+		dets   []Detection
+		bounds = image.Rectangle{Max: im.Bounds().Size()}
+	)
+	for i, level := range levels {
+		if level.Feat.Channels != det.Template.Channels {
+			return nil, fmt.Errorf("channels: template has %d, feature has %d", det.Template.Channels, level.Feat.Channels)
+		}
+		if level.Feat.Width < size.X || level.Feat.Height < size.Y {
+			continue
+		}
+		resp, err := conv.Apply(level.Feat)
+		if err != nil {
+			return nil, err
+		}
+		for u := 0; u < resp.Width; u++ {
+			for v := 0; v < resp.Height; v++ {
+				score := resp.At(u, v, 0) + det.Bias
+				if score < det.Threshold {
+					continue
+				}
+				pos := image.Pt(u, v)
+				t := level.Transform
+				rect := t.Rect(pos).Union(t.Rect(pos.Add(size).Sub(image.Pt(1, 1))))
+				rect = rect.Intersect(bounds)
+				dets = append(dets, Detection{Rect: rect, Score: score, Level: i, Pos: pos})
+			}
+		}
+	}
+	sort.Sort(byScoreDesc(dets))
+	if det.Overlap > 0 {
+		dets = Suppress(dets, det.Overlap)
+	}
+	return dets, nil
+}
+
+// ApplyEach returns a function which computes the feature of each image in turn.
+func ApplyEach(phi featset.Image) func([]image.Image) ([]*rimg64.Multi, error) {
+	return func(ims []image.Image) ([]*rimg64.Multi, error) {
+		feats := make([]*rimg64.Multi, len(ims))
+		for i, im := range ims {
+			f, err := phi.Apply(im)
+			if err != nil {
+				return nil, err
+			}
+			feats[i] = f
+		}
+		return feats, nil
+	}
+}
+
+// Suppress performs greedy non-maximum suppression.
+// Detections must be in order of decreasing score.
+// A detection is discarded if its intersection over union
+// with a detection which was kept is more than overlap.
+func Suppress(dets []Detection, overlap float64) []Detection {
+	var keep []Detection
+	for _, d := range dets {
+		suppressed := false
+		for _, k := range keep {
+			if IoU(d.Rect, k.Rect) > overlap {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			keep = append(keep, d)
+		}
+	}
+	return keep
+}
+
+// IoU returns the area of the intersection of two rectangles
+// divided by the area of their union.
+func IoU(a, b image.Rectangle) float64 {
+	inter := area(a.Intersect(b))
+	union := area(a) + area(b) - inter
+	if union == 0 {
+		return 0
+	}
+	return float64(inter) / float64(union)
+}
+
+func area(r image.Rectangle) int {
+	return r.Dx() * r.Dy()
+}
+
+type byScoreDesc []Detection
+
+func (s byScoreDesc) Len() int           { return len(s) }
+func (s byScoreDesc) Less(i, j int) bool { return s[i].Score > s[j].Score }
+func (s byScoreDesc) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
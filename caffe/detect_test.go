@@ -0,0 +1,146 @@
+package caffe
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-cv/featset"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// The feature is the blue channel of the image.
+const detectTestNet = `
+name: "DetectNet"
+input: "data"
+input_dim: 1 input_dim: 3 input_dim: 30 input_dim: 40
+layers { name: "blue" type: CONVOLUTION bottom: "data" top: "blue"
+  convolution_param { num_output: 1 kernel_size: 1 }
+  blobs { num: 1 channels: 3 height: 1 width: 1 data: 1 data: 0 data: 0 }
+  blobs { num: 1 channels: 1 height: 1 width: 1 data: 0 } }
+`
+
+func TestIoU(t *testing.T) {
+	cases := []struct {
+		A, B image.Rectangle
+		Want float64
+	}{
+		{image.Rect(0, 0, 4, 4), image.Rect(0, 0, 4, 4), 1},
+		{image.Rect(0, 0, 4, 4), image.Rect(2, 0, 6, 4), 8.0 / 24},
+		{image.Rect(0, 0, 4, 4), image.Rect(1, 1, 3, 3), 4.0 / 16},
+		{image.Rect(0, 0, 4, 4), image.Rect(4, 0, 8, 4), 0},
+		{image.Rect(0, 0, 0, 0), image.Rect(0, 0, 0, 0), 0},
+	}
+	for _, c := range cases {
+		if got := IoU(c.A, c.B); got != c.Want {
+			t.Errorf("%v, %v: got %g, want %g", c.A, c.B, got, c.Want)
+		}
+		if got := IoU(c.B, c.A); got != c.Want {
+			t.Errorf("%v, %v: got %g, want %g", c.B, c.A, got, c.Want)
+		}
+	}
+}
+
+func TestSuppress(t *testing.T) {
+	dets := []Detection{
+		{Rect: image.Rect(0, 0, 4, 4), Score: 3},
+		// Overlaps the first by 1/3.
+		{Rect: image.Rect(2, 0, 6, 4), Score: 2},
+		// Overlaps the second but not the first.
+		{Rect: image.Rect(4, 0, 8, 4), Score: 1},
+	}
+	cases := []struct {
+		Overlap float64
+		Want    []float64
+	}{
+		{0.5, []float64{3, 2, 1}},
+		// The third is kept since the second was suppressed.
+		{0.3, []float64{3, 1}},
+		// Adjacent windows do not overlap.
+		{0, []float64{3, 1}},
+	}
+	for _, c := range cases {
+		var got []float64
+		for _, d := range Suppress(dets, c.Overlap) {
+			got = append(got, d.Score)
+		}
+		if !reflect.DeepEqual(got, c.Want) {
+			t.Errorf("overlap %g: got scores %v, want %v", c.Overlap, got, c.Want)
+		}
+	}
+}
+
+// A template which matches a planted block in the image
+// gives back the block as the top detection.
+func TestDetector_Detect(t *testing.T) {
+	net := new(NetParameter)
+	if err := proto.UnmarshalText(detectTestNet, net); err != nil {
+		t.Fatal(err)
+	}
+	phi, err := FromProto(net, "blue", []float64{0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Blue block of 4x3 pixels in a black image.
+	im := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	draw.Draw(im, im.Bounds(), image.NewUniform(color.Black), image.ZP, draw.Src)
+	block := image.Rect(10, 12, 14, 15)
+	draw.Draw(im, block, image.NewUniform(color.RGBA{0, 0, 255, 255}), image.ZP, draw.Src)
+
+	tmpl := rimg64.NewMulti(4, 3, 1)
+	for i := range tmpl.Elems {
+		tmpl.Elems[i] = 1
+	}
+	// The block scores 3*255+1 and a shift of one column scores 1.
+	det := &Detector{
+		Feature:  phi.Marshaler(),
+		Field:    image.Pt(1, 1),
+		Template: tmpl,
+		Bias:     -9*255 + 1,
+		Pyramid:  PyramidOptions{Step: 0.5},
+	}
+	dets, err := det.Detect(im)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dets) != 3 {
+		t.Fatalf("without suppression: got %d detections, want 3: %v", len(dets), dets)
+	}
+	want := Detection{Rect: block, Score: 3*255 + 1, Level: 0, Pos: block.Min}
+	if !reflect.DeepEqual(dets[0], want) {
+		t.Errorf("got %+v, want %+v", dets[0], want)
+	}
+
+	det.Overlap = 0.3
+	dets, err = det.Detect(im)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dets) != 1 || !reflect.DeepEqual(dets[0], want) {
+		t.Errorf("with suppression: got %+v, want %+v", dets, want)
+	}
+
+	// The detector survives a round trip through JSON.
+	data, err := json.Marshal(det)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := new(Detector)
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.Feature.Spec.(featset.Image); !ok {
+		t.Fatalf("loaded feature: got %T", loaded.Feature.Spec)
+	}
+	again, err := loaded.Detect(im)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, dets) {
+		t.Errorf("after JSON: got %+v, want %+v", again, dets)
+	}
+}
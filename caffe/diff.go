@@ -0,0 +1,338 @@
+package caffe
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// NetDiff describes the differences between two networks.
+// Layers are matched by name.
+// A removed layer and an added layer are considered a rename
+// if they have the same fields and blob shapes.
+type NetDiff struct {
+	// Changes to fields of the network other than its layers.
+	Fields  []FieldChange `json:"fields,omitempty"`
+	Added   []string      `json:"added,omitempty"`
+	Removed []string      `json:"removed,omitempty"`
+	Renamed []LayerRename `json:"renamed,omitempty"`
+	// Layers in both networks which differ.
+	Changed []LayerDiff `json:"changed,omitempty"`
+}
+
+type LayerRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// FieldChange gives the old and new value of a field
+// in protocol buffer text notation.
+// An unset field has an empty value.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// LayerDiff describes the differences between two layers.
+// Name is the name in the new network.
+type LayerDiff struct {
+	Name   string        `json:"name"`
+	Fields []FieldChange `json:"fields,omitempty"`
+	Blobs  []BlobDiff    `json:"blobs,omitempty"`
+}
+
+// BlobDiff describes the change to a blob.
+// If the shapes differ, the deltas are not computed.
+// A blob which exists in only one layer has zero dimensions in the other.
+type BlobDiff struct {
+	Index int      `json:"index"`
+	Old   BlobDims `json:"old"`
+	New   BlobDims `json:"new"`
+	// L2 norm and maximum absolute value of the difference.
+	L2     float64 `json:"l2"`
+	MaxAbs float64 `json:"max_abs"`
+	// L2 norm of the difference relative to that of the old blob.
+	RelL2 float64 `json:"rel_l2"`
+}
+
+// ShapeChanged reports whether the blob changed shape.
+func (d BlobDiff) ShapeChanged() bool {
+	return d.Old != d.New
+}
+
+// Empty reports whether the networks are the same.
+func (d *NetDiff) Empty() bool {
+	return len(d.Fields) == 0 && len(d.Added) == 0 && len(d.Removed) == 0 &&
+		len(d.Renamed) == 0 && len(d.Changed) == 0
+}
+
+// DiffNets compares two networks including their blobs.
+func DiffNets(a, b *NetParameter) *NetDiff {
+	d := new(NetDiff)
+	d.Fields = diffFields(netFields(a), netFields(b))
+
+	var removed, added []*LayerParameter
+	for _, x := range a.Layers {
+		if layerByName(b, x.GetName()) == nil {
+			removed = append(removed, x)
+		}
+	}
+	for _, y := range b.Layers {
+		x := layerByName(a, y.GetName())
+		if x == nil {
+			added = append(added, y)
+			continue
+		}
+		if ld := diffLayers(x, y); ld != nil {
+			d.Changed = append(d.Changed, *ld)
+		}
+	}
+
+	// Match removed and added layers which are otherwise identical.
+	matched := make(map[*LayerParameter]bool)
+	for _, x := range removed {
+		var to *LayerParameter
+		for _, y := range added {
+			if !matched[y] && sameStructure(x, y) {
+				to = y
+				break
+			}
+		}
+		if to == nil {
+			d.Removed = append(d.Removed, x.GetName())
+			continue
+		}
+		matched[to] = true
+		d.Renamed = append(d.Renamed, LayerRename{x.GetName(), to.GetName()})
+		if ld := diffLayers(x, to); ld != nil {
+			d.Changed = append(d.Changed, *ld)
+		}
+	}
+	for _, y := range added {
+		if !matched[y] {
+			d.Added = append(d.Added, y.GetName())
+		}
+	}
+	return d
+}
+
+// diffLayers returns nil if the layers are the same apart from their name.
+func diffLayers(a, b *LayerParameter) *LayerDiff {
+	d := &LayerDiff{Name: b.GetName()}
+	d.Fields = diffFields(layerFields(a), layerFields(b))
+	n := len(a.Blobs)
+	if len(b.Blobs) > n {
+		n = len(b.Blobs)
+	}
+	for i := 0; i < n; i++ {
+		var x, y *BlobProto
+		if i < len(a.Blobs) {
+			x = a.Blobs[i]
+		}
+		if i < len(b.Blobs) {
+			y = b.Blobs[i]
+		}
+		if bd := diffBlobs(i, x, y); bd != nil {
+			d.Blobs = append(d.Blobs, *bd)
+		}
+	}
+	if len(d.Fields) == 0 && len(d.Blobs) == 0 {
+		return nil
+	}
+	return d
+}
+
+// diffBlobs returns nil if the blobs are identical.
+// Either blob may be nil.
+func diffBlobs(index int, a, b *BlobProto) *BlobDiff {
+	d := &BlobDiff{Index: index}
+	if a != nil {
+		d.Old = blobDims(a)
+	}
+	if b != nil {
+		d.New = blobDims(b)
+	}
+	if a == nil || b == nil || d.ShapeChanged() || len(a.Data) != len(b.Data) {
+		return d
+	}
+	var sumSqr, normSqr float64
+	for i := range a.Data {
+		x, y := float64(a.Data[i]), float64(b.Data[i])
+		sumSqr += (y - x) * (y - x)
+		normSqr += x * x
+		d.MaxAbs = math.Max(d.MaxAbs, math.Abs(y-x))
+	}
+	if sumSqr == 0 {
+		return nil
+	}
+	d.L2 = math.Sqrt(sumSqr)
+	if normSqr > 0 {
+		d.RelL2 = d.L2 / math.Sqrt(normSqr)
+	}
+	return d
+}
+
+// sameStructure reports whether two layers have the same fields
+// and blob shapes, ignoring their names and the names of their blobs.
+func sameStructure(a, b *LayerParameter) bool {
+	if len(diffFields(layerFields(a, "bottom", "top"), layerFields(b, "bottom", "top"))) > 0 {
+		return false
+	}
+	if len(a.Blobs) != len(b.Blobs) {
+		return false
+	}
+	for i := range a.Blobs {
+		if blobDims(a.Blobs[i]) != blobDims(b.Blobs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// layerFields flattens a layer without its name, blobs
+// and any other fields listed in skip.
+func layerFields(layer *LayerParameter, skip ...string) map[string]string {
+	fields := make(map[string]string)
+	flattenMessage(fields, "", reflect.ValueOf(layer), append(skip, "name", "blobs")...)
+	return fields
+}
+
+// netFields flattens a network without its layers.
+func netFields(net *NetParameter) map[string]string {
+	fields := make(map[string]string)
+	flattenMessage(fields, "", reflect.ValueOf(net), "layers")
+	return fields
+}
+
+// flattenMessage adds every set field of a message to fields
+// with keys such as "convolution_param.kernel_size" and "bottom[0]".
+// Fields of the top-level message which are listed in skip are ignored.
+func flattenMessage(fields map[string]string, prefix string, v reflect.Value, skip ...string) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := protoFieldName(t.Field(i))
+		if name == "" || contains(skip, name) {
+			continue
+		}
+		flattenValue(fields, prefix+name, v.Field(i))
+	}
+}
+
+func flattenValue(fields map[string]string, key string, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		if v.Elem().Kind() == reflect.Struct {
+			flattenMessage(fields, key+".", v)
+			return
+		}
+		fields[key] = fmt.Sprint(v.Elem().Interface())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			fields[key] = fmt.Sprintf("%q", v.Bytes())
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			flattenValue(fields, fmt.Sprintf("%s[%d]", key, i), v.Index(i))
+		}
+	default:
+		fields[key] = fmt.Sprint(v.Interface())
+	}
+}
+
+// protoFieldName returns the name of a field in the .proto file,
+// or "" if the struct field is not part of the message.
+func protoFieldName(f reflect.StructField) string {
+	tag := f.Tag.Get("protobuf")
+	for _, part := range strings.Split(tag, ",") {
+		if strings.HasPrefix(part, "name=") {
+			return strings.TrimPrefix(part, "name=")
+		}
+	}
+	return ""
+}
+
+func diffFields(a, b map[string]string) []FieldChange {
+	var keys []string
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var changes []FieldChange
+	for _, k := range keys {
+		if a[k] != b[k] {
+			changes = append(changes, FieldChange{k, a[k], b[k]})
+		}
+	}
+	return changes
+}
+
+// WriteText prints the differences in a human-readable form.
+func (d *NetDiff) WriteText(w io.Writer) error {
+	p := &errWriter{w: w}
+	if d.Empty() {
+		p.printf("no differences\n")
+		return p.err
+	}
+	for _, f := range d.Fields {
+		p.printf("net %s\n", f.String())
+	}
+	for _, name := range d.Removed {
+		p.printf("- %s\n", name)
+	}
+	for _, name := range d.Added {
+		p.printf("+ %s\n", name)
+	}
+	for _, r := range d.Renamed {
+		p.printf("~ %s -> %s\n", r.From, r.To)
+	}
+	for _, l := range d.Changed {
+		p.printf("layer %s:\n", l.Name)
+		for _, f := range l.Fields {
+			p.printf("\t%s\n", f.String())
+		}
+		for _, b := range l.Blobs {
+			if b.ShapeChanged() {
+				p.printf("\tblob %d: %s -> %s\n", b.Index, dimsString(b.Old), dimsString(b.New))
+				continue
+			}
+			p.printf("\tblob %d: l2 %.4g (rel %.4g), max abs %.4g\n", b.Index, b.L2, b.RelL2, b.MaxAbs)
+		}
+	}
+	return p.err
+}
+
+func (f FieldChange) String() string {
+	unset := func(s string) string {
+		if s == "" {
+			return "(unset)"
+		}
+		return s
+	}
+	return fmt.Sprintf("%s: %s -> %s", f.Field, unset(f.Old), unset(f.New))
+}
+
+// dimsString gives blob dimensions as num x channels x height x width.
+func dimsString(d BlobDims) string {
+	if d == (BlobDims{}) {
+		return "(none)"
+	}
+	return fmt.Sprintf("%dx%dx%dx%d", d.Out, d.In, d.Height, d.Width)
+}
@@ -0,0 +1,140 @@
+package caffe
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DOTOptions controls the annotations in a graph of a network.
+type DOTOptions struct {
+	// If not nil, blobs are annotated with their shapes for this input.
+	Input *Shape
+	// Annotate layers with their number of parameters.
+	// Requires Input unless the layers have blobs.
+	Params bool
+	// Annotate layers with their rate and receptive field.
+	Field bool
+	// If not nil, the layers of this network are highlighted.
+	// For example, the result of SubsetForOutput.
+	Highlight *NetParameter
+}
+
+// WriteDOT renders a network as a Graphviz graph
+// with nodes for layers and blobs.
+// In-place layers are drawn as part of the layer which produces their blob.
+func WriteDOT(w io.Writer, net *NetParameter, opts DOTOptions) error {
+	var (
+		shapes map[string]Shape
+		err    error
+	)
+	if opts.Input != nil {
+		shapes, err = InferShapes(net, *opts.Input)
+		if err != nil {
+			return err
+		}
+	}
+	highlight := make(map[string]bool)
+	if opts.Highlight != nil {
+		for _, layer := range opts.Highlight.Layers {
+			highlight[layer.GetName()] = true
+		}
+	}
+	// Collapse in-place layers onto their producer.
+	var (
+		inPlace = make(map[string]bool)
+		merged  = make(map[string][]string)
+	)
+	for _, layer := range net.Layers {
+		if isInPlace(layer) {
+			continue
+		}
+		for _, top := range layer.Top {
+			for _, loop := range findLoops(net, top) {
+				inPlace[loop] = true
+				merged[layer.GetName()] = append(merged[layer.GetName()], loop)
+			}
+		}
+	}
+
+	d := &dotWriter{errWriter{w: w}}
+	d.printf("digraph %q {\n", net.GetName())
+	d.printf("\trankdir=BT;\n")
+	for _, input := range net.Input {
+		d.blob(input, shapes, opts.Highlight != nil)
+	}
+	for _, layer := range net.Layers {
+		name := layer.GetName()
+		if inPlace[name] {
+			continue
+		}
+		lines := []string{name, layer.GetType().String()}
+		for _, loop := range merged[name] {
+			l := layerByName(net, loop)
+			lines = append(lines, fmt.Sprintf("+ %s (%s)", loop, l.GetType().String()))
+		}
+		if opts.Params && len(layer.Bottom) > 0 {
+			in, ok := shapes[layer.Bottom[0]]
+			if ok || len(layer.Blobs) > 0 {
+				if n := numParams(layer, in); n > 0 {
+					lines = append(lines, fmt.Sprintf("params: %d", n))
+				}
+			}
+		}
+		if opts.Field {
+			if rate, field, err := layerGeometry(net, name); err == nil {
+				lines = append(lines, fmt.Sprintf("rate: %d, field: %dx%d", rate, field.X, field.Y))
+			}
+		}
+		attrs := fmt.Sprintf("shape=box, label=%q", strings.Join(lines, "\n"))
+		if highlight[name] {
+			attrs += ", style=filled, fillcolor=lightblue"
+		}
+		d.printf("\t%q [%s];\n", "layer/"+name, attrs)
+		for _, top := range layer.Top {
+			d.blob(top, shapes, highlight[name])
+		}
+		for _, bottom := range layer.Bottom {
+			d.printf("\t%q -> %q;\n", "blob/"+bottom, "layer/"+name)
+		}
+		for _, top := range layer.Top {
+			d.printf("\t%q -> %q;\n", "layer/"+name, "blob/"+top)
+		}
+	}
+	d.printf("}\n")
+	return d.err
+}
+
+func isInPlace(layer *LayerParameter) bool {
+	return len(layer.Top) == 1 && len(layer.Bottom) == 1 && layer.Top[0] == layer.Bottom[0]
+}
+
+// errWriter remembers the first error so that
+// a sequence of writes can be checked once at the end.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) printf(format string, args ...interface{}) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = fmt.Fprintf(e.w, format, args...)
+}
+
+type dotWriter struct {
+	errWriter
+}
+
+func (d *dotWriter) blob(name string, shapes map[string]Shape, highlight bool) {
+	label := name
+	if s, ok := shapes[name]; ok {
+		label += "\n" + s.String()
+	}
+	attrs := fmt.Sprintf("shape=ellipse, label=%q", label)
+	if highlight {
+		attrs += ", style=filled, fillcolor=lightblue"
+	}
+	d.printf("\t%q [%s];\n", "blob/"+name, attrs)
+}
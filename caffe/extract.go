@@ -1,6 +1,7 @@
 package caffe
 
 import (
+	"encoding/json"
 	"fmt"
 	"image"
 	"image/png"
@@ -10,15 +11,42 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"time"
 
 	"code.google.com/p/goprotobuf/proto"
 	"github.com/jvlmdr/go-cv/rimg64"
 )
 
 func Extract(scriptFile string, ims []image.Image, layer string, model *NetParameter, weightsFile, meanFile string) ([]*rimg64.Multi, error) {
+	feats, _, err := extract(scriptFile, ims, layer, model, weightsFile, meanFile, false)
+	return feats, err
+}
+
+// ExtractTiming is the time taken by each part of Extract.
+type ExtractTiming struct {
+	// From starting the process until Caffe has been imported.
+	// The end is read from the wall clock in Python,
+	// so the process must run on the same machine
+	// and the clock must not be adjusted during the call.
+	Startup time.Duration
+	// Loading the model and weights.
+	Load time.Duration
+	// Forward passes through the network.
+	Forward time.Duration
+	// Whole call including writing and reading files.
+	Total time.Duration
+}
+
+// ExtractTimed is like Extract but also measures the time of each part.
+func ExtractTimed(scriptFile string, ims []image.Image, layer string, model *NetParameter, weightsFile, meanFile string) ([]*rimg64.Multi, *ExtractTiming, error) {
+	return extract(scriptFile, ims, layer, model, weightsFile, meanFile, true)
+}
+
+func extract(scriptFile string, ims []image.Image, layer string, model *NetParameter, weightsFile, meanFile string, timed bool) ([]*rimg64.Multi, *ExtractTiming, error) {
+	start := time.Now()
 	dir, err := ioutil.TempDir("", "tmp-")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer remove(dir)
 	// Save images to files.
@@ -31,28 +59,34 @@ func Extract(scriptFile string, ims []image.Image, layer string, model *NetParam
 		outputFiles[i] = path.Join(dir, fmt.Sprintf("feats-%03d.multi", i))
 		err := save(inputFiles[i], func(w io.Writer) error { return png.Encode(w, im) })
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 	// Save list of files to a file.
 	listFile := path.Join(dir, "files.csv")
 	err = save(listFile, func(w io.Writer) error { return writeFileList(w, inputFiles, outputFiles) })
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// Save parameters to file.
 	modelFile := path.Join(dir, "model.txt")
 	err = save(modelFile, func(w io.Writer) error { return proto.MarshalText(w, model) })
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Invoke Python program.
-	cmd := exec.Command("python", scriptFile, modelFile, weightsFile, meanFile, layer, listFile)
+	args := []string{scriptFile, modelFile, weightsFile, meanFile, layer, listFile}
+	timingsFile := path.Join(dir, "timings.json")
+	if timed {
+		args = append(args, "--timings", timingsFile)
+	}
+	cmd := exec.Command("python", args...)
 	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
+	startCmd := time.Now()
 	if err := cmd.Run(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Read output from CSV files.
@@ -72,11 +106,33 @@ func Extract(scriptFile string, ims []image.Image, layer string, model *NetParam
 			return nil
 		})
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 	log.Println("done: load images")
-	return feats, nil
+	if !timed {
+		return feats, nil, nil
+	}
+	var stages struct {
+		Start         float64
+		Load, Forward float64
+	}
+	err = load(timingsFile, func(r io.ReadSeeker) error { return json.NewDecoder(r).Decode(&stages) })
+	if err != nil {
+		return nil, nil, fmt.Errorf("read timings: %v", err)
+	}
+	imported := time.Unix(0, int64(stages.Start*1e9))
+	timing := &ExtractTiming{
+		Startup: imported.Sub(startCmd),
+		Load:    seconds(stages.Load),
+		Forward: seconds(stages.Forward),
+		Total:   time.Since(start),
+	}
+	return feats, timing, nil
+}
+
+func seconds(x float64) time.Duration {
+	return time.Duration(x * float64(time.Second))
 }
 
 func remove(dir string) {
@@ -91,8 +147,11 @@ func save(fname string, write func(w io.Writer) error) error {
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	return write(file)
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
 }
 
 func load(fname string, read func(r io.ReadSeeker) error) error {
@@ -1,4 +1,5 @@
 import argparse
+import json
 import numpy as np
 import caffe
 import csv
@@ -6,6 +7,7 @@ from google.protobuf import text_format
 from caffe.proto import caffe_pb2
 import tempfile
 import os
+import time
 import image_pb2
 
 def load_mean(fname):
@@ -59,14 +61,21 @@ def layer_size(net, name, size):
     layer = layers[name]
 
     field, stride = 1, 1
+    # Whether the layer sees its entire input.
+    whole = False
     if layer.type == caffe_pb2.LayerParameter.CONVOLUTION:
       field = layer.convolution_param.kernel_size
       stride = layer.convolution_param.stride
     elif layer.type == caffe_pb2.LayerParameter.POOLING:
       field = layer.pooling_param.kernel_size
       stride = layer.pooling_param.stride
-    elif layer.type == caffe_pb2.LayerParameter.LRN:
+    elif layer.type in (caffe_pb2.LayerParameter.LRN,
+        caffe_pb2.LayerParameter.RELU, caffe_pb2.LayerParameter.DROPOUT,
+        caffe_pb2.LayerParameter.POWER, caffe_pb2.LayerParameter.SOFTMAX):
       pass
+    elif layer.type in (caffe_pb2.LayerParameter.INNER_PRODUCT,
+        caffe_pb2.LayerParameter.FLATTEN):
+      whole = True
     else:
       enum = caffe_pb2.LayerParameter.DESCRIPTOR.enum_types_by_name["LayerType"]
       value = enum.values_by_number[layer.type].name
@@ -77,6 +86,8 @@ def layer_size(net, name, size):
       raise RuntimeError("number of input layers not one: " + len(bottoms))
     prev = helper(bottoms[0])
     out = tuple([max(0, ceildiv(n-field+1, stride)) for n in prev])
+    if whole:
+      out = (1, 1)
     print("{}: {} -> {}".format(name, prev, out))
     return out
   return helper(name)
@@ -144,22 +155,29 @@ def new_net(model):
   return net
 
 def main():
+  # Time at which imports are done, to measure start-up.
+  start = time.time()
   parser = argparse.ArgumentParser()
   parser.add_argument("model", metavar="model.prototxt")
   parser.add_argument("pretrained")
   parser.add_argument("mean", metavar="mean.npy")
   parser.add_argument("layer")
   parser.add_argument("files", metavar="files.csv")
+  parser.add_argument("--timings", metavar="timings.json",
+      help="write the time of each stage to a file")
   args = parser.parse_args()
+  load_time, forward_time = 0.0, 0.0
 
   # Load input and output files from CSV.
   files = read_csv(args.files)
   # Load mean.
   mean = load_mean(args.mean)
 
+  t = time.time()
   model = load_model(args.model)
   pretrained = caffe.Classifier(args.model, args.pretrained,
       channel_swap=(2,1,0), raw_scale=255.0)
+  load_time += time.time() - t
 
   for in_file, out_file in files:
     # Retrieve image size.
@@ -174,19 +192,27 @@ def main():
       model.input_dim[0] = 1
       model.input_dim[2:4] = imsz
       # Instantiate network.
+      t = time.time()
       net = new_net(model)
       copy_weights(net, pretrained)
       net.set_phase_test()
       net.set_channel_swap("data", (2,1,0))
       net.set_raw_scale("data", 255.0)
+      load_time += time.time() - t
       # Evaluate network.
       data = np.asarray([preprocess(net, "data", im, mean)])
+      t = time.time()
       net.forward(data=data)
+      forward_time += time.time() - t
       out = net.blobs[args.layer].data
       # Take valid sub-image.
       print("crop {} from {}".format(ftsz, out.shape[2:4]))
       out = out[0, :, :ftsz[0], :ftsz[1]]
     save_image(out_file, out)
 
+  if args.timings:
+    with open(args.timings, "w") as f:
+      json.dump({"start": start, "load": load_time, "forward": forward_time}, f)
+
 if __name__ == "__main__":
   main()
@@ -1,6 +1,7 @@
 package caffe
 
 import (
+	"fmt"
 	"image"
 	"path"
 
@@ -10,17 +11,23 @@ import (
 
 func init() {
 	featset.RegisterImage("caffe", func() featset.Image { return new(Feature) })
+	featset.RegisterReal("caffe-softmax", func() featset.Real { return new(softmax) })
 }
 
 var (
 	ExtractScript string
 	ModelsDir     string
 	MeanFile      string
+	// If not nil, features are looked up in the cache before being computed.
+	FeatureCache *Cache
 )
 
 // Feature describes a pre-trained Caffe feature.
 type Feature struct {
-	// The pre-trained weights are expected at
+	// If [ModelsDir]/[WeightsName] contains a manifest,
+	// the weights and mean are taken from the manifest
+	// and the weights must match its checksum.
+	// Otherwise the pre-trained weights are expected at
 	//  [ModelsDir]/[WeightsName]/[WeightsName].caffemodel
 	WeightsName string
 	// The model as protocol buffer text.
@@ -29,6 +36,23 @@ type Feature struct {
 	Layer string
 }
 
+// NewFeature creates a feature from a model in the registry at ModelsDir.
+// The network is read from the deploy file in the manifest.
+func NewFeature(name, layer string) (*Feature, error) {
+	m, err := LoadModel(name)
+	if err != nil {
+		return nil, err
+	}
+	net, err := m.LoadDeploy()
+	if err != nil {
+		return nil, err
+	}
+	if layerByName(net, layer) == nil {
+		return nil, fmt.Errorf("model %s: could not find layer: %s", name, layer)
+	}
+	return &Feature{WeightsName: name, Model: net, Layer: layer}, nil
+}
+
 func (phi *Feature) Rate() int {
 	return LayerRate(phi.Model, phi.Layer)
 }
@@ -48,7 +72,69 @@ func (phi *Feature) Marshaler() *featset.ImageMarshaler {
 func (phi *Feature) Transform() featset.Image { return phi }
 
 func (phi *Feature) Map(ims []image.Image) ([]*rimg64.Multi, error) {
-	return Extract(ExtractScript, ims, phi.Layer, phi.Model, weightsFile(phi.WeightsName), MeanFile)
+	weights, mean, err := phi.files()
+	if err != nil {
+		return nil, err
+	}
+	if FeatureCache == nil {
+		return Extract(ExtractScript, ims, phi.Layer, phi.Model, weights, mean)
+	}
+	return phi.cachedMap(FeatureCache, ims, weights, mean)
+}
+
+// files returns the weights and mean files of the feature.
+func (phi *Feature) files() (weights, mean string, err error) {
+	if !(Registry{ModelsDir}).Has(phi.WeightsName) {
+		return weightsFile(phi.WeightsName), MeanFile, nil
+	}
+	m, err := LoadModel(phi.WeightsName)
+	if err != nil {
+		return "", "", err
+	}
+	return m.WeightsFile(), m.MeanFilePath(), nil
+}
+
+// cachedMap computes features only for the images which are not in the cache.
+func (phi *Feature) cachedMap(cache *Cache, ims []image.Image, weights, mean string) ([]*rimg64.Multi, error) {
+	prefix, err := featureKeyPrefix(phi.Model, phi.Layer, weights, mean)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		feats = make([]*rimg64.Multi, len(ims))
+		keys  = make([]string, len(ims))
+		miss  []int
+	)
+	for i, im := range ims {
+		keys[i] = featureKey(prefix, im)
+		f, ok, err := cache.Get(keys[i])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			miss = append(miss, i)
+			continue
+		}
+		feats[i] = f
+	}
+	if len(miss) == 0 {
+		return feats, nil
+	}
+	subset := make([]image.Image, len(miss))
+	for j, i := range miss {
+		subset[j] = ims[i]
+	}
+	computed, err := Extract(ExtractScript, subset, phi.Layer, phi.Model, weights, mean)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range miss {
+		feats[i] = computed[j]
+		if err := cache.Put(keys[i], feats[i]); err != nil {
+			return nil, err
+		}
+	}
+	return feats, nil
 }
 
 // Returns "[ModelsDir]/[name]/[name].caffemodel".
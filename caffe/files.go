@@ -0,0 +1,133 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ModelFiles locates a network, its weights and its mean,
+// either by name in the registry or as individual files.
+type ModelFiles struct {
+	// Name of a model in the registry at ModelsDir.
+	// Files which are not given are taken from its manifest.
+	Name string
+	// Network definition in any Format, as determined by the extension.
+	Arch string
+	// Weights (caffemodel).
+	Weights string
+	// Mean image as saved by numpy, for the Python script.
+	MeanFile string
+	// Mean pixel in RGB order, for native transforms.
+	Mean []float64
+	// Text file with one class label per line.
+	Labels string
+	// Size of the images which the network was trained on,
+	// or zero if it is not known.
+	InputSize image.Point
+}
+
+// Resolve returns a copy with the files which are not given
+// taken from the registry.
+// Without a model name, the files are returned unchanged.
+func (f ModelFiles) Resolve() (ModelFiles, error) {
+	if f.Name == "" {
+		return f, nil
+	}
+	m, err := LoadModel(f.Name)
+	if err != nil {
+		return f, err
+	}
+	if f.Arch == "" {
+		f.Arch = m.DeployFile()
+	}
+	if f.Weights == "" {
+		f.Weights = m.WeightsFile()
+	}
+	if f.MeanFile == "" {
+		f.MeanFile = m.MeanFilePath()
+	}
+	if f.Mean == nil {
+		f.Mean = m.Mean
+	}
+	if f.Labels == "" {
+		f.Labels = m.LabelsFile()
+	}
+	if f.InputSize == (image.Point{}) {
+		f.InputSize = m.InputSize()
+	}
+	return f, nil
+}
+
+// LoadArch reads the network definition without weights.
+func (f ModelFiles) LoadArch() (*NetParameter, error) {
+	if f.Arch == "" {
+		return nil, fmt.Errorf("no network definition")
+	}
+	net := new(NetParameter)
+	if err := LoadMessage(f.Arch, net); err != nil {
+		return nil, fmt.Errorf("load %s: %v", f.Arch, err)
+	}
+	return net, nil
+}
+
+// LoadNet reads the network definition and copies in the weights.
+func (f ModelFiles) LoadNet(opts CopyOptions) (*NetParameter, *WeightsReport, error) {
+	net, err := f.LoadArch()
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.Weights == "" {
+		return nil, nil, fmt.Errorf("no weights")
+	}
+	weights, err := LoadWeights(f.Weights)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load weights: %v", err)
+	}
+	report, err := CopyWeights(net, weights, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return net, report, nil
+}
+
+// LoadImage decodes a JPEG or PNG image.
+func LoadImage(fname string) (image.Image, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	im, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+	return im, nil
+}
+
+// SavePNG encodes an image as PNG.
+func SavePNG(fname string, im image.Image) error {
+	return save(fname, func(w io.Writer) error { return png.Encode(w, im) })
+}
+
+// ParseMean parses a mean pixel given as "r,g,b".
+func ParseMean(s string) ([]float64, error) {
+	strs := strings.Split(s, ",")
+	if len(strs) != 3 {
+		return nil, fmt.Errorf("mean must have 3 elements: found %d", len(strs))
+	}
+	mean := make([]float64, len(strs))
+	for i, str := range strs {
+		x, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		if err != nil {
+			return nil, err
+		}
+		mean[i] = x
+	}
+	return mean, nil
+}
@@ -0,0 +1,200 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/jvlmdr/go-cv/slide"
+)
+
+// MontageOptions controls how the filters of a layer are drawn.
+type MontageOptions struct {
+	// Number of filters in each row.
+	// If zero, the montage is roughly square.
+	Columns int
+	// Pixels between filters.
+	Padding int
+	// Each weight is drawn as a square of this many pixels.
+	// If zero, one pixel.
+	Zoom int
+	// Contrast gain after normalization.
+	// Values beyond the range are clipped.
+	// If zero, one.
+	Scale float64
+	// Which weights are mapped to the full range.
+	Normalize Normalization
+}
+
+// Normalization chooses the weights which are mapped to the full range.
+type Normalization int
+
+const (
+	// NormalizePerFilter scales each filter by its own largest magnitude.
+	NormalizePerFilter Normalization = iota
+	// NormalizeGlobal scales all filters by the largest magnitude in the layer.
+	NormalizeGlobal
+)
+
+func (n Normalization) String() string {
+	switch n {
+	case NormalizePerFilter:
+		return "filter"
+	case NormalizeGlobal:
+		return "global"
+	default:
+		return fmt.Sprintf("Normalization(%d)", int(n))
+	}
+}
+
+// ParseNormalization parses "filter" or "global".
+func ParseNormalization(s string) (Normalization, error) {
+	switch s {
+	case "filter":
+		return NormalizePerFilter, nil
+	case "global":
+		return NormalizeGlobal, nil
+	default:
+		return 0, fmt.Errorf("unknown normalization: %s", s)
+	}
+}
+
+// FilterMontage draws the filters of a convolution layer in one image.
+// Filters which are applied to the image are drawn in color,
+// undoing the BGR order of the channels.
+// Other filters are drawn as a grayscale grid with one tile per input channel.
+// Zero is mid-gray and the sign of a weight gives its direction.
+func FilterMontage(net *NetParameter, name string, opts MontageOptions) (*image.RGBA, error) {
+	layer := layerByName(net, name)
+	if layer == nil {
+		return nil, fmt.Errorf("could not find layer: %s", name)
+	}
+	if layer.GetType() != LayerParameter_CONVOLUTION {
+		return nil, fmt.Errorf("layer %s is not a convolution: %s", name, layer.GetType().String())
+	}
+	if len(layer.Blobs) == 0 {
+		return nil, fmt.Errorf("layer %s has no weights", name)
+	}
+	bank, err := filterBankFromBlob(layer.Blobs[0], blobDims(layer.Blobs[0]))
+	if err != nil {
+		return nil, fmt.Errorf("layer %s: %v", name, err)
+	}
+	rgb := bank.Channels == 3 && len(layer.Bottom) == 1 && isInput(net, layer.Bottom[0])
+	im, err := montage(bank, rgb, opts)
+	if err != nil {
+		return nil, fmt.Errorf("layer %s: %v", name, err)
+	}
+	return im, nil
+}
+
+// montage draws a filter bank.
+// If rgb is true, the filters must have three channels in BGR order.
+func montage(bank *slide.MultiBank, rgb bool, opts MontageOptions) (*image.RGBA, error) {
+	if opts.Columns < 0 || opts.Padding < 0 || opts.Zoom < 0 {
+		return nil, fmt.Errorf("negative columns, padding or zoom: %d, %d, %d", opts.Columns, opts.Padding, opts.Zoom)
+	}
+	if opts.Scale < 0 {
+		return nil, fmt.Errorf("negative scale: %g", opts.Scale)
+	}
+	if opts.Normalize != NormalizePerFilter && opts.Normalize != NormalizeGlobal {
+		return nil, fmt.Errorf("unknown normalization: %v", opts.Normalize)
+	}
+	if len(bank.Filters) == 0 {
+		return nil, fmt.Errorf("no filters")
+	}
+	if bank.Width <= 0 || bank.Height <= 0 || bank.Channels <= 0 {
+		return nil, fmt.Errorf("empty filters: %dx%dx%d", bank.Width, bank.Height, bank.Channels)
+	}
+	zoom := opts.Zoom
+	if zoom <= 0 {
+		zoom = 1
+	}
+	scale := opts.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	n := len(bank.Filters)
+	cols := opts.Columns
+	if cols <= 0 {
+		cols = int(math.Ceil(math.Sqrt(float64(n))))
+	}
+	cols = clampInt(cols, 1, n)
+	rows := (n + cols - 1) / cols
+
+	// Size of one channel and of the grid of channels of a grayscale filter.
+	cell := image.Pt(bank.Width*zoom, bank.Height*zoom)
+	gridCols, gridRows := 1, 1
+	if !rgb {
+		gridCols = int(math.Ceil(math.Sqrt(float64(bank.Channels))))
+		gridRows = (bank.Channels + gridCols - 1) / gridCols
+	}
+	const gap = 1
+	tile := image.Pt(gridCols*cell.X+(gridCols-1)*gap, gridRows*cell.Y+(gridRows-1)*gap)
+
+	size := image.Pt(
+		cols*tile.X+(cols+1)*opts.Padding,
+		rows*tile.Y+(rows+1)*opts.Padding,
+	)
+	dst := image.NewRGBA(image.Rectangle{Max: size})
+	draw.Draw(dst, dst.Bounds(), image.White, image.ZP, draw.Src)
+
+	global := 0.0
+	if opts.Normalize == NormalizeGlobal {
+		for _, f := range bank.Filters {
+			global = math.Max(global, maxAbs(f.Elems))
+		}
+	}
+	// level maps a weight to [0, 255].
+	level := func(x, max float64) uint8 {
+		if max > 0 {
+			x /= max
+		}
+		y := 0.5 + 0.5*scale*x
+		return uint8(math.Floor(255*math.Max(0, math.Min(1, y)) + 0.5))
+	}
+
+	for i, f := range bank.Filters {
+		max := global
+		if opts.Normalize == NormalizePerFilter {
+			max = maxAbs(f.Elems)
+		}
+		origin := image.Pt(
+			opts.Padding+(i%cols)*(tile.X+opts.Padding),
+			opts.Padding+(i/cols)*(tile.Y+opts.Padding),
+		)
+		if rgb {
+			for u := 0; u < f.Width; u++ {
+				for v := 0; v < f.Height; v++ {
+					c := color.RGBA{level(f.At(u, v, 2), max), level(f.At(u, v, 1), max), level(f.At(u, v, 0), max), 255}
+					fillCell(dst, origin.Add(image.Pt(u*zoom, v*zoom)), zoom, c)
+				}
+			}
+			continue
+		}
+		for p := 0; p < f.Channels; p++ {
+			corner := origin.Add(image.Pt((p%gridCols)*(cell.X+gap), (p/gridCols)*(cell.Y+gap)))
+			for u := 0; u < f.Width; u++ {
+				for v := 0; v < f.Height; v++ {
+					y := level(f.At(u, v, p), max)
+					fillCell(dst, corner.Add(image.Pt(u*zoom, v*zoom)), zoom, color.RGBA{y, y, y, 255})
+				}
+			}
+		}
+	}
+	return dst, nil
+}
+
+func fillCell(dst *image.RGBA, min image.Point, zoom int, c color.RGBA) {
+	r := image.Rectangle{min, min.Add(image.Pt(zoom, zoom))}
+	draw.Draw(dst, r, &image.Uniform{c}, image.ZP, draw.Src)
+}
+
+func maxAbs(x []float64) float64 {
+	var max float64
+	for _, xi := range x {
+		max = math.Max(max, math.Abs(xi))
+	}
+	return max
+}
@@ -0,0 +1,121 @@
+package caffe
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-cv/slide"
+)
+
+// The weights are set by the test.
+const filtersTestNet = `
+name: "FiltersNet"
+input: "data"
+input_dim: 1 input_dim: 3 input_dim: 9 input_dim: 9
+layers { name: "conv1" type: CONVOLUTION bottom: "data" top: "conv1"
+  convolution_param { num_output: 4 kernel_size: 3 }
+  blobs { num: 4 channels: 3 height: 3 width: 3 }
+  blobs { num: 1 channels: 1 height: 1 width: 4 } }
+layers { name: "pool1" type: POOLING bottom: "conv1" top: "pool1"
+  pooling_param { pool: MAX kernel_size: 2 stride: 2 } }
+layers { name: "conv2" type: CONVOLUTION bottom: "pool1" top: "conv2"
+  convolution_param { num_output: 6 kernel_size: 2 group: 2 }
+  blobs { num: 6 channels: 2 height: 2 width: 2 }
+  blobs { num: 1 channels: 1 height: 1 width: 6 } }
+`
+
+func TestFilterMontage(t *testing.T) {
+	net := new(NetParameter)
+	if err := proto.UnmarshalText(filtersTestNet, net); err != nil {
+		t.Fatal(err)
+	}
+	for _, layer := range net.Layers {
+		for _, blob := range layer.Blobs {
+			blob.Data = make([]float32, blobDims(blob).NumElems())
+		}
+	}
+
+	// Make the first filter of conv1 respond only to the blue channel,
+	// which is the first channel of the blob.
+	blob := layerByName(net, "conv1").Blobs[0]
+	blob.Data[0] = 1
+
+	opts := MontageOptions{Padding: 1, Zoom: 2}
+	im, err := FilterMontage(net, "conv1", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 4 filters of 3x3 in 2 columns, zoomed by 2.
+	if size := im.Bounds().Size(); !size.Eq(image.Pt(15, 15)) {
+		t.Fatalf("conv1: got size %v, want (15,15)", size)
+	}
+	want := []struct {
+		At image.Point
+		C  color.RGBA
+	}{
+		{image.Pt(1, 1), color.RGBA{128, 128, 255, 255}},
+		{image.Pt(2, 2), color.RGBA{128, 128, 255, 255}},
+		{image.Pt(3, 1), color.RGBA{128, 128, 128, 255}},
+		{image.Pt(0, 0), color.RGBA{255, 255, 255, 255}},
+	}
+	for _, w := range want {
+		if got := im.RGBAAt(w.At.X, w.At.Y); got != w.C {
+			t.Errorf("conv1 at %v: got %v, want %v", w.At, got, w.C)
+		}
+	}
+
+	// With global normalization, the weight of largest magnitude in the layer
+	// is the only one at the end of the range.
+	blob = layerByName(net, "conv2").Blobs[0]
+	for i := range blob.Data {
+		blob.Data[i] = float32(i%5)*0.1 - 0.2
+	}
+	blob.Data[5] = -1
+	opts = MontageOptions{Normalize: NormalizeGlobal}
+	im, err = FilterMontage(net, "conv2", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 6 filters in 3 columns, each 2 channels of 2x2 side by side.
+	if size := im.Bounds().Size(); !size.Eq(image.Pt(15, 4)) {
+		t.Fatalf("conv2: got size %v, want (15,4)", size)
+	}
+	var extreme int
+	b := im.Bounds()
+	for x := b.Min.X; x < b.Max.X; x++ {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			c := im.RGBAAt(x, y)
+			// Gaps between channels are white.
+			if c.R == 0 || (c.R == 255 && !isGap(x)) {
+				extreme++
+			}
+		}
+	}
+	if extreme != 1 {
+		t.Errorf("conv2: got %d weights at the end of the range, want 1", extreme)
+	}
+
+	if _, err := FilterMontage(net, "pool1", opts); err == nil {
+		t.Error("expect error for pooling layer")
+	}
+	errCases := map[string]MontageOptions{
+		"negative padding": {Padding: -1},
+		"negative zoom":    {Zoom: -2},
+		"negative columns": {Columns: -1},
+		"negative scale":   {Scale: -1},
+		"normalization":    {Normalize: Normalization(2)},
+	}
+	for name, opts := range errCases {
+		if _, err := FilterMontage(net, "conv2", opts); err == nil {
+			t.Errorf("%s: expect error", name)
+		}
+	}
+	if _, err := montage(&slide.MultiBank{Width: 3, Height: 3, Channels: 3}, true, MontageOptions{}); err == nil {
+		t.Error("no filters: expect error")
+	}
+}
+
+// isGap reports whether a column of the conv2 montage is between channels.
+func isGap(x int) bool { return x%5 == 2 }
@@ -0,0 +1,358 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-cv/featset"
+)
+
+// FoldPreprocess returns a copy of the network in which
+// the preprocessing of FromProto is folded into the first convolution.
+// The folded network takes RGB images with values in [0, 1]
+// instead of BGR images in [0, 255] minus the mean.
+// The mean is given in RGB order.
+// The first convolution must not be padded or grouped,
+// since padding with zero is not the same before and after subtracting the mean.
+func FoldPreprocess(net *NetParameter, mean []float64) (*NetParameter, error) {
+	if len(net.Input) != 1 {
+		return nil, fmt.Errorf("number of network inputs is not 1: %d", len(net.Input))
+	}
+	if len(mean) != 3 {
+		return nil, fmt.Errorf("mean must have 3 elements: found %d", len(mean))
+	}
+	dst := proto.Clone(net).(*NetParameter)
+	users := consumers(dst, dst.Input[0])
+	if len(users) != 1 {
+		return nil, fmt.Errorf("input is used by %d layers", len(users))
+	}
+	layer := dst.Layers[users[0]]
+	if layer.GetType() != LayerParameter_CONVOLUTION {
+		return nil, fmt.Errorf("layer %s: first layer is not a convolution: %s", layer.GetName(), layer.GetType().String())
+	}
+	param := layer.GetConvolutionParam()
+	if pad := param.Padding(); pad != (image.Point{}) {
+		return nil, fmt.Errorf("layer %s: cannot fold mean into padded convolution", layer.GetName())
+	}
+	if param.GetGroup() > 1 {
+		return nil, fmt.Errorf("layer %s: cannot fold into grouped convolution", layer.GetName())
+	}
+	if len(layer.Blobs) != 2 {
+		return nil, fmt.Errorf("layer %s: number of convolution blobs is not 2: %d", layer.GetName(), len(layer.Blobs))
+	}
+	var (
+		k    = param.Kernel()
+		out  = int(param.GetNumOutput())
+		dims = BlobDims{Width: k.X, Height: k.Y, In: 3, Out: out}
+	)
+	weights, bias := layer.Blobs[0], layer.Blobs[1]
+	if err := errIfDimsNotEq(dims, blobDims(weights)); err != nil {
+		return nil, fmt.Errorf("layer %s: %v", layer.GetName(), err)
+	}
+	if err := errIfWrongNumElems(dims, weights); err != nil {
+		return nil, fmt.Errorf("layer %s: %v", layer.GetName(), err)
+	}
+	if _, err := biasFromBlob(bias, out); err != nil {
+		return nil, fmt.Errorf("layer %s: %v", layer.GetName(), err)
+	}
+
+	// The network computes W[o][c] * (255 * x[2-c] - mean[2-c]) + b[o]
+	// where x is the RGB image and c is a BGR channel.
+	n := k.X * k.Y
+	folded := make([]float32, len(weights.Data))
+	for o := 0; o < out; o++ {
+		shift := float64(bias.Data[o])
+		for c := 0; c < 3; c++ {
+			src := weights.Data[(o*3+c)*n : (o*3+c+1)*n]
+			dst := folded[(o*3+2-c)*n : (o*3+2-c+1)*n]
+			for i, w := range src {
+				dst[i] = 255 * w
+				shift -= float64(w) * mean[2-c]
+			}
+		}
+		bias.Data[o] = float32(shift)
+	}
+	weights.Data = folded
+	return dst, nil
+}
+
+// FusePower returns a copy of the network in which
+// POWER layers with power 1 are merged into an adjacent
+// convolution or inner product layer.
+// An in-place POWER layer is merged into the layer which produces its input
+// if it is the first operation on that output.
+// Otherwise it is merged into the layer which consumes its output
+// if that is the only consumer.
+// The output of a merged POWER layer is no longer available.
+func FusePower(net *NetParameter) (*NetParameter, error) {
+	dst := proto.Clone(net).(*NetParameter)
+	for {
+		fused, err := fuseOnePower(dst)
+		if err != nil {
+			return nil, err
+		}
+		if !fused {
+			return dst, nil
+		}
+	}
+}
+
+// Optimize folds the preprocessing and fuses POWER layers.
+// The result can be used with FromFoldedProto.
+func Optimize(net *NetParameter, mean []float64) (*NetParameter, error) {
+	folded, err := FoldPreprocess(net, mean)
+	if err != nil {
+		return nil, err
+	}
+	return FusePower(folded)
+}
+
+// FromFoldedProto creates a feature transform from a network
+// whose preprocessing has been folded into the first convolution.
+func FromFoldedProto(net *NetParameter, output string) (featset.Image, error) {
+	if len(net.Input) != 1 {
+		return nil, fmt.Errorf("number of network inputs is not 1: %d", len(net.Input))
+	}
+	phi, _, err := fromProto(net, output)
+	if err != nil {
+		return nil, err
+	}
+	return &featset.ComposeImage{phi, new(featset.RGB)}, nil
+}
+
+// VerifyFolded checks that the original and optimized networks
+// give the same output for an image.
+// If the image is nil, random colors are used, with the input size of the network
+// or, if that is not given, the size which gives an output of 4x4.
+// The maximum absolute difference must not exceed
+// tol times the maximum absolute value of the original output.
+func VerifyFolded(net, folded *NetParameter, output string, mean []float64, im image.Image, tol float64) error {
+	if im == nil {
+		var size image.Point
+		if in, err := InputShape(net); err == nil {
+			size = in.Size()
+		} else {
+			rate, field := LayerRate(net, output), LayerField(net, output)
+			size = field.Add(image.Pt(3*rate, 3*rate))
+		}
+		im = randomImage(size)
+	}
+	phi, err := FromProto(net, output, mean)
+	if err != nil {
+		return err
+	}
+	psi, err := FromFoldedProto(folded, output)
+	if err != nil {
+		return fmt.Errorf("folded: %v", err)
+	}
+	want, err := phi.Apply(im)
+	if err != nil {
+		return err
+	}
+	got, err := psi.Apply(im)
+	if err != nil {
+		return fmt.Errorf("folded: %v", err)
+	}
+	if !got.Size().Eq(want.Size()) || got.Channels != want.Channels {
+		return fmt.Errorf("output size: expect %v x %d, found %v x %d",
+			want.Size(), want.Channels, got.Size(), got.Channels)
+	}
+	var maxVal, maxDiff float64
+	for i := 0; i < want.Width; i++ {
+		for j := 0; j < want.Height; j++ {
+			for k := 0; k < want.Channels; k++ {
+				x, y := want.At(i, j, k), got.At(i, j, k)
+				maxVal = math.Max(maxVal, math.Abs(x))
+				maxDiff = math.Max(maxDiff, math.Abs(x-y))
+			}
+		}
+	}
+	if maxDiff > tol*maxVal {
+		return fmt.Errorf("outputs differ: max abs diff %g, max abs value %g", maxDiff, maxVal)
+	}
+	return nil
+}
+
+// randomImage returns an opaque image with random colors.
+func randomImage(size image.Point) image.Image {
+	im := image.NewRGBA(image.Rectangle{Max: size})
+	for i := range im.Pix {
+		if i%4 == 3 {
+			im.Pix[i] = 255
+			continue
+		}
+		im.Pix[i] = uint8(rand.Intn(256))
+	}
+	return im
+}
+
+// fuseOnePower merges the first POWER layer which can be merged.
+// Returns false if there was none.
+func fuseOnePower(net *NetParameter) (bool, error) {
+	for i, layer := range net.Layers {
+		if layer.GetType() != LayerParameter_POWER || layer.GetPowerParam().GetPower() != 1 {
+			continue
+		}
+		if err := errIfNotOneInput(layer); err != nil {
+			return false, fmt.Errorf("layer %s: %v", layer.GetName(), err)
+		}
+		var (
+			param = layer.GetPowerParam()
+			scale = float64(param.GetScale())
+			shift = float64(param.GetShift())
+		)
+		if isInPlace(layer) {
+			j := producer(net, i)
+			if j < 0 || !isLinear(net.Layers[j], false) {
+				continue
+			}
+			if err := scaleOutput(net.Layers[j], scale, shift); err != nil {
+				return false, fmt.Errorf("layer %s: %v", net.Layers[j].GetName(), err)
+			}
+		} else {
+			users := consumers(net, layer.Top[0])
+			if len(users) != 1 {
+				continue
+			}
+			j := users[0]
+			if !isLinear(net.Layers[j], shift != 0) || modifiedBetween(net, layer.Bottom[0], i, j) {
+				continue
+			}
+			if err := scaleInput(net.Layers[j], scale, shift); err != nil {
+				return false, fmt.Errorf("layer %s: %v", net.Layers[j].GetName(), err)
+			}
+			net.Layers[j].Bottom[0] = layer.Bottom[0]
+		}
+		net.Layers = append(net.Layers[:i], net.Layers[i+1:]...)
+		return true, nil
+	}
+	return false, nil
+}
+
+// consumers returns the indices of the layers which take a blob as input.
+func consumers(net *NetParameter, blob string) []int {
+	var users []int
+	for i, layer := range net.Layers {
+		if contains(layer.Bottom, blob) {
+			users = append(users, i)
+		}
+	}
+	return users
+}
+
+// producer returns the index of the layer which produces the input
+// of the in-place layer i, if layer i is the first to read it.
+// Otherwise returns -1.
+func producer(net *NetParameter, i int) int {
+	blob := net.Layers[i].Bottom[0]
+	for j := i - 1; j >= 0; j-- {
+		layer := net.Layers[j]
+		if contains(layer.Bottom, blob) {
+			return -1
+		}
+		if contains(layer.Top, blob) {
+			return j
+		}
+	}
+	return -1
+}
+
+// modifiedBetween reports whether an in-place layer
+// between layers i and j modifies a blob.
+func modifiedBetween(net *NetParameter, blob string, i, j int) bool {
+	for _, layer := range net.Layers[i+1 : j] {
+		if contains(layer.Top, blob) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLinear reports whether a layer is a convolution or inner product with blobs.
+// If the input will be shifted, convolutions must not be padded.
+func isLinear(layer *LayerParameter, shiftInput bool) bool {
+	if len(layer.Blobs) == 0 {
+		return false
+	}
+	switch layer.GetType() {
+	case LayerParameter_CONVOLUTION:
+		return !shiftInput || layer.GetConvolutionParam().Padding() == (image.Point{})
+	case LayerParameter_INNER_PRODUCT:
+		return true
+	default:
+		return false
+	}
+}
+
+// linearBlobs returns the weights and bias of a convolution or inner product,
+// adding a bias if it has none.
+func linearBlobs(layer *LayerParameter) (weights, bias *BlobProto, err error) {
+	var out int
+	switch layer.GetType() {
+	case LayerParameter_CONVOLUTION:
+		param := layer.GetConvolutionParam()
+		out = int(param.GetNumOutput())
+		if len(layer.Blobs) == 1 {
+			param.BiasTerm = proto.Bool(true)
+		}
+	case LayerParameter_INNER_PRODUCT:
+		param := layer.GetInnerProductParam()
+		out = int(param.GetNumOutput())
+		if len(layer.Blobs) == 1 {
+			param.BiasTerm = proto.Bool(true)
+		}
+	}
+	if len(layer.Blobs) == 1 {
+		layer.Blobs = append(layer.Blobs, &BlobProto{
+			Num:      proto.Int32(1),
+			Channels: proto.Int32(1),
+			Height:   proto.Int32(1),
+			Width:    proto.Int32(int32(out)),
+			Data:     make([]float32, out),
+		})
+	}
+	if len(layer.Blobs) != 2 {
+		return nil, nil, fmt.Errorf("number of blobs is not 2: %d", len(layer.Blobs))
+	}
+	weights, bias = layer.Blobs[0], layer.Blobs[1]
+	if len(bias.Data) != out || out == 0 || len(weights.Data)%out != 0 {
+		return nil, nil, fmt.Errorf("blobs do not match %d outputs", out)
+	}
+	return weights, bias, nil
+}
+
+// scaleOutput replaces the output y of a layer with scale*y + shift.
+func scaleOutput(layer *LayerParameter, scale, shift float64) error {
+	weights, bias, err := linearBlobs(layer)
+	if err != nil {
+		return err
+	}
+	for i, w := range weights.Data {
+		weights.Data[i] = float32(scale * float64(w))
+	}
+	for i, b := range bias.Data {
+		bias.Data[i] = float32(scale*float64(b) + shift)
+	}
+	return nil
+}
+
+// scaleInput replaces the input x of a layer with scale*x + shift.
+func scaleInput(layer *LayerParameter, scale, shift float64) error {
+	weights, bias, err := linearBlobs(layer)
+	if err != nil {
+		return err
+	}
+	n := len(weights.Data) / len(bias.Data)
+	for o := range bias.Data {
+		var sum float64
+		for i := o * n; i < (o+1)*n; i++ {
+			sum += float64(weights.Data[i])
+			weights.Data[i] = float32(scale * float64(weights.Data[i]))
+		}
+		bias.Data[o] = float32(float64(bias.Data[o]) + shift*sum)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package caffe
+
+import (
+	"image"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+const foldTestNet = `
+name: "FoldNet"
+input: "data"
+input_dim: 1 input_dim: 3 input_dim: 14 input_dim: 14
+layers { name: "conv1" type: CONVOLUTION bottom: "data" top: "conv1"
+  convolution_param { num_output: 4 kernel_size: 3 } }
+layers { name: "scale1" type: POWER bottom: "conv1" top: "conv1"
+  power_param { scale: 0.5 shift: 0.2 } }
+layers { name: "relu1" type: RELU bottom: "conv1" top: "conv1" }
+layers { name: "pool1" type: POOLING bottom: "conv1" top: "pool1"
+  pooling_param { pool: MAX kernel_size: 2 stride: 2 } }
+layers { name: "scale2" type: POWER bottom: "pool1" top: "scale2"
+  power_param { scale: 2 shift: -1 } }
+layers { name: "conv2" type: CONVOLUTION bottom: "scale2" top: "conv2"
+  convolution_param { num_output: 3 kernel_size: 2 } }
+layers { name: "relu2" type: RELU bottom: "conv2" top: "conv2" }
+layers { name: "scale3" type: POWER bottom: "conv2" top: "conv2"
+  power_param { scale: 3 } }
+layers { name: "scale4" type: POWER bottom: "conv2" top: "scale4"
+  power_param { scale: 0.5 shift: 1 } }
+layers { name: "conv3" type: CONVOLUTION bottom: "scale4" top: "conv3"
+  convolution_param { num_output: 2 kernel_size: 3 pad: 1 } }
+`
+
+// Folded networks take RGB images in [0, 1] and give the same output.
+func TestFoldPreprocess(t *testing.T) {
+	net := new(NetParameter)
+	if err := proto.UnmarshalText(foldTestNet, net); err != nil {
+		t.Fatal(err)
+	}
+	randomWeights(t, net)
+	mean := []float64{120, 110, 100}
+	folded, err := FoldPreprocess(net, mean)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folded.Layers) != len(net.Layers) {
+		t.Errorf("got %d layers, want %d", len(folded.Layers), len(net.Layers))
+	}
+	im := randomImage(image.Pt(14, 14))
+	for _, output := range []string{"conv1", "conv2"} {
+		if err := VerifyFolded(net, folded, output, mean, im, 1e-5); err != nil {
+			t.Errorf("output %s: %v", output, err)
+		}
+	}
+	// Without an image, one of the input size is used.
+	if err := VerifyFolded(net, folded, "conv2", mean, nil, 1e-5); err != nil {
+		t.Errorf("random image: %v", err)
+	}
+
+	errCases := map[string]func(*NetParameter){
+		"padded": func(net *NetParameter) {
+			layerByName(net, "conv1").ConvolutionParam.Pad = proto.Uint32(1)
+		},
+		"grouped": func(net *NetParameter) {
+			layerByName(net, "conv1").ConvolutionParam.Group = proto.Uint32(2)
+		},
+		"no bias": func(net *NetParameter) {
+			layer := layerByName(net, "conv1")
+			layer.Blobs = layer.Blobs[:1]
+		},
+	}
+	for name, modify := range errCases {
+		bad := proto.Clone(net).(*NetParameter)
+		modify(bad)
+		if _, err := FoldPreprocess(bad, mean); err == nil {
+			t.Errorf("%s: expect error", name)
+		}
+	}
+	if _, err := FoldPreprocess(net, mean[:2]); err == nil {
+		t.Error("short mean: expect error")
+	}
+}
+
+// POWER layers are merged where possible without changing the output.
+func TestFusePower(t *testing.T) {
+	net := new(NetParameter)
+	if err := proto.UnmarshalText(foldTestNet, net); err != nil {
+		t.Fatal(err)
+	}
+	randomWeights(t, net)
+	fused, err := FusePower(net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// scale1 is merged into the output of conv1 and scale2 into the input of conv2.
+	// scale3 follows relu2 and the input of the padded conv3 cannot be shifted.
+	var kept []string
+	for _, layer := range fused.Layers {
+		if layer.GetType() == LayerParameter_POWER {
+			kept = append(kept, layer.GetName())
+		}
+	}
+	if len(kept) != 2 || kept[0] != "scale3" || kept[1] != "scale4" {
+		t.Errorf("got POWER layers %v, want [scale3 scale4]", kept)
+	}
+	if bottom := layerByName(fused, "conv2").Bottom[0]; bottom != "pool1" {
+		t.Errorf("conv2: got input %s, want pool1", bottom)
+	}
+
+	// The native transform does not support padding.
+	mean := []float64{120, 110, 100}
+	im := randomImage(image.Pt(14, 14))
+	for _, output := range []string{"conv1", "conv2"} {
+		phi, err := FromProto(net, output, mean)
+		if err != nil {
+			t.Fatal(err)
+		}
+		psi, err := FromProto(fused, output, mean)
+		if err != nil {
+			t.Fatalf("fused output %s: %v", output, err)
+		}
+		want, err := phi.Apply(im)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := psi.Apply(im)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !closeMulti(want, got, 1e-4) {
+			t.Errorf("output %s differs after fusing", output)
+		}
+	}
+}
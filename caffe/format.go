@@ -0,0 +1,143 @@
+package caffe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+// Format is an encoding of a protocol buffer message on disk.
+type Format int
+
+const (
+	// Protocol buffer text format, as in a prototxt.
+	TextFormat Format = iota
+	// JSON with fields in the order of the generated structs.
+	JSONFormat
+	// Protocol buffer binary format, as in a caffemodel.
+	BinaryFormat
+)
+
+var formatNames = []string{"text", "json", "binary"}
+
+func (f Format) String() string {
+	if f < 0 || int(f) >= len(formatNames) {
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+	return formatNames[f]
+}
+
+// ParseFormat parses "text", "json" or "binary".
+func ParseFormat(s string) (Format, error) {
+	for i, name := range formatNames {
+		if s == name {
+			return Format(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown format: %s", s)
+}
+
+// FormatOf guesses the format of a file from its extension.
+func FormatOf(fname string) (Format, error) {
+	switch ext := strings.ToLower(path.Ext(fname)); ext {
+	case ".prototxt", ".txt", ".pbtxt":
+		return TextFormat, nil
+	case ".json":
+		return JSONFormat, nil
+	case ".caffemodel", ".binaryproto", ".pb", ".bin", ".solverstate":
+		return BinaryFormat, nil
+	default:
+		return 0, fmt.Errorf("unknown extension: %q", ext)
+	}
+}
+
+// Unmarshal decodes a message in the given format.
+func Unmarshal(data []byte, format Format, msg proto.Message) error {
+	switch format {
+	case TextFormat:
+		return proto.UnmarshalText(string(data), msg)
+	case JSONFormat:
+		return json.Unmarshal(data, msg)
+	case BinaryFormat:
+		return proto.Unmarshal(data, msg)
+	default:
+		return fmt.Errorf("unknown format: %v", format)
+	}
+}
+
+// Marshal encodes a message in the given format.
+// The text format orders fields by number and
+// the JSON format orders fields as in the generated struct,
+// so that the output is stable for a given message.
+func Marshal(w io.Writer, msg proto.Message, format Format) error {
+	switch format {
+	case TextFormat:
+		return proto.MarshalText(w, msg)
+	case JSONFormat:
+		data, err := json.MarshalIndent(msg, "", "\t")
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		_, err = w.Write(data)
+		return err
+	case BinaryFormat:
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return fmt.Errorf("unknown format: %v", format)
+	}
+}
+
+// LoadMessage reads a message from a file
+// whose format is determined by its extension.
+func LoadMessage(fname string, msg proto.Message) error {
+	format, err := FormatOf(fname)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(data, format, msg)
+}
+
+// SaveMessage writes a message to a file
+// whose format is determined by its extension.
+func SaveMessage(fname string, msg proto.Message) error {
+	format, err := FormatOf(fname)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := Marshal(&buf, msg, format); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fname, buf.Bytes(), 0644)
+}
+
+// Convert decodes a message from one format and encodes it in another.
+func Convert(w io.Writer, r io.Reader, msg proto.Message, from, to Format) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err := Unmarshal(data, from, msg); err != nil {
+		return fmt.Errorf("decode %v: %v", from, err)
+	}
+	if err := Marshal(w, msg, to); err != nil {
+		return fmt.Errorf("encode %v: %v", to, err)
+	}
+	return nil
+}
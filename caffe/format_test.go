@@ -0,0 +1,141 @@
+package caffe
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+var update = flag.Bool("update", false, "Update golden files")
+
+var formatCases = []struct {
+	Name string
+	New  func() proto.Message
+}{
+	{"net", func() proto.Message { return new(NetParameter) }},
+	{"solver", func() proto.Message { return new(SolverParameter) }},
+}
+
+func loadText(t *testing.T, fname string, msg proto.Message) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Unmarshal(data, TextFormat, msg); err != nil {
+		t.Fatalf("decode %s: %v", fname, err)
+	}
+}
+
+// The JSON encoding of each prototxt must match its golden file.
+func TestMarshal_json(t *testing.T) {
+	for _, c := range formatCases {
+		msg := c.New()
+		loadText(t, path.Join("testdata", "format", c.Name+".prototxt"), msg)
+		var buf bytes.Buffer
+		if err := Marshal(&buf, msg, JSONFormat); err != nil {
+			t.Fatal(err)
+		}
+		golden := path.Join("testdata", "format", c.Name+".json")
+		if *update {
+			if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want, buf.Bytes()) {
+			t.Errorf("%s: JSON differs from %s:\n%s", c.Name, golden, buf.String())
+		}
+	}
+}
+
+// Every pair of formats must round-trip without loss.
+func TestConvert_roundTrip(t *testing.T) {
+	formats := []Format{TextFormat, JSONFormat, BinaryFormat}
+	for _, c := range formatCases {
+		orig := c.New()
+		loadText(t, path.Join("testdata", "format", c.Name+".prototxt"), orig)
+		for _, from := range formats {
+			for _, to := range formats {
+				var src bytes.Buffer
+				if err := Marshal(&src, orig, from); err != nil {
+					t.Fatal(err)
+				}
+				var dst bytes.Buffer
+				if err := Convert(&dst, &src, c.New(), from, to); err != nil {
+					t.Fatalf("%s: %v to %v: %v", c.Name, from, to, err)
+				}
+				got := c.New()
+				if err := Unmarshal(dst.Bytes(), to, got); err != nil {
+					t.Fatalf("%s: %v to %v: %v", c.Name, from, to, err)
+				}
+				if !proto.Equal(orig, got) {
+					t.Errorf("%s: %v to %v: want %v, got %v", c.Name, from, to, orig, got)
+				}
+			}
+		}
+	}
+}
+
+// Fields which are explicitly set to their default value
+// must remain set and enums must keep their value.
+func TestConvert_defaultsAndEnums(t *testing.T) {
+	net := new(NetParameter)
+	data, err := ioutil.ReadFile(path.Join("testdata", "format", "net.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Unmarshal(data, JSONFormat, net); err != nil {
+		t.Fatal(err)
+	}
+	conv := layerByName(net, "conv1").GetConvolutionParam()
+	if conv.Group == nil || conv.Pad == nil || conv.BiasTerm == nil {
+		t.Errorf("explicit defaults not preserved: %v", conv)
+	}
+	conv2 := layerByName(net, "conv2").GetConvolutionParam()
+	if conv2.Stride != nil || conv2.Pad != nil {
+		t.Errorf("unset fields became set: %v", conv2)
+	}
+	if conv2.GetEngine() != ConvolutionParameter_CAFFE {
+		t.Errorf("engine: want %v, got %v", ConvolutionParameter_CAFFE, conv2.GetEngine())
+	}
+	pool := layerByName(net, "pool1")
+	if pool.GetType() != LayerParameter_POOLING {
+		t.Errorf("type: want %v, got %v", LayerParameter_POOLING, pool.GetType())
+	}
+	if pool.GetPoolingParam().Pool == nil {
+		t.Errorf("explicit pool method not preserved")
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	cases := []struct {
+		Name string
+		Want Format
+	}{
+		{"deploy.prototxt", TextFormat},
+		{"arch.json", JSONFormat},
+		{"bvlc_reference_caffenet.caffemodel", BinaryFormat},
+		{"mean.binaryproto", BinaryFormat},
+	}
+	for _, c := range cases {
+		got, err := FormatOf(c.Name)
+		if err != nil {
+			t.Errorf("%s: %v", c.Name, err)
+			continue
+		}
+		if got != c.Want {
+			t.Errorf("%s: want %v, got %v", c.Name, c.Want, got)
+		}
+	}
+	if _, err := FormatOf("image.png"); err == nil {
+		t.Errorf("expect error for unknown extension")
+	}
+}
@@ -0,0 +1,312 @@
+package caffe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// Golden regression cases are stored in testdata/golden/[name]:
+//
+//	net.prototxt        architecture without weights
+//	weights.caffemodel  random weights
+//	input.png           random image
+//	golden.json         expected geometry and subsets
+//	[layer].multi       expected output of each layer
+//
+// Run with -update to regenerate them.
+// Outputs are computed with Caffe if it can be imported from python,
+// otherwise with FromProto, which only protects against regressions.
+// The source is recorded in golden.json.
+var goldenCases = []struct {
+	Name  string
+	Net   string
+	Size  image.Point
+	Mean  []float64
+	Seed  int64
+	Layer string
+}{
+	{"lrn-group", `
+name: "LRNGroup"
+input: "data"
+input_dim: 1 input_dim: 3 input_dim: 21 input_dim: 21
+layers { name: "conv1" type: CONVOLUTION bottom: "data" top: "conv1"
+  convolution_param { num_output: 4 kernel_size: 3 stride: 2 } }
+layers { name: "relu1" type: RELU bottom: "conv1" top: "conv1" }
+layers { name: "pool1" type: POOLING bottom: "conv1" top: "pool1"
+  pooling_param { pool: MAX kernel_size: 2 stride: 2 } }
+layers { name: "norm1" type: LRN bottom: "pool1" top: "norm1"
+  lrn_param { local_size: 3 alpha: 0.1 beta: 0.75 } }
+layers { name: "conv2" type: CONVOLUTION bottom: "norm1" top: "conv2"
+  convolution_param { num_output: 6 kernel_size: 2 group: 2 } }
+layers { name: "relu2" type: RELU bottom: "conv2" top: "conv2" }
+layers { name: "scale2" type: POWER bottom: "conv2" top: "conv2"
+  power_param { scale: 0.5 shift: -0.1 } }
+`, image.Pt(21, 21), []float64{120, 110, 100}, 1, "conv2"},
+	{"no-bias", `
+name: "NoBias"
+input: "data"
+input_dim: 1 input_dim: 3 input_dim: 19 input_dim: 23
+layers { name: "conv1" type: CONVOLUTION bottom: "data" top: "conv1"
+  convolution_param { num_output: 5 kernel_size: 5 bias_term: false } }
+layers { name: "pool1" type: POOLING bottom: "conv1" top: "pool1"
+  pooling_param { pool: MAX kernel_size: 3 stride: 2 } }
+layers { name: "relu1" type: RELU bottom: "pool1" top: "pool1" }
+layers { name: "conv2" type: CONVOLUTION bottom: "pool1" top: "conv2"
+  convolution_param { num_output: 3 kernel_size: 1 } }
+`, image.Pt(23, 19), []float64{104, 117, 123}, 2, "conv2"},
+}
+
+// goldenManifest describes the expected results of a golden case.
+type goldenManifest struct {
+	// Either "caffe" or "native".
+	Source string
+	Mean   []float64
+	Layers []goldenLayer
+}
+
+type goldenLayer struct {
+	Name   string
+	Rate   int
+	Field  image.Point
+	Subset []string
+}
+
+func TestGolden(t *testing.T) {
+	for _, c := range goldenCases {
+		dir := path.Join("testdata", "golden", c.Name)
+		if *update {
+			net := new(NetParameter)
+			if err := proto.UnmarshalText(c.Net, net); err != nil {
+				t.Fatal(err)
+			}
+			rand.Seed(c.Seed)
+			randomWeights(t, net)
+			if err := writeGolden(dir, net, randomImage(c.Size), c.Mean, c.Layer); err != nil {
+				t.Fatalf("%s: %v", c.Name, err)
+			}
+		}
+		checkGolden(t, dir)
+	}
+}
+
+func checkGolden(t *testing.T, dir string) {
+	var m goldenManifest
+	data, err := ioutil.ReadFile(path.Join(dir, "golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("%s: decode manifest: %v", dir, err)
+	}
+
+	// Decode the network in every format.
+	net := new(NetParameter)
+	if err := LoadMessage(path.Join(dir, "net.prototxt"), net); err != nil {
+		t.Fatalf("%s: %v", dir, err)
+	}
+	for _, format := range []Format{JSONFormat, BinaryFormat} {
+		var buf bytes.Buffer
+		if err := Marshal(&buf, net, format); err != nil {
+			t.Fatal(err)
+		}
+		other := new(NetParameter)
+		if err := Unmarshal(buf.Bytes(), format, other); err != nil {
+			t.Fatalf("%s: decode %v: %v", dir, format, err)
+		}
+		if !proto.Equal(net, other) {
+			t.Errorf("%s: network changed by %v encoding", dir, format)
+		}
+	}
+	weights, err := LoadWeights(path.Join(dir, "weights.caffemodel"))
+	if err != nil {
+		t.Fatalf("%s: %v", dir, err)
+	}
+	arch := proto.Clone(net).(*NetParameter)
+	report, err := CopyWeights(net, weights, CopyOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("%s: %v", dir, err)
+	}
+	if !report.OK() {
+		t.Fatalf("%s: copy weights:\n%v", dir, report)
+	}
+	file, err := os.Open(path.Join(dir, "input.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := png.Decode(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Caffe computes in single precision.
+	const eps = 1e-4
+	for _, l := range m.Layers {
+		if got := layerNames(SubsetForOutput(arch, l.Name)); !reflect.DeepEqual(got, l.Subset) {
+			t.Errorf("%s: layer %s: subset: want %v, got %v", dir, l.Name, l.Subset, got)
+		}
+		if got := LayerRate(arch, l.Name); got != l.Rate {
+			t.Errorf("%s: layer %s: rate: want %d, got %d", dir, l.Name, l.Rate, got)
+		}
+		if got := LayerField(arch, l.Name); !got.Eq(l.Field) {
+			t.Errorf("%s: layer %s: field: want %v, got %v", dir, l.Name, l.Field, got)
+		}
+		want, err := loadMulti(path.Join(dir, l.Name+".multi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		phi, err := FromProto(net, l.Name, m.Mean)
+		if err != nil {
+			t.Errorf("%s: layer %s: %v", dir, l.Name, err)
+			continue
+		}
+		got, err := phi.Apply(im)
+		if err != nil {
+			t.Errorf("%s: layer %s: %v", dir, l.Name, err)
+			continue
+		}
+		if d := Compare(want, got, eps, eps); d.Diverged() {
+			t.Errorf("%s: layer %s: output differs from %s golden: %v", dir, l.Name, m.Source, d)
+		}
+	}
+}
+
+// writeGolden saves a network with weights, an image
+// and the outputs of every layer up to output.
+func writeGolden(dir string, net *NetParameter, im image.Image, mean []float64, output string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	arch := proto.Clone(net).(*NetParameter)
+	for _, layer := range arch.Layers {
+		layer.Blobs = nil
+	}
+	if err := SaveMessage(path.Join(dir, "net.prototxt"), arch); err != nil {
+		return err
+	}
+	weightsFile := path.Join(dir, "weights.caffemodel")
+	if err := SaveWeights(weightsFile, net); err != nil {
+		return err
+	}
+	err := save(path.Join(dir, "input.png"), func(w io.Writer) error { return png.Encode(w, im) })
+	if err != nil {
+		return err
+	}
+
+	chain, err := LayerChain(net, output)
+	if err != nil {
+		return err
+	}
+	m := goldenManifest{Source: "native", Mean: mean}
+	apply := func(layer string) (*rimg64.Multi, error) {
+		phi, err := FromProto(net, layer, mean)
+		if err != nil {
+			return nil, err
+		}
+		return phi.Apply(im)
+	}
+	if haveCaffe() {
+		m.Source = "caffe"
+		tmp, err := ioutil.TempDir("", "golden-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		meanFile := path.Join(tmp, "mean.npy")
+		if err := save(meanFile, func(w io.Writer) error { return writeMeanNpy(w, mean) }); err != nil {
+			return err
+		}
+		apply = func(layer string) (*rimg64.Multi, error) {
+			subset := SubsetForOutput(arch, layer)
+			fs, err := Extract("extract.py", []image.Image{im}, layer, subset, weightsFile, meanFile)
+			if err != nil {
+				return nil, err
+			}
+			return fs[0], nil
+		}
+	}
+	for _, name := range chain {
+		f, err := apply(name)
+		if err != nil {
+			return fmt.Errorf("layer %s: %v", name, err)
+		}
+		data, err := proto.Marshal(multiToProto(f))
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path.Join(dir, name+".multi"), data, 0644); err != nil {
+			return err
+		}
+		m.Layers = append(m.Layers, goldenLayer{
+			Name:   name,
+			Rate:   LayerRate(arch, name),
+			Field:  LayerField(arch, name),
+			Subset: layerNames(SubsetForOutput(arch, name)),
+		})
+	}
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(dir, "golden.json"), append(data, '\n'), 0644)
+}
+
+// haveCaffe reports whether Caffe can be imported from python.
+func haveCaffe() bool {
+	return exec.Command("python", "-c", "import caffe").Run() == nil
+}
+
+// writeMeanNpy writes the mean pixel as a 3 x 1 x 1 numpy array in BGR order,
+// which is the layout that extract.py expects.
+func writeMeanNpy(w io.Writer, mean []float64) error {
+	header := "{'descr': '<f8', 'fortran_order': False, 'shape': (3, 1, 1), }"
+	// Pad the header so that the data is aligned to 16 bytes.
+	for (10+len(header)+1)%16 != 0 {
+		header += " "
+	}
+	header += "\n"
+	var buf bytes.Buffer
+	buf.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(&buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	for i := 2; i >= 0; i-- {
+		binary.Write(&buf, binary.LittleEndian, mean[i])
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func loadMulti(fname string) (*rimg64.Multi, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	msg := new(Multi)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("decode %s: %v", fname, err)
+	}
+	return multiFromProto(msg), nil
+}
+
+func layerNames(net *NetParameter) []string {
+	var names []string
+	for _, layer := range net.Layers {
+		names = append(names, layer.GetName())
+	}
+	return names
+}
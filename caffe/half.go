@@ -0,0 +1,114 @@
+package caffe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// toHalf quantizes the blobs of a network to half precision.
+func toHalf(net *NetParameter) *HalfNetParameter {
+	h := &HalfNetParameter{Net: StripNet(net)}
+	for _, layer := range h.Net.Layers {
+		for _, blob := range layer.Blobs {
+			data := make([]byte, 2*len(blob.Data))
+			for i, x := range blob.Data {
+				binary.LittleEndian.PutUint16(data[2*i:], float32ToHalf(x))
+			}
+			h.Data = append(h.Data, data)
+			blob.Data = nil
+		}
+	}
+	return h
+}
+
+// fromHalf restores the blobs of a network from half precision.
+func fromHalf(h *HalfNetParameter) (*NetParameter, error) {
+	net := h.GetNet()
+	if net == nil {
+		return nil, fmt.Errorf("no network")
+	}
+	var i int
+	for _, layer := range net.Layers {
+		for _, blob := range layer.Blobs {
+			if i >= len(h.Data) {
+				return nil, fmt.Errorf("layer %s: missing blob data", layer.GetName())
+			}
+			data := h.Data[i]
+			if len(data)%2 != 0 {
+				return nil, fmt.Errorf("layer %s: odd number of bytes: %d", layer.GetName(), len(data))
+			}
+			blob.Data = make([]float32, len(data)/2)
+			for j := range blob.Data {
+				blob.Data[j] = halfToFloat32(binary.LittleEndian.Uint16(data[2*j:]))
+			}
+			i++
+		}
+	}
+	if i != len(h.Data) {
+		return nil, fmt.Errorf("data for %d blobs, found %d blobs", len(h.Data), i)
+	}
+	return net, nil
+}
+
+// float32ToHalf converts to IEEE 754 half precision,
+// rounding to nearest even.
+func float32ToHalf(x float32) uint16 {
+	var (
+		bits = math.Float32bits(x)
+		sign = uint16(bits>>16) & 0x8000
+		exp  = int(bits>>23) & 0xff
+		mant = bits & 0x7fffff
+	)
+	if exp == 0xff {
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	}
+	e := exp - 127 + 15
+	if e >= 0x1f {
+		return sign | 0x7c00
+	}
+	if e <= 0 {
+		// Subnormal or zero.
+		if e < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - e)
+		h := uint16(mant >> shift)
+		rem, half := mant&(1<<shift-1), uint32(1)<<(shift-1)
+		if rem > half || (rem == half && h&1 == 1) {
+			h++
+		}
+		return sign | h
+	}
+	h := uint16(e)<<10 | uint16(mant>>13)
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && h&1 == 1) {
+		// May carry into the exponent, giving infinity.
+		h++
+	}
+	return sign | h
+}
+
+func halfToFloat32(h uint16) float32 {
+	var (
+		sign = uint32(h&0x8000) << 16
+		exp  = uint32(h>>10) & 0x1f
+		mant = uint32(h & 0x3ff)
+	)
+	switch exp {
+	case 0:
+		x := float32(math.Ldexp(float64(mant), -24))
+		if sign != 0 {
+			x = -x
+		}
+		return x
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	default:
+		return math.Float32frombits(sign | (exp-15+127)<<23 | mant<<13)
+	}
+}
@@ -0,0 +1,48 @@
+// Code generated by protoc-gen-go.
+// source: half.proto
+// DO NOT EDIT!
+
+/*
+Package caffe is a generated protocol buffer package.
+
+It is generated from these files:
+	half.proto
+
+It has these top-level messages:
+	HalfNetParameter
+*/
+package caffe
+
+import proto "code.google.com/p/goprotobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+type HalfNetParameter struct {
+	Net              *NetParameter `protobuf:"bytes,1,opt,name=net" json:"net,omitempty"`
+	Data             [][]byte      `protobuf:"bytes,2,rep,name=data" json:"data,omitempty"`
+	XXX_unrecognized []byte        `json:"-"`
+}
+
+func (m *HalfNetParameter) Reset()         { *m = HalfNetParameter{} }
+func (m *HalfNetParameter) String() string { return proto.CompactTextString(m) }
+func (*HalfNetParameter) ProtoMessage()    {}
+
+func (m *HalfNetParameter) GetNet() *NetParameter {
+	if m != nil {
+		return m.Net
+	}
+	return nil
+}
+
+func (m *HalfNetParameter) GetData() [][]byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func init() {
+}
@@ -0,0 +1,107 @@
+package caffe
+
+import (
+	"bytes"
+	"math"
+	"path"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+// The encoding of HalfNetParameter must follow half.proto.
+func TestHalfNetParameter_wire(t *testing.T) {
+	h := &HalfNetParameter{
+		Net:  &NetParameter{Name: proto.String("n")},
+		Data: [][]byte{{1, 2}, {}},
+	}
+	got, err := proto.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		// Field 1, length-delimited: NetParameter with name "n".
+		0x0a, 3, 0x0a, 1, 'n',
+		// Field 2, length-delimited, repeated.
+		0x12, 2, 1, 2,
+		0x12, 0,
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("want % x, got % x", want, got)
+	}
+}
+
+func TestFloat32ToHalf(t *testing.T) {
+	cases := []struct {
+		In   float32
+		Want uint16
+	}{
+		{0, 0x0000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{65504, 0x7bff},
+		{65520, 0x7c00},
+		{float32(math.Ldexp(1, -24)), 0x0001},
+		{float32(math.Ldexp(1, -26)), 0x0000},
+		// Halfway between 1 and the next half, rounds to even.
+		{1 + float32(math.Ldexp(1, -11)), 0x3c00},
+		{1 + 3*float32(math.Ldexp(1, -11)), 0x3c02},
+		{float32(math.Inf(1)), 0x7c00},
+	}
+	for _, c := range cases {
+		if got := float32ToHalf(c.In); got != c.Want {
+			t.Errorf("%g: want %#04x, got %#04x", c.In, c.Want, got)
+		}
+	}
+}
+
+// Weights saved in half precision are read back to within the precision
+// and can be copied into the architecture.
+// The phase rules of layers are kept.
+func TestSaveWeights_half(t *testing.T) {
+	net := new(NetParameter)
+	if err := proto.UnmarshalText(weightsTestNet, net); err != nil {
+		t.Fatal(err)
+	}
+	randomWeights(t, net)
+	conv1 := layerByName(net, "conv1")
+	conv1.Include = []*NetStateRule{{Phase: Phase_TEST.Enum()}}
+	conv1.Blobs[0].Diff = make([]float32, len(conv1.Blobs[0].Data))
+
+	fname := path.Join(t.TempDir(), "net"+HalfWeightsExt)
+	if err := SaveWeights(fname, net); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadWeights(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := layerByName(got, "conv1")
+	if len(layer.Include) != 1 || layer.Include[0].GetPhase() != Phase_TEST {
+		t.Errorf("phase rule not kept: %v", layer.Include)
+	}
+	if len(layer.Blobs[0].Diff) != 0 {
+		t.Error("diff not removed")
+	}
+	for i, want := range net.Layers {
+		for j, blob := range want.Blobs {
+			data := got.Layers[i].Blobs[j].Data
+			if len(data) != len(blob.Data) {
+				t.Fatalf("layer %s blob %d: want %d elements, got %d", want.GetName(), j, len(blob.Data), len(data))
+			}
+			for k, x := range blob.Data {
+				if d := math.Abs(float64(data[k] - x)); d > 1e-3*math.Max(1, math.Abs(float64(x))) {
+					t.Errorf("layer %s blob %d: want %g, got %g", want.GetName(), j, x, data[k])
+				}
+			}
+		}
+	}
+
+	arch := new(NetParameter)
+	if err := proto.UnmarshalText(weightsTestNet, arch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CopyWeights(arch, got, CopyOptions{Strict: true}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,35 @@
+package caffe
+
+import (
+	"math/rand"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+// randomWeights gives every layer blobs of the expected shape.
+func randomWeights(t *testing.T, net *NetParameter) {
+	in, err := InputShape(net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shapes, err := InferShapes(net, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, layer := range net.Layers {
+		for _, d := range expectBlobDims(layer, shapes[layer.Bottom[0]], true) {
+			blob := &BlobProto{
+				Num:      proto.Int32(int32(d.Out)),
+				Channels: proto.Int32(int32(d.In)),
+				Height:   proto.Int32(int32(d.Height)),
+				Width:    proto.Int32(int32(d.Width)),
+				Data:     make([]float32, d.NumElems()),
+			}
+			for i := range blob.Data {
+				blob.Data[i] = float32(rand.NormFloat64())
+			}
+			layer.Blobs = append(layer.Blobs, blob)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package caffe
 import (
 	"fmt"
 	"image"
+	"math"
 
+	"code.google.com/p/goprotobuf/proto"
 	"github.com/jvlmdr/go-cv/convfeat"
 	"github.com/jvlmdr/go-cv/featset"
 	"github.com/jvlmdr/go-cv/rimg64"
@@ -18,19 +20,23 @@ func FromProto(net *NetParameter, output string, mean []float64) (featset.Image,
 	if err != nil {
 		return nil, err
 	}
-	// Scale by 255 and subtract mean.
+	return &featset.ComposeImage{phi, preprocess(mean)}, nil
+}
+
+// preprocess converts an image to the input of a network:
+// it scales by 255, subtracts the mean and reorders the channels to BGR.
+func preprocess(mean []float64) featset.Image {
 	scale := new(convfeat.Scale)
 	*scale = 255
 	subMean := new(convfeat.AddConst)
 	*subMean = neg(mean)
 	reorder := &featset.SelectChannels{Channels: []int{2, 1, 0}}
-	preproc := &featset.ComposeImage{
+	return &featset.ComposeImage{
 		Outer: &featset.Compose{
 			Outer: reorder,
 			Inner: &featset.Compose{Outer: subMean, Inner: scale}},
 		Inner: new(featset.RGB),
 	}
-	return &featset.ComposeImage{phi, preproc}, nil
 }
 
 func fromProto(net *NetParameter, name string) (featset.Real, int, error) {
@@ -47,35 +53,63 @@ func fromProto(net *NetParameter, name string) (featset.Real, int, error) {
 	if err != nil {
 		return nil, 0, err
 	}
+	phi, out, err := layerStage(net, layer, in)
+	if err != nil {
+		return nil, 0, err
+	}
+	if phi == nil {
+		return below, out, nil
+	}
+	if below != nil {
+		phi = &featset.Compose{Outer: phi, Inner: below}
+	}
+	return phi, out, nil
+}
 
-	// Convert this layer into a real-valued transform.
+// layerStage converts a layer and the in-place layers which follow it
+// into a real feature transform.
+// It returns nil if the stage is the identity.
+func layerStage(net *NetParameter, layer *LayerParameter, in int) (featset.Real, int, error) {
+	name := layer.GetName()
 	var (
 		phi featset.Real
 		out int
+		err error
 	)
-	phi, out, err = layerToFunc(layer, in)
-	if err != nil {
-		return nil, 0, fmt.Errorf("layer %s: %v", name, err)
+	switch layer.GetType() {
+	case LayerParameter_DROPOUT, LayerParameter_FLATTEN:
+		// Dropout is the identity at test time.
+		// Flatten is the identity because inner product layers
+		// are computed as convolutions over their whole input.
+		out = in
+	case LayerParameter_INNER_PRODUCT:
+		phi, out, err = ipLayerToFunc(net, layer, in)
+	default:
+		phi, out, err = layerToFunc(layer, in)
 	}
-	// Check if this layer has an in-place operation.
-	loop, err := findLoop(net, name)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, fmt.Errorf("layer %s: %v", name, err)
 	}
-	if loop != "" {
+	// Apply any in-place operations in order.
+	for _, loop := range findLoops(net, name) {
+		l := layerByName(net, loop)
+		if l.GetType() == LayerParameter_DROPOUT {
+			continue
+		}
 		// Inputs to loop are outputs of layer.
 		// Number of outputs should map.
-		outer, loopOut, err := layerToFunc(layerByName(net, loop), out)
+		outer, loopOut, err := layerToFunc(l, out)
 		if err != nil {
 			return nil, 0, fmt.Errorf("layer %s: %v", loop, err)
 		}
 		if loopOut != out {
 			return nil, 0, fmt.Errorf("in-place layer changes dimension: from %d to %d", out, loopOut)
 		}
-		phi = &featset.Compose{Outer: outer, Inner: phi}
-	}
-	if below != nil {
-		phi = &featset.Compose{Outer: phi, Inner: below}
+		if phi == nil {
+			phi = outer
+		} else {
+			phi = &featset.Compose{Outer: outer, Inner: phi}
+		}
 	}
 	return phi, out, nil
 }
@@ -94,7 +128,9 @@ func errIfDimsNotEq(want, got BlobDims) error {
 	return nil
 }
 
-func findLoop(net *NetParameter, name string) (string, error) {
+// findLoops returns the names of all in-place layers which operate on a blob,
+// in the order that they appear in the network.
+func findLoops(net *NetParameter, name string) []string {
 	var subset []string
 	for _, l := range net.Layers {
 		if len(l.Top) != 1 {
@@ -107,13 +143,7 @@ func findLoop(net *NetParameter, name string) (string, error) {
 			subset = append(subset, l.GetName())
 		}
 	}
-	if len(subset) == 0 {
-		return "", nil
-	}
-	if len(subset) > 1 {
-		return "", fmt.Errorf("multiple loops for %s: %v", name, subset)
-	}
-	return subset[0], nil
+	return subset
 }
 
 func neg(x []float64) []float64 {
@@ -135,6 +165,10 @@ func layerToFunc(layer *LayerParameter, in int) (featset.Real, int, error) {
 		return poolLayerToFunc(layer, in)
 	case LayerParameter_RELU:
 		return reluLayerToFunc(layer, in)
+	case LayerParameter_POWER:
+		return powerLayerToFunc(layer, in)
+	case LayerParameter_SOFTMAX:
+		return new(softmax), in, nil
 	default:
 		return nil, 0, fmt.Errorf("unknown layer type: %s", t.String())
 	}
@@ -147,23 +181,30 @@ func convLayerToFunc(layer *LayerParameter, in int) (featset.Real, int, error) {
 	}
 	var (
 		out    = int(param.GetNumOutput())
-		size   = int(param.GetKernelSize())
-		stride = int(param.GetStride())
+		size   = param.Kernel()
+		stride = param.Strides()
 		groups = int(param.GetGroup())
 	)
-	if len(layer.Blobs) != 2 {
-		return nil, 0, fmt.Errorf("number of convolution blobs is not 2: %d", len(layer.Blobs))
+	if stride.X != stride.Y {
+		return nil, 0, fmt.Errorf("different horizontal and vertical stride: %v", stride)
+	}
+	numBlobs := 1
+	if param.GetBiasTerm() {
+		numBlobs = 2
+	}
+	if len(layer.Blobs) != numBlobs {
+		return nil, 0, fmt.Errorf("number of convolution blobs is not %d: %d", numBlobs, len(layer.Blobs))
 	}
 	var conv featset.Real
 	if groups <= 1 {
-		dims := BlobDims{Width: size, Height: size, In: in, Out: out}
+		dims := BlobDims{Width: size.X, Height: size.Y, In: in, Out: out}
 		bank, err := filterBankFromBlob(layer.Blobs[0], dims)
 		if err != nil {
 			return nil, 0, err
 		}
-		conv = &convfeat.ConvMulti{Stride: stride, Filters: bank}
+		conv = &convfeat.ConvMulti{Stride: stride.X, Filters: bank}
 	} else {
-		dims := BlobDims{Width: size, Height: size, In: in / groups, Out: out}
+		dims := BlobDims{Width: size.X, Height: size.Y, In: in / groups, Out: out}
 		banks, err := filterBanksFromBlob(layer.Blobs[0], dims, groups)
 		if err != nil {
 			return nil, 0, err
@@ -171,12 +212,15 @@ func convLayerToFunc(layer *LayerParameter, in int) (featset.Real, int, error) {
 		phis := make([]featset.Real, groups)
 		for i := range banks {
 			phis[i] = &featset.Compose{
-				Outer: &convfeat.ConvMulti{Stride: stride, Filters: banks[i]},
+				Outer: &convfeat.ConvMulti{Stride: stride.X, Filters: banks[i]},
 				Inner: &featset.ChannelInterval{i * dims.In, (i + 1) * dims.In},
 			}
 		}
 		conv = &featset.Concat{featset.RealSlice(phis)}
 	}
+	if !param.GetBiasTerm() {
+		return conv, out, nil
+	}
 	bias, err := biasFromBlob(layer.Blobs[1], out)
 	if err != nil {
 		return nil, 0, err
@@ -337,3 +381,96 @@ func reluLayerToFunc(layer *LayerParameter, in int) (featset.Real, int, error) {
 	}
 	return new(convfeat.PosPart), in, nil
 }
+
+// ipLayerToFunc converts an inner product layer into a convolution
+// whose kernel is the size of its input when the network is given input_dim.
+// Larger images give a dense map of outputs.
+func ipLayerToFunc(net *NetParameter, layer *LayerParameter, in int) (featset.Real, int, error) {
+	shape, err := ipInputShape(net, layer)
+	if err != nil {
+		return nil, 0, err
+	}
+	if shape.Channels != in {
+		return nil, 0, fmt.Errorf("input has %d channels, expect %d", in, shape.Channels)
+	}
+	conv := proto.Clone(layer).(*LayerParameter)
+	if err := ipToConv(conv, shape); err != nil {
+		return nil, 0, err
+	}
+	return convLayerToFunc(conv, in)
+}
+
+// ipInputShape gives the shape of the input to an inner product layer
+// before any flatten layers.
+func ipInputShape(net *NetParameter, layer *LayerParameter) (Shape, error) {
+	in, err := InputShape(net)
+	if err != nil {
+		return Shape{}, err
+	}
+	shapes, err := InferShapes(net, in)
+	if err != nil {
+		return Shape{}, err
+	}
+	bottom := layer.Bottom[0]
+	for {
+		l := layerByName(net, bottom)
+		if l == nil || l.GetType() != LayerParameter_FLATTEN {
+			break
+		}
+		bottom = l.Bottom[0]
+	}
+	s, ok := shapes[bottom]
+	if !ok {
+		return Shape{}, fmt.Errorf("no shape for input: %s", bottom)
+	}
+	return s, nil
+}
+
+func powerLayerToFunc(layer *LayerParameter, in int) (featset.Real, int, error) {
+	param := layer.GetPowerParam()
+	if param.GetPower() != 1 {
+		return nil, 0, fmt.Errorf("power is not 1: %g", param.GetPower())
+	}
+	scale := new(convfeat.Scale)
+	*scale = convfeat.Scale(param.GetScale())
+	shift := make(convfeat.AddConst, in)
+	for i := range shift {
+		shift[i] = float64(param.GetShift())
+	}
+	return &featset.Compose{Outer: &shift, Inner: scale}, in, nil
+}
+
+// softmax normalizes the channels at each position
+// to be positive and sum to one.
+type softmax struct{}
+
+func (phi *softmax) Rate() int { return 1 }
+
+func (phi *softmax) Apply(x *rimg64.Multi) (*rimg64.Multi, error) {
+	y := rimg64.NewMulti(x.Width, x.Height, x.Channels)
+	for u := 0; u < x.Width; u++ {
+		for v := 0; v < x.Height; v++ {
+			// Subtract the maximum for numerical stability.
+			m := math.Inf(-1)
+			for k := 0; k < x.Channels; k++ {
+				m = math.Max(m, x.At(u, v, k))
+			}
+			var sum float64
+			for k := 0; k < x.Channels; k++ {
+				e := math.Exp(x.At(u, v, k) - m)
+				y.Set(u, v, k, e)
+				sum += e
+			}
+			for k := 0; k < x.Channels; k++ {
+				y.Set(u, v, k, y.At(u, v, k)/sum)
+			}
+		}
+	}
+	return y, nil
+}
+
+func (phi *softmax) Marshaler() *featset.RealMarshaler {
+	return &featset.RealMarshaler{"caffe-softmax", phi}
+}
+
+func (phi *softmax) Transform() featset.Real { return phi }
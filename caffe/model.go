@@ -6,37 +6,11 @@ import (
 )
 
 func LayerRate(net *NetParameter, name string) int {
-	return rateHelper(net, name, 1)
-}
-
-func rateHelper(net *NetParameter, name string, prod int) int {
-	if name == "" {
-		panic("no layer name given")
-	}
-	if isInput(net, name) {
-		return prod
-	}
-	layer := layerByName(net, name)
-	if layer == nil {
-		panic(fmt.Sprintf("could not find layer: %s", name))
-	}
-	var stride int
-	switch *layer.Type {
-	case LayerParameter_CONVOLUTION:
-		stride = int(layer.GetConvolutionParam().GetStride())
-	case LayerParameter_POOLING:
-		stride = int(layer.GetPoolingParam().GetStride())
-	case LayerParameter_LRN:
-		stride = 1
-	default:
-		typename := LayerParameter_LayerType_name[int32(*layer.Type)]
-		panic(fmt.Sprintf("do not handle layer type: %s", typename))
-	}
-	bottoms := layer.GetBottom()
-	if len(bottoms) != 1 {
-		panic(fmt.Sprintf("layer %s does not have one input: %v", name, bottoms))
+	rate, _, err := layerGeometry(net, name)
+	if err != nil {
+		panic(err.Error())
 	}
-	return rateHelper(net, bottoms[0], stride*prod)
+	return rate
 }
 
 func isInput(net *NetParameter, name string) bool {
@@ -57,45 +31,79 @@ func layerByName(net *NetParameter, name string) *LayerParameter {
 	return nil
 }
 
+// HasLayer reports whether the network has a layer of the given name.
+func HasLayer(net *NetParameter, name string) bool {
+	return layerByName(net, name) != nil
+}
+
 func LayerField(net *NetParameter, name string) image.Point {
-	_, p := fieldHelper(net, name)
-	return p
+	_, field, err := layerGeometry(net, name)
+	if err != nil {
+		panic(err.Error())
+	}
+	return field
 }
 
-func fieldHelper(net *NetParameter, name string) (rate int, field image.Point) {
+// layerGeometry computes the rate and the receptive field of a layer
+// with respect to the network input.
+func layerGeometry(net *NetParameter, name string) (rate int, field image.Point, err error) {
 	if name == "" {
-		panic("no layer name given")
+		return 0, image.ZP, fmt.Errorf("no layer name given")
 	}
 	if isInput(net, name) {
-		return 1, image.Pt(1, 1)
+		return 1, image.Pt(1, 1), nil
 	}
 	layer := layerByName(net, name)
 	if layer == nil {
-		panic(fmt.Sprintf("could not find layer: %s", name))
+		return 0, image.ZP, fmt.Errorf("could not find layer: %s", name)
+	}
+	bottoms := layer.GetBottom()
+	if len(bottoms) != 1 {
+		return 0, image.ZP, fmt.Errorf("layer %s does not have one input: %v", name, bottoms)
+	}
+	k, p, err := layerKernel(net, layer)
+	if err != nil {
+		return 0, image.ZP, err
+	}
+	s, n, err := layerGeometry(net, bottoms[0])
+	if err != nil {
+		return 0, image.ZP, err
 	}
-	var (
-		k int
-		p image.Point
-	)
+	return k * s, p.Sub(image.Pt(1, 1)).Mul(s).Add(n), nil
+}
+
+// layerKernel gives the stride and kernel size of a single layer.
+// Inner product layers see their entire input,
+// which requires the network to have input_dim.
+func layerKernel(net *NetParameter, layer *LayerParameter) (int, image.Point, error) {
 	switch *layer.Type {
 	case LayerParameter_CONVOLUTION:
-		k = int(layer.GetConvolutionParam().GetStride())
-		p = layer.GetConvolutionParam().Kernel()
+		return int(layer.GetConvolutionParam().GetStride()), layer.GetConvolutionParam().Kernel(), nil
 	case LayerParameter_POOLING:
-		k = int(layer.GetPoolingParam().GetStride())
-		p = layer.GetPoolingParam().Kernel()
-	case LayerParameter_LRN:
-		k, p = 1, image.Pt(1, 1)
+		return int(layer.GetPoolingParam().GetStride()), layer.GetPoolingParam().Kernel(), nil
+	case LayerParameter_LRN, LayerParameter_RELU, LayerParameter_DROPOUT,
+		LayerParameter_POWER, LayerParameter_SIGMOID, LayerParameter_TANH,
+		LayerParameter_ABSVAL, LayerParameter_BNLL, LayerParameter_SOFTMAX,
+		LayerParameter_SPLIT:
+		return 1, image.Pt(1, 1), nil
+	case LayerParameter_INNER_PRODUCT, LayerParameter_FLATTEN:
+		in, err := InputShape(net)
+		if err != nil {
+			return 0, image.ZP, fmt.Errorf("layer %s: %v", layer.GetName(), err)
+		}
+		shapes, err := InferShapes(net, in)
+		if err != nil {
+			return 0, image.ZP, err
+		}
+		bottom, ok := shapes[layer.GetBottom()[0]]
+		if !ok {
+			return 0, image.ZP, fmt.Errorf("layer %s: no shape for input", layer.GetName())
+		}
+		return 1, bottom.Size(), nil
 	default:
 		typename := LayerParameter_LayerType_name[int32(*layer.Type)]
-		panic(fmt.Sprintf("do not handle layer type: %s", typename))
-	}
-	bottoms := layer.GetBottom()
-	if len(bottoms) != 1 {
-		panic(fmt.Sprintf("layer %s does not have one input: %v", name, bottoms))
+		return 0, image.ZP, fmt.Errorf("do not handle layer type: %s", typename)
 	}
-	s, n := fieldHelper(net, bottoms[0])
-	return k * s, p.Sub(image.Pt(1, 1)).Mul(s).Add(n)
 }
 
 func (param ConvolutionParameter) Kernel() image.Point {
@@ -0,0 +1,353 @@
+package caffe
+
+import (
+	"fmt"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-caffe/onnx"
+)
+
+// Versions of the ONNX format and operator set of exported models.
+const (
+	ONNXIRVersion    = 6
+	ONNXOpsetVersion = 11
+)
+
+// ONNXInput is the name of the input of exported models.
+const ONNXInput = "image"
+
+// ExportONNX converts the layers needed to compute an output to an ONNX model
+// with the blobs as initializers.
+// Like the transform from FromProto, the model takes an RGB image
+// with values in [0, 1], with dimensions 1 x 3 x height x width.
+// The mean is given in RGB order.
+// Convolution, pooling, LRN, ReLU, POWER, dropout, flatten, inner product
+// and softmax layers are supported.
+// Unlike FromProto, convolutions may be padded.
+// As in FromProto, inner product layers become convolutions over their
+// whole input, so that the output of a classifier is 1 x classes x 1 x 1.
+func ExportONNX(net *NetParameter, output string, mean []float64) (*onnx.ModelProto, error) {
+	if len(net.Input) != 1 {
+		return nil, fmt.Errorf("number of network inputs is not 1: %d", len(net.Input))
+	}
+	if len(mean) != 3 {
+		return nil, fmt.Errorf("mean must have 3 elements: found %d", len(mean))
+	}
+	subset := SubsetForOutput(net, output)
+	b := &onnxBuilder{
+		net:      net,
+		graph:    &onnx.GraphProto{Name: proto.String(net.GetName())},
+		tensors:  make(map[string]string),
+		channels: make(map[string]int),
+		last:     lastWrites(subset),
+	}
+	b.graph.Input = []*onnx.ValueInfoProto{
+		onnxValueInfo(ONNXInput, onnxDim(1), onnxDim(3), onnxParam("height"), onnxParam("width")),
+	}
+	b.preprocess(net.Input[0], mean)
+	for _, layer := range subset.Layers {
+		if err := b.layer(layer); err != nil {
+			return nil, fmt.Errorf("layer %s: %v", layer.GetName(), err)
+		}
+	}
+	out, ok := b.tensors[output]
+	if !ok {
+		return nil, fmt.Errorf("output not found: %s", output)
+	}
+	b.graph.Output = []*onnx.ValueInfoProto{
+		onnxValueInfo(out, onnxDim(1), onnxDim(int64(b.channels[output])), onnxParam("out_height"), onnxParam("out_width")),
+	}
+	model := &onnx.ModelProto{
+		IrVersion:    proto.Int64(ONNXIRVersion),
+		OpsetImport:  []*onnx.OperatorSetIdProto{{Domain: proto.String(""), Version: proto.Int64(ONNXOpsetVersion)}},
+		ProducerName: proto.String("go-caffe"),
+		Graph:        b.graph,
+	}
+	return model, nil
+}
+
+// onnxBuilder adds nodes to a graph.
+// Caffe blobs may be modified in-place but ONNX tensors may not,
+// so the builder tracks which tensor holds the current value of each blob.
+type onnxBuilder struct {
+	// Full network, for the input shapes of inner product layers.
+	net   *NetParameter
+	graph *onnx.GraphProto
+	// Name of the tensor which holds the current value of each blob.
+	tensors map[string]string
+	// Number of channels in each blob.
+	channels map[string]int
+	// Name of the last layer to write to each blob.
+	last map[string]string
+}
+
+// lastWrites finds the last layer to write to each blob.
+// Dropout and flatten layers are ignored since they do not add a node.
+func lastWrites(net *NetParameter) map[string]string {
+	last := make(map[string]string)
+	for _, layer := range net.Layers {
+		switch layer.GetType() {
+		case LayerParameter_DROPOUT, LayerParameter_FLATTEN:
+			continue
+		}
+		for _, top := range layer.Top {
+			last[top] = layer.GetName()
+		}
+	}
+	return last
+}
+
+// output gives the name of the tensor to which a layer writes a blob.
+// The final value of a blob has the name of the blob.
+func (b *onnxBuilder) output(layer *LayerParameter, blob string) string {
+	name := blob
+	if b.last[blob] != layer.GetName() {
+		name = blob + "/" + layer.GetName()
+	}
+	b.tensors[blob] = name
+	return name
+}
+
+func (b *onnxBuilder) node(name, op string, inputs []string, output string, attrs ...*onnx.AttributeProto) {
+	b.graph.Node = append(b.graph.Node, &onnx.NodeProto{
+		Name:      proto.String(name),
+		OpType:    proto.String(op),
+		Input:     inputs,
+		Output:    []string{output},
+		Attribute: attrs,
+	})
+}
+
+// initializer adds a constant tensor and returns its name.
+func (b *onnxBuilder) initializer(name string, dims []int64, data []float32) string {
+	b.graph.Initializer = append(b.graph.Initializer, &onnx.TensorProto{
+		Name:      proto.String(name),
+		Dims:      dims,
+		DataType:  proto.Int32(int32(onnx.TensorProto_FLOAT)),
+		FloatData: data,
+	})
+	return name
+}
+
+// preprocess adds nodes which scale by 255, subtract the mean
+// and reorder the channels to BGR, giving the network input.
+func (b *onnxBuilder) preprocess(input string, mean []float64) {
+	var (
+		scaled   = ONNXInput + "/scaled"
+		centered = ONNXInput + "/centered"
+	)
+	b.node(scaled, "Mul", []string{ONNXInput, b.initializer("scale", nil, []float32{255})}, scaled)
+	meanData := make([]float32, len(mean))
+	for i, x := range mean {
+		meanData[i] = float32(x)
+	}
+	b.node(centered, "Sub", []string{scaled, b.initializer("mean", []int64{1, 3, 1, 1}, meanData)}, centered)
+	b.graph.Initializer = append(b.graph.Initializer, &onnx.TensorProto{
+		Name:      proto.String("bgr"),
+		Dims:      []int64{3},
+		DataType:  proto.Int32(int32(onnx.TensorProto_INT64)),
+		Int64Data: []int64{2, 1, 0},
+	})
+	b.node(input, "Gather", []string{centered, "bgr"}, input, onnxAttrInt("axis", 1))
+	b.tensors[input] = input
+	b.channels[input] = 3
+}
+
+// layer adds the nodes for a layer.
+// Add new layer types here as they are supported by layerToFunc.
+func (b *onnxBuilder) layer(layer *LayerParameter) error {
+	if err := errIfNotOneInput(layer); err != nil {
+		return err
+	}
+	if len(layer.Top) != 1 {
+		return fmt.Errorf("number of layer outputs is not 1: %d", len(layer.Top))
+	}
+	var (
+		name   = layer.GetName()
+		bottom = layer.Bottom[0]
+		top    = layer.Top[0]
+	)
+	x, ok := b.tensors[bottom]
+	if !ok {
+		return fmt.Errorf("bottom not found: %s", bottom)
+	}
+	in := b.channels[bottom]
+	out := in
+
+	switch t := layer.GetType(); t {
+	case LayerParameter_CONVOLUTION:
+		var err error
+		if out, err = b.conv(layer, x, in); err != nil {
+			return err
+		}
+	case LayerParameter_INNER_PRODUCT:
+		shape, err := ipInputShape(b.net, layer)
+		if err != nil {
+			return err
+		}
+		if shape.Channels != in {
+			return fmt.Errorf("input has %d channels, expect %d", in, shape.Channels)
+		}
+		conv := proto.Clone(layer).(*LayerParameter)
+		if err := ipToConv(conv, shape); err != nil {
+			return err
+		}
+		if out, err = b.conv(conv, x, in); err != nil {
+			return err
+		}
+	case LayerParameter_SOFTMAX:
+		// Softmax in opset 11 normalizes over all dimensions from the axis,
+		// so channels are moved last to normalize each position.
+		var (
+			nhwc = name + "/nhwc"
+			prob = name + "/prob"
+		)
+		b.node(nhwc, "Transpose", []string{x}, nhwc, onnxAttrInts("perm", 0, 2, 3, 1))
+		b.node(prob, "Softmax", []string{nhwc}, prob, onnxAttrInt("axis", 3))
+		b.node(name, "Transpose", []string{prob}, b.output(layer, top), onnxAttrInts("perm", 0, 3, 1, 2))
+	case LayerParameter_LRN:
+		param := layer.GetLrnParam()
+		if param.GetNormRegion() != LRNParameter_ACROSS_CHANNELS {
+			return fmt.Errorf("normalization region: %s", param.GetNormRegion().String())
+		}
+		// Both Caffe and ONNX divide alpha by the size.
+		b.node(name, "LRN", []string{x}, b.output(layer, top),
+			onnxAttrInt("size", int64(param.GetLocalSize())),
+			onnxAttrFloat("alpha", param.GetAlpha()),
+			onnxAttrFloat("beta", param.GetBeta()),
+			onnxAttrFloat("bias", 1),
+		)
+	case LayerParameter_POOLING:
+		param := layer.GetPoolingParam()
+		if param.GetPool() != PoolingParameter_MAX {
+			return fmt.Errorf("pool type: %s", param.GetPool().String())
+		}
+		if param.GetPad() != 0 || param.GetPadH() != 0 || param.GetPadW() != 0 {
+			return fmt.Errorf("non-zero pad")
+		}
+		var (
+			k      = param.Kernel()
+			stride = param.Strides()
+		)
+		// Caffe rounds the output size of pooling up.
+		b.node(name, "MaxPool", []string{x}, b.output(layer, top),
+			onnxAttrInts("kernel_shape", int64(k.Y), int64(k.X)),
+			onnxAttrInts("strides", int64(stride.Y), int64(stride.X)),
+			onnxAttrInt("ceil_mode", 1),
+		)
+	case LayerParameter_RELU:
+		slope := layer.GetReluParam().GetNegativeSlope()
+		if slope != 0 {
+			b.node(name, "LeakyRelu", []string{x}, b.output(layer, top), onnxAttrFloat("alpha", slope))
+		} else {
+			b.node(name, "Relu", []string{x}, b.output(layer, top))
+		}
+	case LayerParameter_POWER:
+		param := layer.GetPowerParam()
+		if param.GetPower() != 1 {
+			return fmt.Errorf("power is not 1: %g", param.GetPower())
+		}
+		scaled := name + "/scaled"
+		b.node(scaled, "Mul", []string{x, b.initializer(name+"/scale", nil, []float32{param.GetScale()})}, scaled)
+		b.node(name, "Add", []string{scaled, b.initializer(name+"/shift", nil, []float32{param.GetShift()})}, b.output(layer, top))
+	case LayerParameter_DROPOUT, LayerParameter_FLATTEN:
+		// Dropout is the identity at test time.
+		// Flatten is the identity since inner products are convolutions.
+		b.tensors[top] = x
+	default:
+		return fmt.Errorf("unknown layer type: %s", t.String())
+	}
+	b.channels[top] = out
+	return nil
+}
+
+// conv adds the node for a convolution layer and returns the number of outputs.
+func (b *onnxBuilder) conv(layer *LayerParameter, x string, in int) (int, error) {
+	var (
+		name  = layer.GetName()
+		top   = layer.Top[0]
+		param = layer.GetConvolutionParam()
+		out   = int(param.GetNumOutput())
+	)
+	var (
+		k      = param.Kernel()
+		stride = param.Strides()
+		pad    = param.Padding()
+		groups = int64(param.GetGroup())
+	)
+	numBlobs := 1
+	if param.GetBiasTerm() {
+		numBlobs = 2
+	}
+	if len(layer.Blobs) != numBlobs {
+		return 0, fmt.Errorf("number of convolution blobs is not %d: %d", numBlobs, len(layer.Blobs))
+	}
+	if groups < 1 {
+		groups = 1
+	}
+	dims := BlobDims{Width: k.X, Height: k.Y, In: in / int(groups), Out: out}
+	if err := errIfDimsNotEq(dims, blobDims(layer.Blobs[0])); err != nil {
+		return 0, err
+	}
+	if err := errIfWrongNumElems(dims, layer.Blobs[0]); err != nil {
+		return 0, err
+	}
+	inputs := []string{x, b.initializer(name+"/weights",
+		[]int64{int64(dims.Out), int64(dims.In), int64(dims.Height), int64(dims.Width)},
+		layer.Blobs[0].Data)}
+	if param.GetBiasTerm() {
+		if _, err := biasFromBlob(layer.Blobs[1], out); err != nil {
+			return 0, err
+		}
+		inputs = append(inputs, b.initializer(name+"/bias", []int64{int64(out)}, layer.Blobs[1].Data))
+	}
+	b.node(name, "Conv", inputs, b.output(layer, top),
+		onnxAttrInts("kernel_shape", int64(k.Y), int64(k.X)),
+		onnxAttrInts("strides", int64(stride.Y), int64(stride.X)),
+		onnxAttrInts("pads", int64(pad.Y), int64(pad.X), int64(pad.Y), int64(pad.X)),
+		onnxAttrInt("group", groups),
+	)
+	return out, nil
+}
+
+func onnxAttrInt(name string, x int64) *onnx.AttributeProto {
+	return &onnx.AttributeProto{
+		Name: proto.String(name),
+		Type: onnx.AttributeProto_INT.Enum(),
+		I:    proto.Int64(x),
+	}
+}
+
+func onnxAttrInts(name string, x ...int64) *onnx.AttributeProto {
+	return &onnx.AttributeProto{
+		Name: proto.String(name),
+		Type: onnx.AttributeProto_INTS.Enum(),
+		Ints: x,
+	}
+}
+
+func onnxAttrFloat(name string, x float32) *onnx.AttributeProto {
+	return &onnx.AttributeProto{
+		Name: proto.String(name),
+		Type: onnx.AttributeProto_FLOAT.Enum(),
+		F:    proto.Float32(x),
+	}
+}
+
+func onnxDim(n int64) *onnx.TensorShapeProto_Dimension {
+	return &onnx.TensorShapeProto_Dimension{DimValue: proto.Int64(n)}
+}
+
+func onnxParam(name string) *onnx.TensorShapeProto_Dimension {
+	return &onnx.TensorShapeProto_Dimension{DimParam: proto.String(name)}
+}
+
+func onnxValueInfo(name string, dims ...*onnx.TensorShapeProto_Dimension) *onnx.ValueInfoProto {
+	return &onnx.ValueInfoProto{
+		Name: proto.String(name),
+		Type: &onnx.TypeProto{TensorType: &onnx.TypeProto_Tensor{
+			ElemType: proto.Int32(int32(onnx.TensorProto_FLOAT)),
+			Shape:    &onnx.TensorShapeProto{Dim: dims},
+		}},
+	}
+}
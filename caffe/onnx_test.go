@@ -0,0 +1,238 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-caffe/onnx"
+	"github.com/jvlmdr/go-cv/convfeat"
+	"github.com/jvlmdr/go-cv/featset"
+)
+
+const onnxTestNet = `
+name: "OnnxNet"
+input: "data"
+input_dim: 1 input_dim: 3 input_dim: 21 input_dim: 21
+layers { name: "conv1" type: CONVOLUTION bottom: "data" top: "conv1"
+  convolution_param { num_output: 4 kernel_size: 3 stride: 2 } }
+layers { name: "relu1" type: RELU bottom: "conv1" top: "conv1" }
+layers { name: "pool1" type: POOLING bottom: "conv1" top: "pool1"
+  pooling_param { pool: MAX kernel_size: 2 stride: 2 } }
+layers { name: "norm1" type: LRN bottom: "pool1" top: "norm1"
+  lrn_param { local_size: 3 alpha: 0.1 beta: 0.75 } }
+layers { name: "conv2" type: CONVOLUTION bottom: "norm1" top: "conv2"
+  convolution_param { num_output: 6 kernel_size: 2 group: 2 } }
+layers { name: "relu2" type: RELU bottom: "conv2" top: "conv2" }
+layers { name: "drop2" type: DROPOUT bottom: "conv2" top: "conv2" }
+layers { name: "scale2" type: POWER bottom: "conv2" top: "conv2"
+  power_param { scale: 0.5 shift: -0.1 } }
+layers { name: "flat" type: FLATTEN bottom: "conv2" top: "flat" }
+layers { name: "fc" type: INNER_PRODUCT bottom: "flat" top: "fc"
+  inner_product_param { num_output: 5 } }
+layers { name: "prob" type: SOFTMAX bottom: "fc" top: "prob" }
+`
+
+// The exported graph, evaluated with the native engine,
+// must give the same output as FromProto.
+func TestExportONNX_parity(t *testing.T) {
+	net := new(NetParameter)
+	if err := proto.UnmarshalText(onnxTestNet, net); err != nil {
+		t.Fatal(err)
+	}
+	randomWeights(t, net)
+	mean := []float64{120, 110, 100}
+
+	for _, output := range []string{"pool1", "conv2", "fc", "prob"} {
+		model, err := ExportONNX(net, output, mean)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Check that the model survives encoding.
+		data, err := proto.Marshal(model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := new(onnx.ModelProto)
+		if err := proto.Unmarshal(data, decoded); err != nil {
+			t.Fatal(err)
+		}
+		psi, err := onnxToFunc(decoded.GetGraph())
+		if err != nil {
+			t.Fatalf("output %s: evaluate onnx: %v", output, err)
+		}
+		phi, err := FromProto(net, output, mean)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		im := randomImage(image.Pt(21, 21))
+		want, err := phi.Apply(im)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := psi.Apply(im)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Size().Eq(want.Size()) || got.Channels != want.Channels {
+			t.Fatalf("output %s: size: want %v x %d, got %v x %d",
+				output, want.Size(), want.Channels, got.Size(), got.Channels)
+		}
+		for i := 0; i < want.Width; i++ {
+			for j := 0; j < want.Height; j++ {
+				for k := 0; k < want.Channels; k++ {
+					x, y := want.At(i, j, k), got.At(i, j, k)
+					if math.Abs(x-y) > 1e-9*math.Max(1, math.Abs(x)) {
+						t.Fatalf("output %s: at %d,%d,%d: want %g, got %g", output, i, j, k, x, y)
+					}
+				}
+			}
+		}
+		if out := decoded.GetGraph().GetOutput()[0].GetName(); out != output {
+			t.Errorf("name of graph output: want %s, got %s", output, out)
+		}
+	}
+}
+
+// onnxToFunc evaluates a linear ONNX graph from ExportONNX
+// by converting each node to a native transform.
+func onnxToFunc(g *onnx.GraphProto) (featset.Image, error) {
+	inits := make(map[string]*onnx.TensorProto)
+	for _, x := range g.Initializer {
+		inits[x.GetName()] = x
+	}
+	var (
+		phi      featset.Real
+		prev     = ONNXInput
+		channels = 3
+	)
+	for _, node := range g.Node {
+		if node.Input[0] != prev {
+			return nil, fmt.Errorf("node %s: graph is not linear", node.GetName())
+		}
+		f, out, err := onnxNodeToFunc(node, inits, channels)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %v", node.GetName(), err)
+		}
+		if phi == nil {
+			phi = f
+		} else {
+			phi = &featset.Compose{Outer: f, Inner: phi}
+		}
+		prev, channels = node.Output[0], out
+	}
+	if out := g.GetOutput()[0].GetName(); prev != out {
+		return nil, fmt.Errorf("graph output is %s, last node gives %s", out, prev)
+	}
+	return &featset.ComposeImage{phi, new(featset.RGB)}, nil
+}
+
+func onnxNodeToFunc(node *onnx.NodeProto, inits map[string]*onnx.TensorProto, in int) (featset.Real, int, error) {
+	attrs := make(map[string]*onnx.AttributeProto)
+	for _, a := range node.Attribute {
+		attrs[a.GetName()] = a
+	}
+	constant := func(i int) *onnx.TensorProto { return inits[node.Input[i]] }
+
+	switch op := node.GetOpType(); op {
+	case "Mul":
+		scale := new(convfeat.Scale)
+		*scale = convfeat.Scale(constant(1).FloatData[0])
+		return scale, in, nil
+	case "Add", "Sub":
+		c := constant(1).FloatData
+		shift := make(convfeat.AddConst, in)
+		for i := range shift {
+			x := float64(c[0])
+			if len(c) == in {
+				x = float64(c[i])
+			}
+			if op == "Sub" {
+				x = -x
+			}
+			shift[i] = x
+		}
+		return &shift, in, nil
+	case "Gather":
+		var order []int
+		for _, i := range constant(1).Int64Data {
+			order = append(order, int(i))
+		}
+		return &featset.SelectChannels{Channels: order}, len(order), nil
+	case "Conv":
+		w := constant(1)
+		ints := func(name string) []int64 { return attrs[name].Ints }
+		if pads := ints("pads"); pads[0] != 0 || pads[1] != 0 {
+			return nil, 0, fmt.Errorf("non-zero pad")
+		}
+		if k := ints("kernel_shape"); k[0] != k[1] {
+			return nil, 0, fmt.Errorf("non-square kernel")
+		}
+		layer := &LayerParameter{
+			Type: LayerParameter_CONVOLUTION.Enum(),
+			ConvolutionParam: &ConvolutionParameter{
+				NumOutput:  proto.Uint32(uint32(w.Dims[0])),
+				KernelSize: proto.Uint32(uint32(w.Dims[2])),
+				Stride:     proto.Uint32(uint32(ints("strides")[0])),
+				Group:      proto.Uint32(uint32(attrs["group"].GetI())),
+				BiasTerm:   proto.Bool(len(node.Input) > 2),
+			},
+			Blobs: []*BlobProto{{
+				Num:      proto.Int32(int32(w.Dims[0])),
+				Channels: proto.Int32(int32(w.Dims[1])),
+				Height:   proto.Int32(int32(w.Dims[2])),
+				Width:    proto.Int32(int32(w.Dims[3])),
+				Data:     w.FloatData,
+			}},
+		}
+		if len(node.Input) > 2 {
+			b := constant(2)
+			layer.Blobs = append(layer.Blobs, &BlobProto{
+				Num:      proto.Int32(1),
+				Channels: proto.Int32(1),
+				Height:   proto.Int32(1),
+				Width:    proto.Int32(int32(b.Dims[0])),
+				Data:     b.FloatData,
+			})
+		}
+		return layerToFunc(layer, in)
+	case "Transpose":
+		// Channels are moved last and back around softmax,
+		// which the native transform computes in place.
+		perm := attrs["perm"].Ints
+		if len(perm) != 4 || perm[0] != 0 {
+			return nil, 0, fmt.Errorf("unexpected permutation: %v", perm)
+		}
+		order := make([]int, in)
+		for i := range order {
+			order[i] = i
+		}
+		return &featset.SelectChannels{Channels: order}, in, nil
+	case "Softmax":
+		if axis := attrs["axis"].GetI(); axis != 3 {
+			return nil, 0, fmt.Errorf("softmax over axis %d", axis)
+		}
+		return new(softmax), in, nil
+	case "Relu":
+		return new(convfeat.PosPart), in, nil
+	case "LRN":
+		size := attrs["size"].GetI()
+		return &convfeat.AdjChanNorm{
+			Num:   int(size),
+			K:     float64(attrs["bias"].GetF()),
+			Alpha: float64(attrs["alpha"].GetF()) / float64(size),
+			Beta:  float64(attrs["beta"].GetF()),
+		}, in, nil
+	case "MaxPool":
+		k, stride := attrs["kernel_shape"].Ints, attrs["strides"].Ints
+		return &convfeat.MaxPool{
+			Field:  image.Pt(int(k[1]), int(k[0])),
+			Stride: int(stride[0]),
+		}, in, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported op: %s", op)
+	}
+}
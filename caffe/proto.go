@@ -1,7 +1,12 @@
 package caffe
 
 import (
-	//	"code.google.com/p/goprotobuf/proto"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"code.google.com/p/goprotobuf/proto"
 	"github.com/jvlmdr/go-cv/rimg64"
 )
 
@@ -111,3 +116,69 @@ func multiFromProto(msg *Multi) *rimg64.Multi {
 	}
 	return f
 }
+
+func multiToProto(f *rimg64.Multi) *Multi {
+	var (
+		ek = 1
+		ej = f.Channels
+		ei = f.Height * f.Channels
+	)
+	elem := make([]float64, f.Width*f.Height*f.Channels)
+	for i := 0; i < f.Width; i++ {
+		for j := 0; j < f.Height; j++ {
+			for k := 0; k < f.Channels; k++ {
+				elem[i*ei+j*ej+k*ek] = f.At(i, j, k)
+			}
+		}
+	}
+	return &Multi{
+		Width:         proto.Int(f.Width),
+		Height:        proto.Int(f.Height),
+		NumChannels:   proto.Int(f.Channels),
+		XStride:       proto.Int(ei),
+		YStride:       proto.Int(ej),
+		ChannelStride: proto.Int(ek),
+		Elem:          elem,
+	}
+}
+
+// WriteMulti writes a feature image as a Multi message
+// preceded by its length as a varint,
+// so that several images can be written to one stream.
+func WriteMulti(w io.Writer, f *rimg64.Multi) error {
+	data, err := proto.Marshal(multiToProto(f))
+	if err != nil {
+		return err
+	}
+	var n [binary.MaxVarintLen64]byte
+	if _, err := w.Write(n[:binary.PutUvarint(n[:], uint64(len(data)))]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadMulti reads a feature image which was written by WriteMulti.
+// Returns io.EOF if the stream ends before the next image.
+func ReadMulti(r *bufio.Reader) (*rimg64.Multi, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	msg := new(Multi)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	size := int(msg.GetWidth()) * int(msg.GetHeight()) * int(msg.GetNumChannels())
+	if len(msg.Elem) != size {
+		return nil, fmt.Errorf("number of elements is %d, expect %d", len(msg.Elem), size)
+	}
+	return multiFromProto(msg), nil
+}
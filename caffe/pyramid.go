@@ -0,0 +1,153 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/jvlmdr/go-cv/featset"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// PyramidOptions describes the levels of an image pyramid.
+type PyramidOptions struct {
+	// Ratio of the size of each level to the previous level, in (0, 1).
+	Step float64
+	// Levels are computed while both sides of the resized image
+	// are at least this size.
+	// If zero, the receptive field of the layer is used
+	// so that each level has at least one feature.
+	MinSize image.Point
+	// Maximum number of levels, or zero for no limit.
+	MaxLevels int
+}
+
+// Level is the feature map of one level of a pyramid.
+type Level struct {
+	Feat      *rimg64.Multi
+	Transform FeatTransform
+}
+
+// FeatTransform relates positions in a feature map
+// to pixels in the original image.
+// It assumes that the network does not pad its input.
+type FeatTransform struct {
+	// Size of the resized image relative to the original.
+	// The scales of the two axes differ slightly
+	// since the size of the resized image is rounded.
+	ScaleX, ScaleY float64
+	// Rate and receptive field of the layer in the resized image.
+	Rate  int
+	Field image.Point
+}
+
+// Rect gives the receptive field of a feature in the original image.
+func (t FeatTransform) Rect(feat image.Point) image.Rectangle {
+	min := feat.Mul(t.Rate)
+	max := min.Add(t.Field)
+	return image.Rect(
+		int(math.Floor(float64(min.X)/t.ScaleX)),
+		int(math.Floor(float64(min.Y)/t.ScaleY)),
+		int(math.Ceil(float64(max.X)/t.ScaleX)),
+		int(math.Ceil(float64(max.Y)/t.ScaleY)),
+	)
+}
+
+// Feat gives the feature whose receptive field is centered
+// nearest to a pixel in the original image.
+// The result may be outside the feature map.
+func (t FeatTransform) Feat(pixel image.Point) image.Point {
+	coord := func(x, scale float64, field int) int {
+		return int(math.Floor((x*scale-float64(field)/2)/float64(t.Rate) + 0.5))
+	}
+	return image.Pt(
+		coord(float64(pixel.X)+0.5, t.ScaleX, t.Field.X),
+		coord(float64(pixel.Y)+0.5, t.ScaleY, t.Field.Y),
+	)
+}
+
+// PyramidScales returns the scales of the levels of a pyramid
+// for an image of the given size, starting at 1.
+func PyramidScales(size image.Point, opts PyramidOptions) ([]float64, error) {
+	if !(opts.Step > 0 && opts.Step < 1) {
+		return nil, fmt.Errorf("pyramid step not in (0, 1): %g", opts.Step)
+	}
+	var scales []float64
+	for scale := 1.0; opts.MaxLevels <= 0 || len(scales) < opts.MaxLevels; scale *= opts.Step {
+		s := scaledSize(size, scale)
+		if s.X < opts.MinSize.X || s.Y < opts.MinSize.Y || s.X < 1 || s.Y < 1 {
+			break
+		}
+		scales = append(scales, scale)
+	}
+	return scales, nil
+}
+
+func scaledSize(size image.Point, scale float64) image.Point {
+	return image.Pt(
+		int(math.Floor(float64(size.X)*scale+0.5)),
+		int(math.Floor(float64(size.Y)*scale+0.5)),
+	)
+}
+
+// Pyramid computes the feature at every level of an image pyramid.
+// All levels are computed in one batch.
+func (phi *Feature) Pyramid(im image.Image, opts PyramidOptions) ([]*Level, error) {
+	rate, field, err := layerGeometry(phi.Model, phi.Layer)
+	if err != nil {
+		return nil, err
+	}
+	return pyramid(phi.Map, rate, field, im, opts)
+}
+
+// NativePyramid computes a feature transform from FromProto
+// at every level of an image pyramid.
+// The network and layer give the rate and receptive field.
+func NativePyramid(phi featset.Image, net *NetParameter, layer string, im image.Image, opts PyramidOptions) ([]*Level, error) {
+	rate, field, err := layerGeometry(net, layer)
+	if err != nil {
+		return nil, err
+	}
+	return pyramid(ApplyEach(phi), rate, field, im, opts)
+}
+
+func pyramid(mapAll func([]image.Image) ([]*rimg64.Multi, error), rate int, field image.Point, im image.Image, opts PyramidOptions) ([]*Level, error) {
+	if opts.MinSize == (image.Point{}) {
+		opts.MinSize = field
+	}
+	size := im.Bounds().Size()
+	scales, err := PyramidScales(size, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(scales) == 0 {
+		return nil, fmt.Errorf("image smaller than minimum size: %v < %v", size, opts.MinSize)
+	}
+	ims := make([]image.Image, len(scales))
+	for i, scale := range scales {
+		if scale == 1 {
+			ims[i] = im
+			continue
+		}
+		ims[i] = Resize(im, scaledSize(size, scale))
+	}
+	feats, err := mapAll(ims)
+	if err != nil {
+		return nil, err
+	}
+	levels := make([]*Level, len(scales))
+	for i := range scales {
+		// Use the actual scales after rounding the size.
+		s := ims[i].Bounds().Size()
+		levels[i] = &Level{
+			Feat: feats[i],
+			Transform: FeatTransform{
+				ScaleX: float64(s.X) / float64(size.X),
+				ScaleY: float64(s.Y) / float64(size.Y),
+				Rate:   rate,
+				Field:  field,
+			},
+		}
+	}
+	return levels, nil
+}
@@ -0,0 +1,111 @@
+package caffe
+
+import (
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+func TestPyramidScales(t *testing.T) {
+	cases := []struct {
+		Size image.Point
+		Opts PyramidOptions
+		Want []float64
+	}{
+		{image.Pt(100, 80), PyramidOptions{Step: 0.5, MinSize: image.Pt(20, 20)}, []float64{1, 0.5, 0.25}},
+		// The smaller side decides.
+		{image.Pt(100, 30), PyramidOptions{Step: 0.5, MinSize: image.Pt(20, 20)}, []float64{1}},
+		{image.Pt(100, 80), PyramidOptions{Step: 0.5, MaxLevels: 2}, []float64{1, 0.5}},
+		// Levels stop before the image vanishes: 4 * 0.125 is rounded to 1.
+		{image.Pt(4, 4), PyramidOptions{Step: 0.5}, []float64{1, 0.5, 0.25, 0.125}},
+		// The rounded size must be at least the minimum.
+		{image.Pt(39, 39), PyramidOptions{Step: 0.5, MinSize: image.Pt(20, 20)}, []float64{1, 0.5}},
+		{image.Pt(10, 10), PyramidOptions{Step: 0.5, MinSize: image.Pt(11, 11)}, nil},
+	}
+	for _, c := range cases {
+		got, err := PyramidScales(c.Size, c.Opts)
+		if err != nil {
+			t.Errorf("size %v, options %+v: %v", c.Size, c.Opts, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.Want) {
+			t.Errorf("size %v, options %+v: got %v, want %v", c.Size, c.Opts, got, c.Want)
+		}
+	}
+	for _, step := range []float64{0, 1, -0.5, 2} {
+		if _, err := PyramidScales(image.Pt(10, 10), PyramidOptions{Step: step}); err == nil {
+			t.Errorf("step %g: expect error", step)
+		}
+	}
+}
+
+// Feat gives back the feature whose receptive field is centered on a pixel.
+func TestFeatTransform(t *testing.T) {
+	transforms := []FeatTransform{
+		{ScaleX: 1, ScaleY: 1, Rate: 4, Field: image.Pt(11, 11)},
+		{ScaleX: 0.5, ScaleY: 0.5, Rate: 8, Field: image.Pt(16, 16)},
+		{ScaleX: 0.7, ScaleY: 0.68, Rate: 16, Field: image.Pt(35, 27)},
+	}
+	for _, tr := range transforms {
+		for u := 0; u < 6; u++ {
+			for v := 0; v < 6; v++ {
+				p := image.Pt(u, v)
+				r := tr.Rect(p)
+				center := r.Min.Add(r.Max).Div(2)
+				if got := tr.Feat(center); !got.Eq(p) {
+					t.Errorf("%+v: feature %v has field %v whose center gives %v", tr, p, r, got)
+				}
+			}
+		}
+	}
+	// The field in the original image grows as the scale shrinks.
+	tr := FeatTransform{ScaleX: 0.5, ScaleY: 0.25, Rate: 2, Field: image.Pt(3, 3)}
+	if got, want := tr.Rect(image.Pt(1, 1)), image.Rect(4, 8, 10, 20); !got.Eq(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// The scale of each level is that of the rounded size, on each axis.
+func TestPyramid_scales(t *testing.T) {
+	// The feature is the image itself.
+	mapAll := func(ims []image.Image) ([]*rimg64.Multi, error) {
+		feats := make([]*rimg64.Multi, len(ims))
+		for i, im := range ims {
+			s := im.Bounds().Size()
+			feats[i] = rimg64.NewMulti(s.X, s.Y, 1)
+		}
+		return feats, nil
+	}
+	size := image.Pt(101, 33)
+	opts := PyramidOptions{Step: 0.7}
+	levels, err := pyramid(mapAll, 1, image.Pt(1, 1), randomImage(size), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scales, err := PyramidScales(size, PyramidOptions{Step: 0.7, MinSize: image.Pt(1, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(levels) != len(scales) {
+		t.Fatalf("got %d levels, want %d", len(levels), len(scales))
+	}
+	var differ bool
+	for i, level := range levels {
+		s := level.Feat.Size()
+		tr := level.Transform
+		if tr.ScaleX != float64(s.X)/float64(size.X) || tr.ScaleY != float64(s.Y)/float64(size.Y) {
+			t.Errorf("level %d of size %v: got scales %g, %g", i, s, tr.ScaleX, tr.ScaleY)
+		}
+		if tr.ScaleX != tr.ScaleY {
+			differ = true
+		}
+	}
+	if !differ {
+		t.Error("expect rounding to give different scales on some level")
+	}
+	if _, err := pyramid(mapAll, 1, image.Pt(40, 40), randomImage(size), opts); err == nil {
+		t.Error("image smaller than field: expect error")
+	}
+}
@@ -0,0 +1,169 @@
+package caffe
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-file/fileutil"
+)
+
+// ManifestFile is the name of the manifest within a model directory.
+const ManifestFile = "manifest.json"
+
+// Manifest describes the files and input format of a model.
+// Paths are relative to the model directory.
+type Manifest struct {
+	// Network definition for deployment (prototxt).
+	Deploy string `json:"deploy"`
+	// Pre-trained weights (caffemodel).
+	Weights string `json:"weights"`
+	// SHA-256 digest of the weights file in hex.
+	WeightsSHA256 string `json:"weights_sha256"`
+	// Mean image as saved by numpy, for the Python script.
+	MeanFile string `json:"mean_file,omitempty"`
+	// Mean pixel in RGB order, for native transforms.
+	Mean []float64 `json:"mean,omitempty"`
+	// Size of the image which the network was trained on.
+	InputWidth  int `json:"input_width,omitempty"`
+	InputHeight int `json:"input_height,omitempty"`
+	// Order of channels which the network expects, "BGR" or "RGB".
+	ChannelOrder string `json:"channel_order,omitempty"`
+	// Text file with one class label per line.
+	Labels string `json:"labels,omitempty"`
+}
+
+// Registry is a directory which contains one sub-directory per model.
+type Registry struct {
+	Dir string
+}
+
+// Model is a model in the registry whose manifest has been read.
+type Model struct {
+	Name string
+	Dir  string
+	Manifest
+}
+
+// LoadModel loads a model by name from ModelsDir.
+func LoadModel(name string) (*Model, error) {
+	return Registry{ModelsDir}.Load(name)
+}
+
+// Has reports whether the named model has a manifest.
+func (r Registry) Has(name string) bool {
+	_, err := os.Stat(path.Join(r.Dir, name, ManifestFile))
+	return err == nil
+}
+
+// List returns the names of all models which have a manifest.
+func (r Registry) List() ([]string, error) {
+	infos, err := ioutil.ReadDir(r.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() && r.Has(info.Name()) {
+			names = append(names, info.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Load reads the manifest of a model and verifies the checksum of its weights.
+func (r Registry) Load(name string) (*Model, error) {
+	dir := path.Join(r.Dir, name)
+	m := &Model{Name: name, Dir: dir}
+	if err := fileutil.LoadJSON(path.Join(dir, ManifestFile), &m.Manifest); err != nil {
+		return nil, fmt.Errorf("load manifest of %s: %v", name, err)
+	}
+	if m.Deploy == "" {
+		return nil, fmt.Errorf("manifest of %s: no deploy file", name)
+	}
+	if m.Weights == "" {
+		return nil, fmt.Errorf("manifest of %s: no weights file", name)
+	}
+	switch m.ChannelOrder {
+	case "", "BGR", "RGB":
+	default:
+		return nil, fmt.Errorf("manifest of %s: unknown channel order: %s", name, m.ChannelOrder)
+	}
+	if m.InputWidth < 0 || m.InputHeight < 0 {
+		return nil, fmt.Errorf("manifest of %s: negative input size", name)
+	}
+	if err := m.Verify(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Verify checks the weights file against the digest in the manifest.
+func (m *Model) Verify() error {
+	if m.WeightsSHA256 == "" {
+		return fmt.Errorf("manifest of %s: no weights checksum", m.Name)
+	}
+	sum, err := fileDigest(m.WeightsFile())
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(sum); !strings.EqualFold(got, m.WeightsSHA256) {
+		return fmt.Errorf("weights of %s: checksum mismatch: expect %s, found %s", m.Name, m.WeightsSHA256, got)
+	}
+	return nil
+}
+
+// InputSize returns the size of the training images,
+// or zero if the manifest does not specify it.
+func (m *Manifest) InputSize() image.Point {
+	return image.Pt(m.InputWidth, m.InputHeight)
+}
+
+func (m *Model) DeployFile() string  { return path.Join(m.Dir, m.Deploy) }
+func (m *Model) WeightsFile() string { return path.Join(m.Dir, m.Weights) }
+
+// MeanFilePath returns the mean file of the model,
+// or the global MeanFile if the manifest does not specify one.
+func (m *Model) MeanFilePath() string {
+	if m.MeanFile == "" {
+		return MeanFile
+	}
+	return path.Join(m.Dir, m.MeanFile)
+}
+
+// LabelsFile returns the labels file of the model,
+// or the empty string if the manifest does not specify one.
+func (m *Model) LabelsFile() string {
+	if m.Labels == "" {
+		return ""
+	}
+	return path.Join(m.Dir, m.Labels)
+}
+
+// LoadDeploy reads the network definition from the deploy prototxt.
+func (m *Model) LoadDeploy() (*NetParameter, error) {
+	data, err := ioutil.ReadFile(m.DeployFile())
+	if err != nil {
+		return nil, err
+	}
+	net := new(NetParameter)
+	if err := proto.UnmarshalText(string(data), net); err != nil {
+		return nil, fmt.Errorf("deploy file of %s: %v", m.Name, err)
+	}
+	return net, nil
+}
+
+// LoadLabels reads the class labels, one per line.
+func (m *Model) LoadLabels() ([]string, error) {
+	if m.Labels == "" {
+		return nil, fmt.Errorf("manifest of %s: no labels file", m.Name)
+	}
+	return LoadLabels(m.LabelsFile())
+}
@@ -0,0 +1,53 @@
+package caffe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRegistry_Load(t *testing.T) {
+	r := Registry{t.TempDir()}
+	weights := []byte("weights")
+	sum := sha256.Sum256(weights)
+	manifest := func(extra string) string {
+		return fmt.Sprintf(`{"deploy": "deploy.prototxt", "weights": "net.caffemodel", "weights_sha256": "%s"%s}`,
+			hex.EncodeToString(sum[:]), extra)
+	}
+	cases := map[string]string{
+		"good":    manifest(`, "input_width": 227, "input_height": 200, "channel_order": "BGR"`),
+		"order":   manifest(`, "channel_order": "GBR"`),
+		"size":    manifest(`, "input_width": -1`),
+		"weights": `{"deploy": "deploy.prototxt", "weights": "net.caffemodel", "weights_sha256": "00"}`,
+	}
+	for name, data := range cases {
+		dir := path.Join(r.Dir, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, ManifestFile), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, "net.caffemodel"), weights, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := r.Load("good")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := m.InputSize(); !size.Eq(image.Pt(227, 200)) {
+		t.Errorf("got input size %v, want (227,200)", size)
+	}
+	for _, name := range []string{"order", "size", "weights"} {
+		if _, err := r.Load(name); err == nil {
+			t.Errorf("%s: expect error", name)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package caffe
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Resize scales an image to the given size with a triangle filter.
+// When shrinking, the filter is widened to average over the source pixels.
+// The alpha channel is ignored.
+func Resize(im image.Image, size image.Point) *image.RGBA {
+	src := toFloatRGB(im)
+	b := im.Bounds()
+	// Resize rows then columns.
+	tmp := resample(src, b.Dx(), b.Dy(), size.X, true)
+	pix := resample(tmp, size.X, b.Dy(), size.Y, false)
+
+	dst := image.NewRGBA(image.Rectangle{Max: size})
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			p := pix[3*(y*size.X+x):]
+			dst.SetRGBA(x, y, color.RGBA{clampUint8(p[0]), clampUint8(p[1]), clampUint8(p[2]), 255})
+		}
+	}
+	return dst
+}
+
+// toFloatRGB returns the pixels in row-major order with values in [0, 255].
+func toFloatRGB(im image.Image) []float64 {
+	b := im.Bounds()
+	pix := make([]float64, 3*b.Dx()*b.Dy())
+	var i int
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, b, _ := im.At(x, y).RGBA()
+			pix[i], pix[i+1], pix[i+2] = float64(r>>8), float64(g>>8), float64(b>>8)
+			i += 3
+		}
+	}
+	return pix
+}
+
+// resample resizes an RGB image of width w and height h along one axis
+// to n pixels.
+func resample(src []float64, w, h, n int, horiz bool) []float64 {
+	m := h
+	if horiz {
+		m = w
+	}
+	weights := filterWeights(m, n)
+	var dst []float64
+	if horiz {
+		dst = make([]float64, 3*n*h)
+	} else {
+		dst = make([]float64, 3*w*n)
+	}
+	for i, ws := range weights {
+		for _, wt := range ws {
+			if horiz {
+				for y := 0; y < h; y++ {
+					s, d := src[3*(y*w+wt.index):], dst[3*(y*n+i):]
+					d[0] += wt.weight * s[0]
+					d[1] += wt.weight * s[1]
+					d[2] += wt.weight * s[2]
+				}
+			} else {
+				for x := 0; x < w; x++ {
+					s, d := src[3*(wt.index*w+x):], dst[3*(i*w+x):]
+					d[0] += wt.weight * s[0]
+					d[1] += wt.weight * s[1]
+					d[2] += wt.weight * s[2]
+				}
+			}
+		}
+	}
+	return dst
+}
+
+type filterWeight struct {
+	index  int
+	weight float64
+}
+
+// filterWeights gives the normalized weights of the source pixels
+// which contribute to each of n destination pixels.
+func filterWeights(m, n int) [][]filterWeight {
+	scale := float64(n) / float64(m)
+	radius := math.Max(1, 1/scale)
+	weights := make([][]filterWeight, n)
+	for i := range weights {
+		// Center of destination pixel in source coordinates.
+		c := (float64(i)+0.5)/scale - 0.5
+		lo, hi := int(math.Floor(c-radius)), int(math.Ceil(c+radius))
+		var sum float64
+		for j := lo; j <= hi; j++ {
+			w := 1 - math.Abs(float64(j)-c)/radius
+			if w <= 0 {
+				continue
+			}
+			// Replicate the border.
+			k := j
+			if k < 0 {
+				k = 0
+			} else if k >= m {
+				k = m - 1
+			}
+			weights[i] = append(weights[i], filterWeight{k, w})
+			sum += w
+		}
+		for j := range weights[i] {
+			weights[i][j].weight /= sum
+		}
+	}
+	return weights
+}
+
+func clampUint8(x float64) uint8 {
+	x = math.Floor(x + 0.5)
+	if x < 0 {
+		return 0
+	}
+	if x > 255 {
+		return 255
+	}
+	return uint8(x)
+}
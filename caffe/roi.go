@@ -0,0 +1,222 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/jvlmdr/go-cv/featset"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// WarpOptions describes how boxes are cropped and warped
+// to the input size of a network, as in R-CNN.
+type WarpOptions struct {
+	// Size of each warped crop.
+	// If zero, the size is taken from the input_dim of the network.
+	Size image.Point
+	// Pixels of context which surround the box in the warped crop.
+	Padding int
+	// Color of pixels outside the image in RGB order, from 0 to 255.
+	// Using the mean of the network gives zero after subtracting the mean.
+	// If nil, black is used.
+	Fill []float64
+}
+
+// WarpBoxes crops each box from an image with context padding
+// and resizes it to the given size, ignoring the aspect ratio.
+// Boxes are relative to the minimum of the image bounds.
+func WarpBoxes(im image.Image, boxes []image.Rectangle, opts WarpOptions) ([]image.Image, error) {
+	if opts.Size.X <= 2*opts.Padding || opts.Size.Y <= 2*opts.Padding {
+		return nil, fmt.Errorf("warp size %v too small for padding %d", opts.Size, opts.Padding)
+	}
+	var fill color.RGBA
+	if opts.Fill != nil {
+		if len(opts.Fill) != 3 {
+			return nil, fmt.Errorf("fill must have 3 elements: found %d", len(opts.Fill))
+		}
+		fill = color.RGBA{clampUint8(opts.Fill[0]), clampUint8(opts.Fill[1]), clampUint8(opts.Fill[2]), 255}
+	}
+	ims := make([]image.Image, len(boxes))
+	for i, box := range boxes {
+		if box.Empty() {
+			return nil, fmt.Errorf("box %d is empty: %v", i, box)
+		}
+		// Expand the box so that it occupies the size minus the padding.
+		var (
+			px = float64(opts.Padding) * float64(box.Dx()) / float64(opts.Size.X-2*opts.Padding)
+			py = float64(opts.Padding) * float64(box.Dy()) / float64(opts.Size.Y-2*opts.Padding)
+		)
+		r := image.Rect(
+			int(math.Floor(float64(box.Min.X)-px)),
+			int(math.Floor(float64(box.Min.Y)-py)),
+			int(math.Ceil(float64(box.Max.X)+px)),
+			int(math.Ceil(float64(box.Max.Y)+py)),
+		)
+		crop := image.NewRGBA(image.Rectangle{Max: r.Size()})
+		draw.Draw(crop, crop.Bounds(), image.NewUniform(fill), image.ZP, draw.Src)
+		draw.Draw(crop, crop.Bounds(), im, im.Bounds().Min.Add(r.Min), draw.Src)
+		ims[i] = Resize(crop, opts.Size)
+	}
+	return ims, nil
+}
+
+// WarpedFeatures computes a feature vector for each box
+// from a warped crop of the image.
+// All crops are computed in one batch.
+func (phi *Feature) WarpedFeatures(im image.Image, boxes []image.Rectangle, opts WarpOptions) ([][]float64, error) {
+	if opts.Size == (image.Point{}) {
+		in, err := InputShape(phi.Model)
+		if err != nil {
+			return nil, fmt.Errorf("warp size: %v", err)
+		}
+		opts.Size = in.Size()
+	}
+	return warpedFeatures(phi.Map, im, boxes, opts)
+}
+
+// NativeWarpedFeatures computes a feature vector for each box
+// from a warped crop of the image using a transform from FromProto.
+// The size in opts must be set.
+func NativeWarpedFeatures(phi featset.Image, im image.Image, boxes []image.Rectangle, opts WarpOptions) ([][]float64, error) {
+	return warpedFeatures(ApplyEach(phi), im, boxes, opts)
+}
+
+func warpedFeatures(mapAll func([]image.Image) ([]*rimg64.Multi, error), im image.Image, boxes []image.Rectangle, opts WarpOptions) ([][]float64, error) {
+	crops, err := WarpBoxes(im, boxes, opts)
+	if err != nil {
+		return nil, err
+	}
+	feats, err := mapAll(crops)
+	if err != nil {
+		return nil, err
+	}
+	vecs := make([][]float64, len(feats))
+	for i, f := range feats {
+		vecs[i] = flattenMulti(f)
+	}
+	return vecs, nil
+}
+
+// flattenMulti returns the elements of a feature map in Caffe order:
+// channel, then row, then column.
+func flattenMulti(f *rimg64.Multi) []float64 {
+	x := make([]float64, 0, f.Width*f.Height*f.Channels)
+	for k := 0; k < f.Channels; k++ {
+		for v := 0; v < f.Height; v++ {
+			for u := 0; u < f.Width; u++ {
+				x = append(x, f.At(u, v, k))
+			}
+		}
+	}
+	return x
+}
+
+// SPPFeatures computes the feature once for the whole image
+// and max-pools the region of each box over a spatial pyramid.
+func (phi *Feature) SPPFeatures(im image.Image, boxes []image.Rectangle, levels []int) ([][]float64, error) {
+	rate, field, err := layerGeometry(phi.Model, phi.Layer)
+	if err != nil {
+		return nil, err
+	}
+	feat, err := phi.Apply(im)
+	if err != nil {
+		return nil, err
+	}
+	return PoolBoxes(feat, FeatTransform{ScaleX: 1, ScaleY: 1, Rate: rate, Field: field}, boxes, levels)
+}
+
+// NativeSPPFeatures is like SPPFeatures for a transform from FromProto.
+// The network and layer give the rate and receptive field.
+func NativeSPPFeatures(phi featset.Image, net *NetParameter, layer string, im image.Image, boxes []image.Rectangle, levels []int) ([][]float64, error) {
+	rate, field, err := layerGeometry(net, layer)
+	if err != nil {
+		return nil, err
+	}
+	feat, err := phi.Apply(im)
+	if err != nil {
+		return nil, err
+	}
+	return PoolBoxes(feat, FeatTransform{ScaleX: 1, ScaleY: 1, Rate: rate, Field: field}, boxes, levels)
+}
+
+// PoolBoxes max-pools the features whose receptive fields are centered
+// in each box, as in spatial pyramid pooling.
+// At a level of size n, the region is divided into n x n bins.
+// The vector contains the levels in order,
+// each with the bins of every channel in Caffe order.
+func PoolBoxes(feat *rimg64.Multi, t FeatTransform, boxes []image.Rectangle, levels []int) ([][]float64, error) {
+	if feat.Width == 0 || feat.Height == 0 {
+		return nil, fmt.Errorf("empty feature map")
+	}
+	var n int
+	for _, l := range levels {
+		if l < 1 {
+			return nil, fmt.Errorf("invalid pyramid level: %d", l)
+		}
+		n += l * l * feat.Channels
+	}
+	clamp := func(p image.Point) image.Point {
+		return image.Pt(clampInt(p.X, 0, feat.Width-1), clampInt(p.Y, 0, feat.Height-1))
+	}
+	vecs := make([][]float64, len(boxes))
+	for i, box := range boxes {
+		if box.Empty() {
+			return nil, fmt.Errorf("box %d is empty: %v", i, box)
+		}
+		lo := clamp(t.Feat(box.Min))
+		hi := clamp(t.Feat(box.Max.Sub(image.Pt(1, 1))))
+		region := image.Rectangle{lo, hi.Add(image.Pt(1, 1))}.Canon()
+		x := make([]float64, 0, n)
+		for _, l := range levels {
+			for k := 0; k < feat.Channels; k++ {
+				for bv := 0; bv < l; bv++ {
+					for bu := 0; bu < l; bu++ {
+						x = append(x, maxInBin(feat, region, l, bu, bv, k))
+					}
+				}
+			}
+		}
+		vecs[i] = x
+	}
+	return vecs, nil
+}
+
+// maxInBin gives the maximum of channel k in bin (bu, bv)
+// when the region is divided into n x n bins.
+// Bins overlap when the region is not a multiple of n
+// and are never empty.
+func maxInBin(feat *rimg64.Multi, region image.Rectangle, n, bu, bv, k int) float64 {
+	var (
+		w, h = region.Dx(), region.Dy()
+		u0   = region.Min.X + bu*w/n
+		u1   = region.Min.X + ((bu+1)*w+n-1)/n
+		v0   = region.Min.Y + bv*h/n
+		v1   = region.Min.Y + ((bv+1)*h+n-1)/n
+	)
+	if u1 <= u0 {
+		u1 = u0 + 1
+	}
+	if v1 <= v0 {
+		v1 = v0 + 1
+	}
+	y := math.Inf(-1)
+	for u := u0; u < u1 && u < region.Max.X; u++ {
+		for v := v0; v < v1 && v < region.Max.Y; v++ {
+			y = math.Max(y, feat.At(u, v, k))
+		}
+	}
+	return y
+}
+
+func clampInt(x, a, b int) int {
+	if x < a {
+		return a
+	}
+	if x > b {
+		return b
+	}
+	return x
+}
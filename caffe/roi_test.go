@@ -0,0 +1,195 @@
+package caffe
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// coordImage gives each pixel the color (x, y, 0) relative to the bounds.
+func coordImage(r image.Rectangle) *image.RGBA {
+	im := image.NewRGBA(r)
+	for x := r.Min.X; x < r.Max.X; x++ {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			im.SetRGBA(x, y, color.RGBA{uint8(x - r.Min.X), uint8(y - r.Min.Y), 0, 255})
+		}
+	}
+	return im
+}
+
+func TestWarpBoxes(t *testing.T) {
+	// The image does not start at the origin.
+	im := coordImage(image.Rect(5, 7, 45, 37))
+	fill := color.RGBA{1, 2, 3, 255}
+	opts := WarpOptions{Size: image.Pt(14, 14), Padding: 2, Fill: []float64{1, 2, 3}}
+	cases := []struct {
+		Box image.Rectangle
+		// Region of the image in the crop before resizing.
+		Want image.Rectangle
+	}{
+		{image.Rect(10, 10, 20, 20), image.Rect(8, 8, 22, 22)},
+		// The context is outside the image.
+		{image.Rect(0, 0, 10, 10), image.Rect(-2, -2, 12, 12)},
+		// The context is scaled with the box.
+		{image.Rect(10, 10, 20, 15), image.Rect(8, 9, 22, 16)},
+		{image.Rect(3, 4, 8, 24), image.Rect(2, 0, 9, 28)},
+	}
+	for _, c := range cases {
+		crops, err := WarpBoxes(im, []image.Rectangle{c.Box}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := image.NewRGBA(image.Rectangle{Max: c.Want.Size()})
+		for x := 0; x < c.Want.Dx(); x++ {
+			for y := 0; y < c.Want.Dy(); y++ {
+				p := c.Want.Min.Add(image.Pt(x, y))
+				if p.In(image.Rect(0, 0, 40, 30)) {
+					want.SetRGBA(x, y, color.RGBA{uint8(p.X), uint8(p.Y), 0, 255})
+				} else {
+					want.SetRGBA(x, y, fill)
+				}
+			}
+		}
+		if !reflect.DeepEqual(crops[0], Resize(want, opts.Size)) {
+			t.Errorf("box %v: crop differs from region %v", c.Box, c.Want)
+		}
+	}
+
+	errCases := map[string]struct {
+		Box  image.Rectangle
+		Opts WarpOptions
+	}{
+		"empty box":     {image.Rect(3, 3, 3, 8), opts},
+		"large padding": {image.Rect(0, 0, 5, 5), WarpOptions{Size: image.Pt(14, 14), Padding: 7}},
+		"fill":          {image.Rect(0, 0, 5, 5), WarpOptions{Size: image.Pt(14, 14), Fill: []float64{0}}},
+	}
+	for name, c := range errCases {
+		if _, err := WarpBoxes(im, []image.Rectangle{c.Box}, c.Opts); err == nil {
+			t.Errorf("%s: expect error", name)
+		}
+	}
+}
+
+// coordMulti gives each element the value 100*k + 10*u + v.
+func coordMulti(width, height, channels int) *rimg64.Multi {
+	f := rimg64.NewMulti(width, height, channels)
+	for u := 0; u < width; u++ {
+		for v := 0; v < height; v++ {
+			for k := 0; k < channels; k++ {
+				f.Set(u, v, k, float64(100*k+10*u+v))
+			}
+		}
+	}
+	return f
+}
+
+func TestMaxInBin(t *testing.T) {
+	feat := coordMulti(8, 8, 2)
+	cases := []struct {
+		Region       image.Rectangle
+		N, U, V      int
+		K            int
+		WantU, WantV int
+	}{
+		// Width 5 in 2 bins gives [0, 3) and [2, 5).
+		{image.Rect(0, 0, 5, 4), 2, 0, 0, 0, 2, 1},
+		{image.Rect(0, 0, 5, 4), 2, 1, 1, 1, 4, 3},
+		// Offset region.
+		{image.Rect(2, 3, 7, 7), 2, 0, 1, 0, 4, 6},
+		// More bins than features: every bin contains one feature.
+		{image.Rect(3, 3, 4, 4), 3, 0, 0, 0, 3, 3},
+		{image.Rect(3, 3, 4, 4), 3, 2, 2, 1, 3, 3},
+		{image.Rect(0, 0, 2, 2), 3, 1, 1, 0, 1, 1},
+		// Region divisible by the number of bins.
+		{image.Rect(0, 0, 6, 6), 3, 1, 2, 0, 3, 5},
+	}
+	for _, c := range cases {
+		want := float64(100*c.K + 10*c.WantU + c.WantV)
+		if got := maxInBin(feat, c.Region, c.N, c.U, c.V, c.K); got != want {
+			t.Errorf("region %v, %d bins, bin (%d,%d), channel %d: got %g, want %g",
+				c.Region, c.N, c.U, c.V, c.K, got, want)
+		}
+	}
+}
+
+func TestPoolBoxes(t *testing.T) {
+	feat := coordMulti(6, 6, 2)
+	// Feature (i, j) is centered at pixel (2i+2, 2j+2).
+	tr := FeatTransform{ScaleX: 1, ScaleY: 1, Rate: 2, Field: image.Pt(4, 4)}
+	boxes := []image.Rectangle{
+		// Features [0, 5) x [0, 4).
+		image.Rect(2, 2, 10, 8),
+		// Clamped to the whole feature map.
+		image.Rect(-20, -20, 100, 100),
+	}
+	got, err := PoolBoxes(feat, tr, boxes, []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float64{
+		{
+			43, 143,
+			21, 41, 23, 43,
+			121, 141, 123, 143,
+		},
+		{
+			55, 155,
+			22, 52, 25, 55,
+			122, 152, 125, 155,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if _, err := PoolBoxes(feat, tr, boxes, []int{0}); err == nil {
+		t.Error("level 0: expect error")
+	}
+	if _, err := PoolBoxes(feat, tr, []image.Rectangle{image.Rect(4, 4, 4, 9)}, []int{1}); err == nil {
+		t.Error("empty box: expect error")
+	}
+	if _, err := PoolBoxes(rimg64.NewMulti(0, 0, 2), tr, boxes, []int{1}); err == nil {
+		t.Error("empty feature map: expect error")
+	}
+}
+
+// SPP features pool the feature of the whole image
+// using the rate and receptive field of the layer.
+func TestNativeSPPFeatures(t *testing.T) {
+	net := new(NetParameter)
+	if err := proto.UnmarshalText(onnxTestNet, net); err != nil {
+		t.Fatal(err)
+	}
+	randomWeights(t, net)
+	phi, err := FromProto(net, "pool1", []float64{120, 110, 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	im := randomImage(image.Pt(41, 33))
+	boxes := []image.Rectangle{image.Rect(3, 5, 30, 20), image.Rect(10, 0, 41, 33)}
+	levels := []int{1, 2, 3}
+	got, err := NativeSPPFeatures(phi, net, "pool1", im, boxes, levels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feat, err := phi.Apply(im)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// conv1 has stride 2 and kernel 3, pool1 has stride 2 and kernel 2.
+	tr := FeatTransform{ScaleX: 1, ScaleY: 1, Rate: 4, Field: image.Pt(5, 5)}
+	want, err := PoolBoxes(feat, tr, boxes, levels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("features differ from pooling with the geometry of pool1")
+	}
+	if n := (1 + 4 + 9) * feat.Channels; len(got[0]) != n {
+		t.Errorf("got vector of length %d, want %d", len(got[0]), n)
+	}
+}
@@ -0,0 +1,187 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+)
+
+// Shape is the size of a blob for a single image.
+type Shape struct {
+	Channels int `json:"channels"`
+	Height   int `json:"height"`
+	Width    int `json:"width"`
+}
+
+func (s Shape) String() string {
+	return fmt.Sprintf("%dx%dx%d", s.Channels, s.Height, s.Width)
+}
+
+// NumElems returns the number of elements in the blob.
+func (s Shape) NumElems() int {
+	return s.Channels * s.Height * s.Width
+}
+
+// Size returns the spatial dimensions of the blob.
+func (s Shape) Size() image.Point {
+	return image.Pt(s.Width, s.Height)
+}
+
+// InputShape returns the shape of the first network input from input_dim.
+func InputShape(net *NetParameter) (Shape, error) {
+	if len(net.InputDim) < 4 {
+		return Shape{}, fmt.Errorf("input_dim has %d elements, need 4", len(net.InputDim))
+	}
+	dims := net.InputDim
+	return Shape{Channels: int(dims[1]), Height: int(dims[2]), Width: int(dims[3])}, nil
+}
+
+// InferShapes computes the shape of every blob in the network
+// given the shape of the input.
+func InferShapes(net *NetParameter, in Shape) (map[string]Shape, error) {
+	if len(net.Input) != 1 {
+		return nil, fmt.Errorf("number of network inputs is not 1: %d", len(net.Input))
+	}
+	shapes := map[string]Shape{net.Input[0]: in}
+	for _, layer := range net.Layers {
+		bottoms := make([]Shape, len(layer.Bottom))
+		for i, name := range layer.Bottom {
+			s, ok := shapes[name]
+			if !ok {
+				return nil, fmt.Errorf("layer %s: bottom not found: %s", layer.GetName(), name)
+			}
+			bottoms[i] = s
+		}
+		out, err := outputShape(layer, bottoms)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %v", layer.GetName(), err)
+		}
+		for _, top := range layer.Top {
+			shapes[top] = out
+		}
+	}
+	return shapes, nil
+}
+
+// outputShape gives the shape of the tops of a layer.
+// All tops of a layer have the same shape.
+func outputShape(layer *LayerParameter, in []Shape) (Shape, error) {
+	if len(in) == 0 {
+		return Shape{}, fmt.Errorf("no inputs")
+	}
+	switch t := layer.GetType(); t {
+	case LayerParameter_CONVOLUTION:
+		param := layer.GetConvolutionParam()
+		if param == nil {
+			return Shape{}, fmt.Errorf("no convolution_param")
+		}
+		size, err := convOutputSize(in[0].Size(), param.Kernel(), param.Strides(), param.Padding(), false)
+		if err != nil {
+			return Shape{}, err
+		}
+		return Shape{Channels: int(param.GetNumOutput()), Height: size.Y, Width: size.X}, nil
+	case LayerParameter_POOLING:
+		param := layer.GetPoolingParam()
+		if param == nil {
+			return Shape{}, fmt.Errorf("no pooling_param")
+		}
+		size, err := convOutputSize(in[0].Size(), param.Kernel(), param.Strides(), param.Padding(), true)
+		if err != nil {
+			return Shape{}, err
+		}
+		return Shape{Channels: in[0].Channels, Height: size.Y, Width: size.X}, nil
+	case LayerParameter_INNER_PRODUCT:
+		param := layer.GetInnerProductParam()
+		if param == nil {
+			return Shape{}, fmt.Errorf("no inner_product_param")
+		}
+		return Shape{Channels: int(param.GetNumOutput()), Height: 1, Width: 1}, nil
+	case LayerParameter_FLATTEN:
+		return Shape{Channels: in[0].NumElems(), Height: 1, Width: 1}, nil
+	case LayerParameter_CONCAT:
+		out := in[0]
+		for _, s := range in[1:] {
+			if s.Size() != out.Size() {
+				return Shape{}, fmt.Errorf("concat inputs differ in size: %v, %v", out, s)
+			}
+			out.Channels += s.Channels
+		}
+		return out, nil
+	case LayerParameter_ELTWISE:
+		for _, s := range in[1:] {
+			if s != in[0] {
+				return Shape{}, fmt.Errorf("eltwise inputs differ in shape: %v, %v", in[0], s)
+			}
+		}
+		return in[0], nil
+	case LayerParameter_RELU, LayerParameter_LRN, LayerParameter_DROPOUT,
+		LayerParameter_SOFTMAX, LayerParameter_SIGMOID, LayerParameter_TANH,
+		LayerParameter_POWER, LayerParameter_ABSVAL, LayerParameter_BNLL,
+		LayerParameter_SPLIT, LayerParameter_MVN, LayerParameter_THRESHOLD:
+		return in[0], nil
+	default:
+		return Shape{}, fmt.Errorf("unknown layer type: %s", t.String())
+	}
+}
+
+// convOutputSize computes the output size of a convolution or pooling.
+// Convolution rounds down whereas pooling rounds up.
+func convOutputSize(in, kernel, stride, pad image.Point, ceil bool) (image.Point, error) {
+	if kernel.X <= 0 || kernel.Y <= 0 {
+		return image.Point{}, fmt.Errorf("kernel size not positive: %v", kernel)
+	}
+	if stride.X <= 0 || stride.Y <= 0 {
+		return image.Point{}, fmt.Errorf("stride not positive: %v", stride)
+	}
+	n := in.Add(pad.Mul(2)).Sub(kernel)
+	if n.X < 0 || n.Y < 0 {
+		return image.Point{}, fmt.Errorf("kernel %v larger than padded input %v", kernel, in.Add(pad.Mul(2)))
+	}
+	if ceil {
+		out := image.Pt(ceilDiv(n.X, stride.X)+1, ceilDiv(n.Y, stride.Y)+1)
+		// Caffe ensures that the last window starts inside the image.
+		if pad.X > 0 && (out.X-1)*stride.X >= in.X+pad.X {
+			out.X--
+		}
+		if pad.Y > 0 && (out.Y-1)*stride.Y >= in.Y+pad.Y {
+			out.Y--
+		}
+		return out, nil
+	}
+	return image.Pt(n.X/stride.X+1, n.Y/stride.Y+1), nil
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+func (param ConvolutionParameter) Strides() image.Point {
+	if param.StrideH != nil || param.StrideW != nil {
+		return image.Pt(int(param.GetStrideW()), int(param.GetStrideH()))
+	}
+	s := int(param.GetStride())
+	return image.Pt(s, s)
+}
+
+func (param ConvolutionParameter) Padding() image.Point {
+	if param.PadH != nil || param.PadW != nil {
+		return image.Pt(int(param.GetPadW()), int(param.GetPadH()))
+	}
+	p := int(param.GetPad())
+	return image.Pt(p, p)
+}
+
+func (param PoolingParameter) Strides() image.Point {
+	if param.StrideH != nil || param.StrideW != nil {
+		return image.Pt(int(param.GetStrideW()), int(param.GetStrideH()))
+	}
+	s := int(param.GetStride())
+	return image.Pt(s, s)
+}
+
+func (param PoolingParameter) Padding() image.Point {
+	if param.PadH != nil || param.PadW != nil {
+		return image.Pt(int(param.GetPadW()), int(param.GetPadH()))
+	}
+	p := int(param.GetPad())
+	return image.Pt(p, p)
+}
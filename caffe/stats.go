@@ -0,0 +1,205 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+)
+
+// BlobStats summarizes the values of a blob.
+// Mean, standard deviation, minimum and maximum
+// are computed over the finite elements.
+type BlobStats struct {
+	Dims                BlobDims
+	Count               int
+	Mean, Std, Min, Max float64
+	// Fraction of elements which are exactly zero.
+	Sparsity float64
+	NaN, Inf int
+}
+
+// ComputeBlobStats summarizes the data of a blob.
+func ComputeBlobStats(blob *BlobProto) BlobStats {
+	s := BlobStats{Dims: blobDims(blob), Count: len(blob.Data)}
+	var (
+		n, zeros    int
+		sum, sumSqr float64
+		first       = true
+	)
+	for _, v := range blob.Data {
+		x := float64(v)
+		switch {
+		case math.IsNaN(x):
+			s.NaN++
+			continue
+		case math.IsInf(x, 0):
+			s.Inf++
+			continue
+		}
+		if x == 0 {
+			zeros++
+		}
+		if first {
+			s.Min, s.Max = x, x
+			first = false
+		}
+		s.Min = math.Min(s.Min, x)
+		s.Max = math.Max(s.Max, x)
+		sum += x
+		sumSqr += x * x
+		n++
+	}
+	if n > 0 {
+		s.Mean = sum / float64(n)
+		s.Std = math.Sqrt(math.Max(0, sumSqr/float64(n)-s.Mean*s.Mean))
+	}
+	if s.Count > 0 {
+		s.Sparsity = float64(zeros) / float64(s.Count)
+	}
+	return s
+}
+
+// DeadFilters returns the indices of the filters in the weights of a layer
+// whose elements are all at most eps in magnitude.
+// Filters are taken along the num dimension for convolutions
+// and along the rows for inner products.
+// Returns nil for other layers.
+func DeadFilters(layer *LayerParameter, eps float64) []int {
+	if len(layer.Blobs) == 0 {
+		return nil
+	}
+	blob := layer.Blobs[0]
+	n, size := filterLayout(layer.GetType(), blobDims(blob))
+	if n*size != len(blob.Data) || size == 0 {
+		return nil
+	}
+	var dead []int
+	for i := 0; i < n; i++ {
+		isDead := true
+		for _, v := range blob.Data[i*size : (i+1)*size] {
+			if !(math.Abs(float64(v)) <= eps) {
+				isDead = false
+				break
+			}
+		}
+		if isDead {
+			dead = append(dead, i)
+		}
+	}
+	return dead
+}
+
+// filterLayout gives the number of filters and the size of each.
+func filterLayout(t LayerParameter_LayerType, dims BlobDims) (n, size int) {
+	switch t {
+	case LayerParameter_CONVOLUTION:
+		return dims.Out, dims.In * dims.Height * dims.Width
+	case LayerParameter_INNER_PRODUCT:
+		// The weights of old models have dimensions 1x1xNxK.
+		if dims.Out > 1 {
+			return dims.Out, dims.In * dims.Height * dims.Width
+		}
+		return dims.In * dims.Height, dims.Width
+	default:
+		return 0, 0
+	}
+}
+
+// Histogram counts the finite values of a blob in equal-width bins.
+type Histogram struct {
+	Min, Max float64
+	Counts   []int
+}
+
+// NewHistogram computes a histogram with the given number of bins
+// over the range of the finite values.
+func NewHistogram(data []float32, bins int) *Histogram {
+	h := &Histogram{Min: math.Inf(1), Max: math.Inf(-1), Counts: make([]int, bins)}
+	for _, v := range data {
+		x := float64(v)
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			continue
+		}
+		h.Min = math.Min(h.Min, x)
+		h.Max = math.Max(h.Max, x)
+	}
+	if h.Min > h.Max {
+		h.Min, h.Max = 0, 0
+		return h
+	}
+	for _, v := range data {
+		x := float64(v)
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			continue
+		}
+		h.Counts[h.bin(x)]++
+	}
+	return h
+}
+
+func (h *Histogram) bin(x float64) int {
+	if h.Max == h.Min {
+		return 0
+	}
+	i := int(float64(len(h.Counts)) * (x - h.Min) / (h.Max - h.Min))
+	if i >= len(h.Counts) {
+		i = len(h.Counts) - 1
+	}
+	return i
+}
+
+func (h *Histogram) maxCount() int {
+	var m int
+	for _, c := range h.Counts {
+		if c > m {
+			m = c
+		}
+	}
+	return m
+}
+
+// WriteText draws the histogram as one line per bin
+// with bars of at most width characters.
+func (h *Histogram) WriteText(w io.Writer, width int) error {
+	m := h.maxCount()
+	step := (h.Max - h.Min) / float64(len(h.Counts))
+	for i, c := range h.Counts {
+		var n int
+		if m > 0 {
+			n = int(math.Ceil(float64(width) * float64(c) / float64(m)))
+		}
+		lo := h.Min + float64(i)*step
+		_, err := fmt.Fprintf(w, "%12.4g %8d %s\n", lo, c, strings.Repeat("#", n))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Image draws the histogram as a bar chart.
+// Each bin is at least one pixel wide.
+func (h *Histogram) Image(width, height int) image.Image {
+	if width < len(h.Counts) {
+		width = len(h.Counts)
+	}
+	im := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range im.Pix {
+		im.Pix[i] = 255
+	}
+	m := h.maxCount()
+	if m == 0 {
+		return im
+	}
+	for x := 0; x < width; x++ {
+		c := h.Counts[x*len(h.Counts)/width]
+		bar := int(math.Ceil(float64(height) * float64(c) / float64(m)))
+		for y := height - bar; y < height; y++ {
+			im.SetGray(x, y, color.Gray{0})
+		}
+	}
+	return im
+}
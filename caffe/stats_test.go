@@ -0,0 +1,51 @@
+package caffe
+
+import (
+	"reflect"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+func TestDeadFilters(t *testing.T) {
+	blob := func(out, in, height, width int) *BlobProto {
+		b := &BlobProto{
+			Num:      proto.Int32(int32(out)),
+			Channels: proto.Int32(int32(in)),
+			Height:   proto.Int32(int32(height)),
+			Width:    proto.Int32(int32(width)),
+			Data:     make([]float32, out*in*height*width),
+		}
+		for i := range b.Data {
+			b.Data[i] = 1
+		}
+		return b
+	}
+	zero := func(b *BlobProto, i, size int) *BlobProto {
+		for j := i * size; j < (i+1)*size; j++ {
+			b.Data[j] = 0
+		}
+		return b
+	}
+	layer := func(t LayerParameter_LayerType, b *BlobProto) *LayerParameter {
+		return &LayerParameter{Type: t.Enum(), Blobs: []*BlobProto{b}}
+	}
+	cases := []struct {
+		Name  string
+		Layer *LayerParameter
+		Want  []int
+	}{
+		{"conv", layer(LayerParameter_CONVOLUTION, zero(blob(4, 3, 2, 2), 2, 12)), []int{2}},
+		// A single filter is not taken as rows.
+		{"conv with one output", layer(LayerParameter_CONVOLUTION, zero(blob(1, 3, 2, 2), 0, 12)), []int{0}},
+		{"conv with one live output", layer(LayerParameter_CONVOLUTION, zero(blob(1, 3, 2, 2), 0, 4)), nil},
+		{"old inner product", layer(LayerParameter_INNER_PRODUCT, zero(blob(1, 1, 5, 6), 3, 6)), []int{3}},
+		{"inner product", layer(LayerParameter_INNER_PRODUCT, zero(blob(5, 6, 1, 1), 1, 6)), []int{1}},
+		{"no blobs", &LayerParameter{Type: LayerParameter_CONVOLUTION.Enum()}, nil},
+	}
+	for _, c := range cases {
+		if got := DeadFilters(c.Layer, 0); !reflect.DeepEqual(got, c.Want) {
+			t.Errorf("%s: got %v, want %v", c.Name, got, c.Want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+)
+
+// LayerSummary describes the output and cost of a layer for one image.
+type LayerSummary struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Output Shape  `json:"output"`
+	// Rate and receptive field with respect to the input.
+	// Zero if they are not defined for the layer.
+	Rate  int         `json:"rate,omitempty"`
+	Field image.Point `json:"field"`
+	// Number of parameters.
+	Params int `json:"params"`
+	// Number of multiply-adds.
+	MACs int64 `json:"macs"`
+	// Bytes of activations which the layer allocates (single precision).
+	// In-place layers do not allocate.
+	Memory int64 `json:"memory"`
+}
+
+// Summary describes the cost of a network for one image.
+type Summary struct {
+	Input  Shape          `json:"input"`
+	Layers []LayerSummary `json:"layers"`
+	Params int            `json:"params"`
+	MACs   int64          `json:"macs"`
+	Memory int64          `json:"memory"`
+}
+
+// Summarize computes the output shape and cost of every layer.
+// The network's input_dim is replaced by the given input shape.
+// If the layers have blobs, parameters are counted from the blobs.
+func Summarize(net *NetParameter, in Shape) (*Summary, error) {
+	if len(net.Input) != 1 {
+		return nil, fmt.Errorf("number of network inputs is not 1: %d", len(net.Input))
+	}
+	sized := new(NetParameter)
+	*sized = *net
+	sized.InputDim = []int32{1, int32(in.Channels), int32(in.Height), int32(in.Width)}
+	shapes, err := InferShapes(sized, in)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Summary{Input: in}
+	s.Memory = int64(in.NumElems()) * 4
+	for _, layer := range sized.Layers {
+		if len(layer.Bottom) == 0 || len(layer.Top) == 0 {
+			continue
+		}
+		var (
+			bottom = shapes[layer.Bottom[0]]
+			top    = shapes[layer.Top[0]]
+		)
+		l := LayerSummary{
+			Name:   layer.GetName(),
+			Type:   layer.GetType().String(),
+			Output: top,
+			Params: numParams(layer, bottom),
+			MACs:   numMACs(layer, bottom, top),
+		}
+		if !isInPlace(layer) {
+			l.Memory = int64(top.NumElems()) * 4 * int64(len(layer.Top))
+		}
+		if rate, field, err := layerGeometry(sized, layer.GetName()); err == nil {
+			l.Rate, l.Field = rate, field
+		}
+		s.Layers = append(s.Layers, l)
+		s.Params += l.Params
+		s.MACs += l.MACs
+		s.Memory += l.Memory
+	}
+	return s, nil
+}
@@ -0,0 +1,99 @@
+package caffe
+
+import (
+	"fmt"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+// Convolutionalize returns a copy of the network
+// in which every inner product layer is replaced by a convolution
+// so that the network can be applied to larger images
+// to give a dense map of outputs.
+// The kernel of each convolution is the size of the layer's input
+// when the network is given an input of shape in.
+// Flatten layers are removed.
+// Blobs are reshaped but their data is unchanged,
+// since both layers store weights in (output, channel, row, column) order.
+func Convolutionalize(net *NetParameter, in Shape) (*NetParameter, error) {
+	shapes, err := InferShapes(net, in)
+	if err != nil {
+		return nil, err
+	}
+	dst := proto.Clone(net).(*NetParameter)
+	// Blobs which were renamed by removing a flatten layer.
+	rename := make(map[string]string)
+	var layers []*LayerParameter
+	for _, layer := range dst.Layers {
+		for i, bottom := range layer.Bottom {
+			if s, ok := rename[bottom]; ok {
+				layer.Bottom[i] = s
+			}
+		}
+		switch layer.GetType() {
+		case LayerParameter_FLATTEN:
+			if err := errIfNotOneInput(layer); err != nil {
+				return nil, fmt.Errorf("layer %s: %v", layer.GetName(), err)
+			}
+			for _, top := range layer.Top {
+				rename[top] = layer.Bottom[0]
+			}
+			continue
+		case LayerParameter_INNER_PRODUCT:
+			if err := errIfNotOneInput(layer); err != nil {
+				return nil, fmt.Errorf("layer %s: %v", layer.GetName(), err)
+			}
+			// The bottom has been renamed to the input of any flatten layer,
+			// whose shape is the kernel size.
+			if err := ipToConv(layer, shapes[layer.Bottom[0]]); err != nil {
+				return nil, fmt.Errorf("layer %s: %v", layer.GetName(), err)
+			}
+		}
+		// In-place layers may operate on a renamed blob.
+		for i, top := range layer.Top {
+			if s, ok := rename[top]; ok {
+				layer.Top[i] = s
+			}
+		}
+		layers = append(layers, layer)
+	}
+	dst.Layers = layers
+	return dst, nil
+}
+
+// ipToConv rewrites an inner product layer with input of shape in
+// as a convolution.
+func ipToConv(layer *LayerParameter, in Shape) error {
+	ip := layer.GetInnerProductParam()
+	out := ip.GetNumOutput()
+	conv := &ConvolutionParameter{
+		NumOutput:    proto.Uint32(out),
+		BiasTerm:     ip.BiasTerm,
+		WeightFiller: ip.WeightFiller,
+		BiasFiller:   ip.BiasFiller,
+	}
+	if in.Width == in.Height {
+		conv.KernelSize = proto.Uint32(uint32(in.Width))
+	} else {
+		conv.KernelH = proto.Uint32(uint32(in.Height))
+		conv.KernelW = proto.Uint32(uint32(in.Width))
+	}
+	if len(layer.Blobs) > 0 {
+		weights := layer.Blobs[0]
+		want := BlobDims{Width: in.NumElems(), Height: int(out), In: 1, Out: 1}
+		if err := errIfDimsNotEq(want, blobDims(weights)); err != nil {
+			return err
+		}
+		if err := errIfWrongNumElems(want, weights); err != nil {
+			return err
+		}
+		weights.Num = proto.Int32(int32(out))
+		weights.Channels = proto.Int32(int32(in.Channels))
+		weights.Height = proto.Int32(int32(in.Height))
+		weights.Width = proto.Int32(int32(in.Width))
+	}
+	layer.Type = LayerParameter_CONVOLUTION.Enum()
+	layer.InnerProductParam = nil
+	layer.ConvolutionParam = conv
+	return nil
+}
@@ -0,0 +1,145 @@
+package caffe
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+const surgeryTestNet = `
+name: "SurgeryNet"
+input: "data"
+input_dim: 1 input_dim: 3 input_dim: 8 input_dim: 8
+layers { name: "conv1" type: CONVOLUTION bottom: "data" top: "conv1"
+  convolution_param { num_output: 4 kernel_size: 3 } }
+layers { name: "relu1" type: RELU bottom: "conv1" top: "conv1" }
+layers { name: "pool1" type: POOLING bottom: "conv1" top: "pool1"
+  pooling_param { pool: MAX kernel_size: 2 stride: 2 } }
+layers { name: "flat1" type: FLATTEN bottom: "pool1" top: "flat1" }
+layers { name: "fc1" type: INNER_PRODUCT bottom: "flat1" top: "fc1"
+  inner_product_param { num_output: 5 } }
+layers { name: "relu2" type: RELU bottom: "fc1" top: "fc1" }
+layers { name: "fc2" type: INNER_PRODUCT bottom: "fc1" top: "fc2"
+  inner_product_param { num_output: 2 } }
+`
+
+// The convolutionalized network must give the same output
+// as the original network on an image of the input size,
+// and the same output as the original on each window of a larger image.
+func TestConvolutionalize(t *testing.T) {
+	net := new(NetParameter)
+	if err := proto.UnmarshalText(surgeryTestNet, net); err != nil {
+		t.Fatal(err)
+	}
+	randomWeights(t, net)
+	in, err := InputShape(net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, err := Convolutionalize(net, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, layer := range conv.Layers {
+		if layer.GetType() == LayerParameter_FLATTEN {
+			t.Errorf("flatten layer not removed: %s", layer.GetName())
+		}
+	}
+	if got := layerByName(conv, "fc1").GetConvolutionParam().GetKernelSize(); got != 3 {
+		t.Errorf("fc1: got kernel size %d, want 3", got)
+	}
+
+	// The original network is evaluated with the inner products computed here,
+	// taking the input in Caffe order: channel, row, column.
+	mean := []float64{120, 110, 100}
+	pool, err := FromProto(net, "pool1", mean)
+	if err != nil {
+		t.Fatal(err)
+	}
+	innerProduct := func(layer string, x []float64) []float64 {
+		blobs := layerByName(net, layer).Blobs
+		w, b := blobs[0].Data, blobs[1].Data
+		y := make([]float64, len(b))
+		for i := range y {
+			y[i] = float64(b[i])
+			for j, xj := range x {
+				y[i] += float64(w[i*len(x)+j]) * xj
+			}
+		}
+		return y
+	}
+	original := func(im image.Image) []float64 {
+		f, err := pool.Apply(im)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var x []float64
+		for k := 0; k < f.Channels; k++ {
+			for v := 0; v < f.Height; v++ {
+				for u := 0; u < f.Width; u++ {
+					x = append(x, f.At(u, v, k))
+				}
+			}
+		}
+		y := innerProduct("fc1", x)
+		for i := range y {
+			y[i] = math.Max(0, y[i])
+		}
+		return innerProduct("fc2", y)
+	}
+	psi, err := FromProto(conv, "fc2", mean)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	im := randomImage(image.Pt(8, 8))
+	want := original(im)
+	got, err := psi.Apply(im)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := got.Size(); !size.Eq(image.Pt(1, 1)) || got.Channels != len(want) {
+		t.Fatalf("input size: got %v with %d channels, want (1,1) with %d", size, got.Channels, len(want))
+	}
+	for k, wk := range want {
+		if d := math.Abs(wk - got.At(0, 0, k)); d > 1e-9 {
+			t.Errorf("input size, channel %d: want %g, got %g", k, wk, got.At(0, 0, k))
+		}
+	}
+
+	// The dense output has a rate of 2.
+	large := randomImage(image.Pt(12, 10)).(*image.RGBA)
+	dense, err := psi.Apply(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := dense.Size(); !size.Eq(image.Pt(3, 2)) {
+		t.Fatalf("dense output: got size %v, want (3,2)", size)
+	}
+	for x := 0; x < dense.Width; x++ {
+		for y := 0; y < dense.Height; y++ {
+			r := image.Rect(0, 0, 8, 8).Add(image.Pt(2*x, 2*y))
+			want := original(large.SubImage(r))
+			for k := 0; k < dense.Channels; k++ {
+				if d := math.Abs(want[k] - dense.At(x, y, k)); d > 1e-9 {
+					t.Errorf("dense output at (%d,%d,%d): want %g, got %g", x, y, k, want[k], dense.At(x, y, k))
+				}
+			}
+		}
+	}
+}
+
+func closeMulti(a, b *rimg64.Multi, eps float64) bool {
+	if a.Width != b.Width || a.Height != b.Height || a.Channels != b.Channels {
+		return false
+	}
+	for i := range a.Elems {
+		if math.Abs(a.Elems[i]-b.Elems[i]) > eps {
+			return false
+		}
+	}
+	return true
+}
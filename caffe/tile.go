@@ -0,0 +1,230 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"sync"
+
+	"github.com/jvlmdr/go-cv/featset"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// TileOptions describes how a large image is divided into tiles.
+type TileOptions struct {
+	// Maximum size of each tile in pixels.
+	// The last tile in each row and column may exceed it
+	// by less than the rate of the layer.
+	// It must be at least the receptive field of the layer.
+	MaxSize image.Point
+	// Number of tiles which are processed concurrently.
+	// If zero, tiles are processed one at a time.
+	Workers int
+}
+
+// Tile is a region of the image and the position of its features
+// in the feature map of the whole image.
+type Tile struct {
+	Pixels image.Rectangle
+	Feat   image.Point
+	// Number of features in the tile, or zero in the last row or column,
+	// where it is given by the image.
+	Size image.Point
+}
+
+// Tiles divides an image into tiles which overlap by the receptive field
+// minus the rate, so that every feature is computed by exactly one tile.
+// Tiles start at multiples of the rate so that the strides of all layers
+// are aligned with the whole image.
+// The last tile in each row and column extends to the edge of the image.
+func Tiles(size image.Point, rate int, field, maxSize image.Point) ([]Tile, error) {
+	if maxSize.X < field.X || maxSize.Y < field.Y {
+		return nil, fmt.Errorf("tile size %v smaller than receptive field %v", maxSize, field)
+	}
+	var (
+		xs, nx = tileStarts(size.X, rate, field.X, maxSize.X)
+		ys, ny = tileStarts(size.Y, rate, field.Y, maxSize.Y)
+		tiles  []Tile
+	)
+	for j, y := range ys {
+		for i, x := range xs {
+			t := Tile{Feat: image.Pt(x, y)}
+			t.Pixels.Min = t.Feat.Mul(rate)
+			t.Pixels.Max = size
+			if i < len(xs)-1 {
+				t.Size.X = nx
+				t.Pixels.Max.X = (x+nx-1)*rate + field.X
+			}
+			if j < len(ys)-1 {
+				t.Size.Y = ny
+				t.Pixels.Max.Y = (y+ny-1)*rate + field.Y
+			}
+			tiles = append(tiles, t)
+		}
+	}
+	return tiles, nil
+}
+
+// tileStarts gives the index of the first feature of each tile along one axis
+// and the number of features in every tile but the last.
+func tileStarts(size, rate, field, maxSize int) ([]int, int) {
+	n := (maxSize-field)/rate + 1
+	starts := []int{0}
+	// Start another tile while it would contain at least one whole field.
+	for a := n; a*rate+field <= size; a += n {
+		starts = append(starts, a)
+	}
+	return starts, n
+}
+
+// ApplyTiled computes a feature of a large image one tile at a time
+// and stitches the results together.
+// The output is identical to applying the feature to the whole image
+// provided that no layer pads its input.
+// At most opts.Workers tiles are held in memory at once.
+func ApplyTiled(apply func(image.Image) (*rimg64.Multi, error), net *NetParameter, layer string, im image.Image, opts TileOptions) (*rimg64.Multi, error) {
+	if err := checkTileable(net, layer); err != nil {
+		return nil, err
+	}
+	rate, field, err := layerGeometry(net, layer)
+	if err != nil {
+		return nil, err
+	}
+	tiles, err := Tiles(im.Bounds().Size(), rate, field, opts.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// The last tile gives the size of the output.
+	last := tiles[len(tiles)-1]
+	f, err := apply(cropImage(im, last.Pixels))
+	if err != nil {
+		return nil, fmt.Errorf("tile %v: %v", last.Pixels, err)
+	}
+	dst := rimg64.NewMulti(last.Feat.X+f.Width, last.Feat.Y+f.Height, f.Channels)
+	if err := pasteTile(dst, f, last); err != nil {
+		return nil, err
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		jobs = make(chan Tile)
+		errs = make(chan error, workers)
+		wg   sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				f, err := apply(cropImage(im, t.Pixels))
+				if err == nil {
+					// Tiles write to disjoint regions of dst.
+					err = pasteTile(dst, f, t)
+				} else {
+					err = fmt.Errorf("tile %v: %v", t.Pixels, err)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(errs)
+	}()
+
+	pending := tiles[:len(tiles)-1]
+	for len(pending) > 0 {
+		select {
+		case jobs <- pending[0]:
+			pending = pending[1:]
+		case err := <-errs:
+			close(jobs)
+			return nil, err
+		}
+	}
+	close(jobs)
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// ApplyTiled computes the feature of a large image in tiles.
+// See the function ApplyTiled.
+func (phi *Feature) ApplyTiled(im image.Image, opts TileOptions) (*rimg64.Multi, error) {
+	return ApplyTiled(phi.Apply, phi.Model, phi.Layer, im, opts)
+}
+
+// NativeApplyTiled computes a feature transform from FromProto in tiles.
+// The network and layer give the rate and receptive field.
+func NativeApplyTiled(phi featset.Image, net *NetParameter, layer string, im image.Image, opts TileOptions) (*rimg64.Multi, error) {
+	return ApplyTiled(phi.Apply, net, layer, im, opts)
+}
+
+// checkTileable returns an error if a feature of part of the image
+// differs from the same part of the feature of the whole image.
+func checkTileable(net *NetParameter, name string) error {
+	if isInput(net, name) {
+		return nil
+	}
+	layer := layerByName(net, name)
+	if layer == nil {
+		return fmt.Errorf("could not find layer: %s", name)
+	}
+	var pad image.Point
+	switch layer.GetType() {
+	case LayerParameter_CONVOLUTION:
+		pad = layer.GetConvolutionParam().Padding()
+	case LayerParameter_POOLING:
+		pad = layer.GetPoolingParam().Padding()
+	case LayerParameter_INNER_PRODUCT, LayerParameter_FLATTEN:
+		return fmt.Errorf("layer %s sees its entire input", name)
+	}
+	if pad != image.ZP {
+		return fmt.Errorf("layer %s has non-zero pad: %v", name, pad)
+	}
+	bottoms := layer.GetBottom()
+	if len(bottoms) != 1 {
+		return fmt.Errorf("layer %s does not have one input: %v", name, bottoms)
+	}
+	return checkTileable(net, bottoms[0])
+}
+
+// cropImage copies a rectangle of the image,
+// given relative to the minimum of its bounds.
+func cropImage(im image.Image, r image.Rectangle) image.Image {
+	dst := image.NewRGBA(image.Rectangle{Max: r.Size()})
+	draw.Draw(dst, dst.Bounds(), im, im.Bounds().Min.Add(r.Min), draw.Src)
+	return dst
+}
+
+// pasteTile copies the features of a tile into the output.
+func pasteTile(dst, f *rimg64.Multi, t Tile) error {
+	size := image.Pt(f.Width, f.Height)
+	want := t.Size
+	if want.X == 0 {
+		want.X = dst.Width - t.Feat.X
+	}
+	if want.Y == 0 {
+		want.Y = dst.Height - t.Feat.Y
+	}
+	if !size.Eq(want) || f.Channels != dst.Channels {
+		return fmt.Errorf("tile %v: want %v x %d features, got %v x %d",
+			t.Pixels, want, dst.Channels, size, f.Channels)
+	}
+	for u := 0; u < f.Width; u++ {
+		for v := 0; v < f.Height; v++ {
+			for k := 0; k < f.Channels; k++ {
+				dst.Set(t.Feat.X+u, t.Feat.Y+v, k, f.At(u, v, k))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package caffe
+
+import (
+	"image"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+// Stitched tiles must be identical to the feature of the whole image.
+func TestApplyTiled(t *testing.T) {
+	net := new(NetParameter)
+	if err := proto.UnmarshalText(onnxTestNet, net); err != nil {
+		t.Fatal(err)
+	}
+	randomWeights(t, net)
+	mean := []float64{120, 110, 100}
+
+	cases := []struct {
+		Size, MaxSize image.Point
+		Workers       int
+	}{
+		{image.Pt(53, 47), image.Pt(15, 12), 3},
+		{image.Pt(40, 40), image.Pt(9, 9), 1},
+		{image.Pt(30, 21), image.Pt(100, 100), 2},
+	}
+	for _, output := range []string{"pool1", "conv2"} {
+		phi, err := FromProto(net, output, mean)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range cases {
+			im := randomImage(c.Size)
+			want, err := phi.Apply(im)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := NativeApplyTiled(phi, net, output, im, TileOptions{c.MaxSize, c.Workers})
+			if err != nil {
+				t.Fatalf("output %s, image %v: %v", output, c.Size, err)
+			}
+			if !got.Size().Eq(want.Size()) || got.Channels != want.Channels {
+				t.Fatalf("output %s, image %v: size: want %v x %d, got %v x %d",
+					output, c.Size, want.Size(), want.Channels, got.Size(), got.Channels)
+			}
+			for i := range want.Elems {
+				if got.Elems[i] != want.Elems[i] {
+					t.Fatalf("output %s, image %v: element %d: want %g, got %g",
+						output, c.Size, i, want.Elems[i], got.Elems[i])
+				}
+			}
+		}
+	}
+}
+
+func TestTiles_cover(t *testing.T) {
+	var (
+		size  = image.Pt(101, 37)
+		rate  = 4
+		field = image.Pt(9, 9)
+	)
+	tiles, err := Tiles(size, rate, field, image.Pt(20, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tile := range tiles {
+		if !tile.Pixels.In(image.Rectangle{Max: size}) {
+			t.Errorf("tile %v outside image", tile.Pixels)
+		}
+		if tile.Pixels.Min != tile.Feat.Mul(rate) {
+			t.Errorf("tile %v does not start at feature %v", tile.Pixels, tile.Feat)
+		}
+		if tile.Pixels.Dx() < field.X || tile.Pixels.Dy() < field.Y {
+			t.Errorf("tile %v smaller than field", tile.Pixels)
+		}
+	}
+	if _, err := Tiles(size, rate, field, image.Pt(8, 20)); err == nil {
+		t.Error("expected error for tiles smaller than the field")
+	}
+}
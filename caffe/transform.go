@@ -0,0 +1,253 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/jvlmdr/go-cv/featset"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// TestTransform describes how an image is resized, cropped and mirrored
+// at test time and how the outputs of the crops are combined,
+// as in caffe.Classifier.
+type TestTransform struct {
+	// Size to which images are resized before cropping.
+	// If zero, images are resized to the crop size and not cropped,
+	// or left unchanged if the crop size is also zero.
+	Resize image.Point
+	// Size of each crop, usually the input size of the network.
+	// If zero, the whole image is used.
+	Crop image.Point
+	// Take the four corners and the center instead of the center only.
+	// Requires both the resize and crop sizes.
+	Oversample bool
+	// Also take the mirror image of every crop.
+	Mirror bool
+	// How the outputs of the crops are combined.
+	Aggregate Aggregation
+}
+
+// Aggregation combines the outputs of several crops.
+type Aggregation int
+
+const (
+	// AggregateMean takes the mean of each element.
+	AggregateMean Aggregation = iota
+	// AggregateMax takes the maximum of each element.
+	AggregateMax
+)
+
+func (a Aggregation) String() string {
+	switch a {
+	case AggregateMean:
+		return "mean"
+	case AggregateMax:
+		return "max"
+	default:
+		return fmt.Sprintf("Aggregation(%d)", int(a))
+	}
+}
+
+// ParseAggregation parses "mean" or "max".
+func ParseAggregation(s string) (Aggregation, error) {
+	switch s {
+	case "mean":
+		return AggregateMean, nil
+	case "max":
+		return AggregateMax, nil
+	default:
+		return 0, fmt.Errorf("unknown aggregation: %s", s)
+	}
+}
+
+// TestTransformFromParam creates the test-time equivalent
+// of the transformation of a data layer.
+// The crop size is taken from the parameter if set,
+// otherwise from input_dim of the network.
+// Random mirroring during training becomes averaging over mirror images.
+// Scaling after subtracting the mean is not supported.
+func TestTransformFromParam(param *TransformationParameter, net *NetParameter, resize image.Point) (TestTransform, error) {
+	t := TestTransform{Resize: resize}
+	if param.GetScale() != 1 {
+		return t, fmt.Errorf("scale is not supported: %g", param.GetScale())
+	}
+	if s := int(param.GetCropSize()); s > 0 {
+		t.Crop = image.Pt(s, s)
+	} else {
+		in, err := InputShape(net)
+		if err != nil {
+			return t, err
+		}
+		t.Crop = image.Pt(in.Width, in.Height)
+	}
+	t.Mirror = param.GetMirror()
+	return t, nil
+}
+
+// DataTransformParam returns the transformation of the data layer
+// which is used in the TEST phase,
+// or of the first data layer with no phase rule.
+// It returns nil if there is no such layer.
+func DataTransformParam(net *NetParameter) *TransformationParameter {
+	var param *TransformationParameter
+	for _, layer := range net.Layers {
+		if layer.TransformParam == nil {
+			continue
+		}
+		for _, rule := range layer.Include {
+			if rule.Phase != nil && rule.GetPhase() == Phase_TEST {
+				return layer.TransformParam
+			}
+		}
+		if len(layer.Include) == 0 && param == nil {
+			param = layer.TransformParam
+		}
+	}
+	return param
+}
+
+// Crops returns the images which are given to the network for an image.
+func (t TestTransform) Crops(im image.Image) ([]image.Image, error) {
+	if t.Crop.X < 0 || t.Crop.Y < 0 {
+		return nil, fmt.Errorf("invalid crop size: %v", t.Crop)
+	}
+	if t.Oversample && (t.Resize == image.ZP || t.Crop == image.ZP) {
+		return nil, fmt.Errorf("oversample requires resize and crop sizes")
+	}
+	var rects []image.Rectangle
+	switch {
+	case t.Crop == image.ZP:
+		if t.Resize != image.ZP {
+			im = Resize(im, t.Resize)
+		}
+		rects = []image.Rectangle{{Max: im.Bounds().Size()}}
+	case t.Resize == image.ZP:
+		im = Resize(im, t.Crop)
+		rects = []image.Rectangle{{Max: t.Crop}}
+	default:
+		if t.Resize.X < t.Crop.X || t.Resize.Y < t.Crop.Y {
+			return nil, fmt.Errorf("crop %v larger than resized image %v", t.Crop, t.Resize)
+		}
+		im = Resize(im, t.Resize)
+		var (
+			crop   = image.Rectangle{Max: t.Crop}
+			margin = t.Resize.Sub(t.Crop)
+			center = crop.Add(margin.Div(2))
+		)
+		rects = []image.Rectangle{center}
+		if t.Oversample {
+			rects = []image.Rectangle{
+				crop,
+				crop.Add(image.Pt(margin.X, 0)),
+				crop.Add(image.Pt(0, margin.Y)),
+				crop.Add(margin),
+				center,
+			}
+		}
+	}
+	var crops []image.Image
+	for _, r := range rects {
+		crops = append(crops, cropImage(im, r))
+	}
+	if t.Mirror {
+		for _, r := range rects {
+			crops = append(crops, mirrorImage(cropImage(im, r)))
+		}
+	}
+	return crops, nil
+}
+
+// mirrorImage flips an image horizontally.
+func mirrorImage(im image.Image) image.Image {
+	b := im.Bounds()
+	dst := image.NewRGBA(image.Rectangle{Max: b.Size()})
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			dst.Set(x, y, im.At(b.Max.X-1-x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// Combine aggregates the outputs of the crops of one image.
+// All outputs must have the same size.
+// Outputs of mirrored crops must already be flipped back,
+// as in ApplyTransformed.
+func Combine(feats []*rimg64.Multi, agg Aggregation) (*rimg64.Multi, error) {
+	if len(feats) == 0 {
+		return nil, fmt.Errorf("no outputs to combine")
+	}
+	first := feats[0]
+	dst := rimg64.NewMulti(first.Width, first.Height, first.Channels)
+	for i, f := range feats {
+		if !f.Size().Eq(first.Size()) || f.Channels != first.Channels {
+			return nil, fmt.Errorf("output %d has size %v x %d, expect %v x %d",
+				i, f.Size(), f.Channels, first.Size(), first.Channels)
+		}
+	}
+	for j := range dst.Elems {
+		var y float64
+		switch agg {
+		case AggregateMean:
+			for _, f := range feats {
+				y += f.Elems[j]
+			}
+			y /= float64(len(feats))
+		case AggregateMax:
+			y = math.Inf(-1)
+			for _, f := range feats {
+				y = math.Max(y, f.Elems[j])
+			}
+		default:
+			return nil, fmt.Errorf("unknown aggregation: %v", agg)
+		}
+		dst.Elems[j] = y
+	}
+	return dst, nil
+}
+
+// ApplyTransformed computes the output for every crop of an image
+// in one call to mapAll and combines them.
+func ApplyTransformed(mapAll func([]image.Image) ([]*rimg64.Multi, error), im image.Image, t TestTransform) (*rimg64.Multi, error) {
+	crops, err := t.Crops(im)
+	if err != nil {
+		return nil, err
+	}
+	feats, err := mapAll(crops)
+	if err != nil {
+		return nil, err
+	}
+	if t.Mirror {
+		// The second half are the outputs of the mirrored crops.
+		for i := len(feats) / 2; i < len(feats); i++ {
+			feats[i] = mirrorMulti(feats[i])
+		}
+	}
+	return Combine(feats, t.Aggregate)
+}
+
+// mirrorMulti flips a feature image horizontally.
+func mirrorMulti(f *rimg64.Multi) *rimg64.Multi {
+	dst := rimg64.NewMulti(f.Width, f.Height, f.Channels)
+	for u := 0; u < f.Width; u++ {
+		for v := 0; v < f.Height; v++ {
+			for k := 0; k < f.Channels; k++ {
+				dst.Set(f.Width-1-u, v, k, f.At(u, v, k))
+			}
+		}
+	}
+	return dst
+}
+
+// ApplyTransformed computes the feature of the crops of an image in one batch.
+func (phi *Feature) ApplyTransformed(im image.Image, t TestTransform) (*rimg64.Multi, error) {
+	return ApplyTransformed(phi.Map, im, t)
+}
+
+// NativeApplyTransformed computes a feature transform from FromProto
+// for the crops of an image.
+func NativeApplyTransformed(phi featset.Image, im image.Image, t TestTransform) (*rimg64.Multi, error) {
+	return ApplyTransformed(ApplyEach(phi), im, t)
+}
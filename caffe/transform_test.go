@@ -0,0 +1,116 @@
+package caffe
+
+import (
+	"image"
+	"testing"
+
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// Oversampling with mirroring gives ten crops as in caffe.Classifier.
+func TestTestTransform_Crops(t *testing.T) {
+	im := randomImage(image.Pt(40, 30))
+	tr := TestTransform{
+		Resize:     image.Pt(32, 32),
+		Crop:       image.Pt(24, 20),
+		Oversample: true,
+		Mirror:     true,
+	}
+	crops, err := tr.Crops(im)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crops) != 10 {
+		t.Fatalf("got %d crops, want 10", len(crops))
+	}
+	for i, c := range crops {
+		if size := c.Bounds().Size(); !size.Eq(tr.Crop) {
+			t.Errorf("crop %d: got size %v, want %v", i, size, tr.Crop)
+		}
+	}
+	// The last crop is the mirror image of the center crop.
+	center, mirror := crops[4], crops[9]
+	for y := 0; y < tr.Crop.Y; y++ {
+		for x := 0; x < tr.Crop.X; x++ {
+			r1, g1, b1, _ := center.At(x, y).RGBA()
+			r2, g2, b2, _ := mirror.At(tr.Crop.X-1-x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 {
+				t.Fatalf("mirror differs at (%d, %d)", x, y)
+			}
+		}
+	}
+
+	crops, err = TestTransform{Crop: image.Pt(8, 8)}.Crops(im)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crops) != 1 || !crops[0].Bounds().Size().Eq(image.Pt(8, 8)) {
+		t.Errorf("without resize: want one image resized to crop size")
+	}
+
+	if _, err := (TestTransform{Crop: image.Pt(8, 8), Oversample: true}).Crops(im); err == nil {
+		t.Error("oversample without resize: expect error")
+	}
+}
+
+// Outputs of mirrored crops are flipped back before they are combined.
+func TestApplyTransformed_mirror(t *testing.T) {
+	im := randomImage(image.Pt(7, 5))
+	// The output is the red channel of the image.
+	red := func(ims []image.Image) ([]*rimg64.Multi, error) {
+		feats := make([]*rimg64.Multi, len(ims))
+		for i, im := range ims {
+			b := im.Bounds()
+			f := rimg64.NewMulti(b.Dx(), b.Dy(), 1)
+			for x := 0; x < b.Dx(); x++ {
+				for y := 0; y < b.Dy(); y++ {
+					r, _, _, _ := im.At(b.Min.X+x, b.Min.Y+y).RGBA()
+					f.Set(x, y, 0, float64(r>>8))
+				}
+			}
+			feats[i] = f
+		}
+		return feats, nil
+	}
+	want, err := red([]image.Image{im})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ApplyTransformed(red, im, TestTransform{Mirror: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want[0].Elems {
+		if got.Elems[i] != want[0].Elems[i] {
+			t.Fatalf("element %d: got %g, want %g", i, got.Elems[i], want[0].Elems[i])
+		}
+	}
+}
+
+func TestCombine(t *testing.T) {
+	a := rimg64.NewMulti(1, 1, 2)
+	b := rimg64.NewMulti(1, 1, 2)
+	a.Elems[0], a.Elems[1] = 1, -4
+	b.Elems[0], b.Elems[1] = 3, -2
+	cases := []struct {
+		Agg  Aggregation
+		Want []float64
+	}{
+		{AggregateMean, []float64{2, -3}},
+		{AggregateMax, []float64{3, -2}},
+	}
+	for _, c := range cases {
+		got, err := Combine([]*rimg64.Multi{a, b}, c.Agg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range c.Want {
+			if got.Elems[i] != c.Want[i] {
+				t.Errorf("%v: element %d: got %g, want %g", c.Agg, i, got.Elems[i], c.Want[i])
+			}
+		}
+	}
+	if _, err := Combine([]*rimg64.Multi{a, rimg64.NewMulti(2, 1, 2)}, AggregateMean); err == nil {
+		t.Error("expect error for outputs of different size")
+	}
+}
@@ -0,0 +1,351 @@
+package caffe
+
+import (
+	"fmt"
+	"image"
+)
+
+// Problem is an issue found in a network definition.
+type Problem struct {
+	// Name of the layer, empty for problems with the network itself.
+	Layer string
+	// Field of the layer which is at fault, if any.
+	Field string
+	Msg   string
+	// Warnings do not prevent the network from running.
+	Warning bool
+}
+
+func (p Problem) Error() string {
+	s := "net"
+	if p.Layer != "" {
+		s = "layer " + p.Layer
+	}
+	if p.Field != "" {
+		s += ": " + p.Field
+	}
+	return s + ": " + p.Msg
+}
+
+// Validate checks a network definition without running it.
+// If input_dim is given, shapes are inferred and
+// kernel sizes, strides and padding are checked against them.
+// Problems are returned in the order of the layers.
+func Validate(net *NetParameter) []Problem {
+	v := &validator{net: net, shapes: make(map[string]Shape)}
+	v.checkInputs()
+	names := make(map[string]bool)
+	for _, layer := range net.Layers {
+		name := layer.GetName()
+		if name == "" {
+			v.errorf(name, "name", "layer has no name")
+		} else if names[name] {
+			v.errorf(name, "name", "duplicate layer name")
+		}
+		names[name] = true
+		v.checkLayer(layer)
+	}
+	v.checkUnused()
+	return v.problems
+}
+
+// HasErrors reports whether any of the problems is not a warning.
+func HasErrors(problems []Problem) bool {
+	for _, p := range problems {
+		if !p.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+type validator struct {
+	net      *NetParameter
+	problems []Problem
+	// Blobs which have been produced, whether they depend on the input
+	// and their shapes if known.
+	avail     map[string]bool
+	reachable map[string]bool
+	shapes    map[string]Shape
+	// Whether each blob has been consumed since it was last produced.
+	used map[string]bool
+	// Layer which last produced each blob.
+	producer map[string]string
+}
+
+func (v *validator) errorf(layer, field, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{layer, field, fmt.Sprintf(format, args...), false})
+}
+
+func (v *validator) warnf(layer, field, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{layer, field, fmt.Sprintf(format, args...), true})
+}
+
+func (v *validator) checkInputs() {
+	v.avail = make(map[string]bool)
+	v.reachable = make(map[string]bool)
+	v.used = make(map[string]bool)
+	v.producer = make(map[string]string)
+	net := v.net
+	if len(net.Input) == 0 {
+		v.errorf("", "input", "network has no inputs")
+	}
+	for _, input := range net.Input {
+		if v.avail[input] {
+			v.errorf("", "input", "duplicate input: %s", input)
+		}
+		v.avail[input] = true
+		v.reachable[input] = true
+	}
+	switch n := len(net.InputDim); {
+	case n == 0:
+	case n != 4*len(net.Input):
+		v.errorf("", "input_dim", "expect 4 dimensions per input, found %d for %d inputs", n, len(net.Input))
+	default:
+		for i, input := range net.Input {
+			d := net.InputDim[4*i : 4*i+4]
+			if d[1] <= 0 || d[2] <= 0 || d[3] <= 0 {
+				v.errorf("", "input_dim", "non-positive dimensions for %s: %v", input, d)
+				continue
+			}
+			v.shapes[input] = Shape{Channels: int(d[1]), Height: int(d[2]), Width: int(d[3])}
+		}
+	}
+}
+
+func (v *validator) checkLayer(layer *LayerParameter) {
+	name := layer.GetName()
+	if layer.Type == nil {
+		v.errorf(name, "type", "no layer type")
+		return
+	}
+	if len(layer.Top) == 0 {
+		v.errorf(name, "top", "layer has no outputs")
+	}
+
+	// Every bottom must have been produced by an earlier layer.
+	reachable := true
+	for _, bottom := range layer.Bottom {
+		if !v.avail[bottom] {
+			v.errorf(name, "bottom", "blob %s is not produced by an earlier layer", bottom)
+		}
+		reachable = reachable && v.reachable[bottom]
+		v.used[bottom] = true
+	}
+	if !reachable && len(layer.Bottom) > 0 {
+		v.warnf(name, "", "layer is unreachable from the network input")
+	}
+	v.checkNumBottoms(layer)
+	v.checkParams(layer)
+
+	// Infer output shape if all input shapes are known.
+	in := make([]Shape, len(layer.Bottom))
+	known := reachable && len(in) > 0
+	for i, bottom := range layer.Bottom {
+		s, ok := v.shapes[bottom]
+		if !ok {
+			known = false
+			break
+		}
+		in[i] = s
+	}
+	var (
+		out      Shape
+		outKnown bool
+	)
+	if known {
+		v.checkGeometry(layer, in[0])
+		var err error
+		out, err = outputShape(layer, in)
+		if err == nil {
+			outKnown = true
+		}
+	}
+
+	for _, top := range layer.Top {
+		// A top may only overwrite an existing blob if the layer is in-place.
+		if v.avail[top] && !contains(layer.Bottom, top) {
+			v.warnf(name, "top", "blob %s is overwritten (previously produced by %s)", top, v.producer[top])
+		}
+		v.avail[top] = true
+		v.reachable[top] = reachable
+		v.used[top] = false
+		v.producer[top] = name
+		if outKnown {
+			v.shapes[top] = out
+		} else {
+			delete(v.shapes, top)
+		}
+	}
+}
+
+func (v *validator) checkNumBottoms(layer *LayerParameter) {
+	name := layer.GetName()
+	n := len(layer.Bottom)
+	switch layer.GetType() {
+	case LayerParameter_CONCAT, LayerParameter_ELTWISE:
+		if n < 2 {
+			v.errorf(name, "bottom", "expect at least 2 inputs, found %d", n)
+		}
+	case LayerParameter_DATA, LayerParameter_IMAGE_DATA, LayerParameter_HDF5_DATA,
+		LayerParameter_MEMORY_DATA, LayerParameter_WINDOW_DATA, LayerParameter_DUMMY_DATA:
+		if n != 0 {
+			v.errorf(name, "bottom", "data layer has %d inputs", n)
+		}
+	case LayerParameter_ACCURACY, LayerParameter_SOFTMAX_LOSS, LayerParameter_EUCLIDEAN_LOSS,
+		LayerParameter_HINGE_LOSS, LayerParameter_INFOGAIN_LOSS,
+		LayerParameter_MULTINOMIAL_LOGISTIC_LOSS, LayerParameter_SIGMOID_CROSS_ENTROPY_LOSS,
+		LayerParameter_CONTRASTIVE_LOSS, LayerParameter_SILENCE:
+	default:
+		if n != 1 {
+			v.errorf(name, "bottom", "expect 1 input, found %d", n)
+		}
+	}
+}
+
+// checkParams checks that the parameters required by each layer type are set.
+func (v *validator) checkParams(layer *LayerParameter) {
+	name := layer.GetName()
+	switch layer.GetType() {
+	case LayerParameter_CONVOLUTION:
+		param := layer.GetConvolutionParam()
+		if param == nil {
+			v.errorf(name, "convolution_param", "missing")
+			return
+		}
+		if param.GetNumOutput() == 0 {
+			v.errorf(name, "convolution_param.num_output", "must be positive")
+		}
+		v.checkKernel(name, "convolution_param", param.KernelSize != nil, param.KernelH != nil, param.KernelW != nil)
+		if param.GetGroup() == 0 {
+			v.errorf(name, "convolution_param.group", "must be positive")
+		} else if param.GetNumOutput()%param.GetGroup() != 0 {
+			v.errorf(name, "convolution_param.group", "%d does not divide num_output %d", param.GetGroup(), param.GetNumOutput())
+		}
+		if param.Strides().X <= 0 || param.Strides().Y <= 0 {
+			v.errorf(name, "convolution_param.stride", "must be positive")
+		}
+	case LayerParameter_POOLING:
+		param := layer.GetPoolingParam()
+		if param == nil {
+			v.errorf(name, "pooling_param", "missing")
+			return
+		}
+		v.checkKernel(name, "pooling_param", param.KernelSize != nil, param.KernelH != nil, param.KernelW != nil)
+		if param.Strides().X <= 0 || param.Strides().Y <= 0 {
+			v.errorf(name, "pooling_param.stride", "must be positive")
+		}
+		if pad, k := param.Padding(), param.Kernel(); pad.X >= k.X || pad.Y >= k.Y {
+			if pad != image.ZP {
+				v.errorf(name, "pooling_param.pad", "padding %v must be less than kernel %v", pad, k)
+			}
+		}
+	case LayerParameter_INNER_PRODUCT:
+		param := layer.GetInnerProductParam()
+		if param == nil {
+			v.errorf(name, "inner_product_param", "missing")
+			return
+		}
+		if param.GetNumOutput() == 0 {
+			v.errorf(name, "inner_product_param.num_output", "must be positive")
+		}
+	case LayerParameter_LRN:
+		if param := layer.GetLrnParam(); param != nil && param.GetLocalSize()%2 == 0 {
+			v.errorf(name, "lrn_param.local_size", "must be odd: %d", param.GetLocalSize())
+		}
+	case LayerParameter_DROPOUT:
+		if r := layer.GetDropoutParam().GetDropoutRatio(); r < 0 || r >= 1 {
+			v.errorf(name, "dropout_param.dropout_ratio", "must be in [0, 1): %g", r)
+		}
+	}
+}
+
+func (v *validator) checkKernel(name, field string, size, h, w bool) {
+	switch {
+	case size && (h || w):
+		v.errorf(name, field+".kernel_size", "set together with kernel_h or kernel_w")
+	case !size && !(h && w):
+		v.errorf(name, field+".kernel_size", "missing (or one of kernel_h and kernel_w)")
+	}
+}
+
+// checkGeometry checks kernel, stride and pad against the input size.
+func (v *validator) checkGeometry(layer *LayerParameter, in Shape) {
+	name := layer.GetName()
+	var (
+		field               string
+		kernel, stride, pad image.Point
+		ceil                bool
+	)
+	switch layer.GetType() {
+	case LayerParameter_CONVOLUTION:
+		param := layer.GetConvolutionParam()
+		if param == nil {
+			return
+		}
+		field = "convolution_param"
+		kernel, stride, pad = param.Kernel(), param.Strides(), param.Padding()
+		if g := int(param.GetGroup()); g > 0 && in.Channels%g != 0 {
+			v.errorf(name, field+".group", "%d does not divide %d input channels", g, in.Channels)
+		}
+	case LayerParameter_POOLING:
+		param := layer.GetPoolingParam()
+		if param == nil {
+			return
+		}
+		field = "pooling_param"
+		kernel, stride, pad = param.Kernel(), param.Strides(), param.Padding()
+		ceil = true
+	default:
+		return
+	}
+	if kernel.X <= 0 || kernel.Y <= 0 || stride.X <= 0 || stride.Y <= 0 {
+		// Already reported.
+		return
+	}
+	padded := in.Size().Add(pad.Mul(2))
+	if kernel.X > padded.X || kernel.Y > padded.Y {
+		v.errorf(name, field+".kernel_size", "kernel %v larger than padded input %v", kernel, padded)
+		return
+	}
+	if ceil {
+		return
+	}
+	// Convolution discards pixels which do not fit a whole stride.
+	rem := padded.Sub(kernel)
+	if rem.X%stride.X != 0 || rem.Y%stride.Y != 0 {
+		v.warnf(name, field+".stride", "stride %v does not tile input %v with kernel %v: last %v pixels ignored",
+			stride, padded, kernel, image.Pt(rem.X%stride.X, rem.Y%stride.Y))
+	}
+}
+
+// checkUnused reports blobs which are produced but never consumed,
+// except for the outputs of the last layer.
+func (v *validator) checkUnused() {
+	layers := v.net.Layers
+	if len(layers) == 0 {
+		v.warnf("", "layers", "network has no layers")
+		return
+	}
+	last := layers[len(layers)-1]
+	for _, layer := range layers {
+		if layer == last {
+			continue
+		}
+		for _, top := range layer.Top {
+			if v.producer[top] != layer.GetName() || v.used[top] || contains(last.Top, top) {
+				continue
+			}
+			v.warnf(layer.GetName(), "top", "blob %s is never used", top)
+		}
+	}
+}
+
+func contains(xs []string, x string) bool {
+	for _, y := range xs {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
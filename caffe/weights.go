@@ -0,0 +1,222 @@
+package caffe
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+// LoadWeights reads a network with blobs from a binary caffemodel.
+// If the file name ends in HalfWeightsExt,
+// the blobs are converted from half precision.
+func LoadWeights(fname string) (*NetParameter, error) {
+	if strings.HasSuffix(fname, HalfWeightsExt) {
+		h, err := loadHalf(fname)
+		if err != nil {
+			return nil, err
+		}
+		return fromHalf(h)
+	}
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	net := new(NetParameter)
+	if err := proto.Unmarshal(data, net); err != nil {
+		return nil, err
+	}
+	return net, nil
+}
+
+// CopyOptions controls how weights are copied into an architecture.
+type CopyOptions struct {
+	// If strict, an error is returned when a layer which needs weights
+	// is missing from the source or its blobs have the wrong shape.
+	// Otherwise these layers are left without blobs.
+	Strict bool
+	// Maps a layer name in the destination to a layer name in the source.
+	Rename map[string]string
+}
+
+// BlobMismatch describes a blob whose shape differs from the architecture.
+// If the number of blobs differs, Blob is -1
+// and the numbers are given by the Out field of Want and Got.
+type BlobMismatch struct {
+	Layer string
+	Blob  int
+	Want  BlobDims
+	Got   BlobDims
+}
+
+func (m BlobMismatch) String() string {
+	if m.Blob < 0 {
+		return fmt.Sprintf("%s: expect %d blobs, found %d", m.Layer, m.Want.Out, m.Got.Out)
+	}
+	return fmt.Sprintf("%s blob %d: expect %v, found %v", m.Layer, m.Blob, m.Want, m.Got)
+}
+
+// WeightsReport describes the result of copying weights.
+// Layers are identified by their name in the destination,
+// except for Extra which lists names in the source.
+type WeightsReport struct {
+	Copied []string
+	// Layers which need weights but are not in the source.
+	Missing []string
+	// Layers in the source with blobs which were not used.
+	Extra []string
+	// Blobs whose shape does not match the architecture.
+	// These layers are not copied.
+	Mismatched []BlobMismatch
+}
+
+// OK reports whether every layer which needs weights received them.
+func (r *WeightsReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Mismatched) == 0
+}
+
+func (r *WeightsReport) String() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("copied %d layers", len(r.Copied)))
+	if len(r.Missing) > 0 {
+		lines = append(lines, fmt.Sprintf("missing: %s", strings.Join(r.Missing, ", ")))
+	}
+	if len(r.Extra) > 0 {
+		lines = append(lines, fmt.Sprintf("extra: %s", strings.Join(r.Extra, ", ")))
+	}
+	for _, m := range r.Mismatched {
+		lines = append(lines, "mismatch: "+m.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CopyWeights copies the blobs of each layer in src
+// to the layer with the same name in dst.
+// If dst has input_dim, the shape of every blob is checked
+// against the shape implied by the architecture.
+// Otherwise only the number of outputs is checked.
+func CopyWeights(dst, src *NetParameter, opts CopyOptions) (*WeightsReport, error) {
+	var shapes map[string]Shape
+	if in, err := InputShape(dst); err == nil {
+		shapes, _ = InferShapes(dst, in)
+	}
+	report := new(WeightsReport)
+	used := make(map[string]bool)
+	for _, layer := range dst.Layers {
+		name := layer.GetName()
+		srcName := name
+		if s, ok := opts.Rename[name]; ok {
+			srcName = s
+		}
+		var want []BlobDims
+		if len(layer.Bottom) > 0 {
+			in, known := shapes[layer.Bottom[0]]
+			want = expectBlobDims(layer, in, known)
+		}
+		srcLayer := layerByName(src, srcName)
+		if srcLayer == nil || len(srcLayer.Blobs) == 0 {
+			if want != nil {
+				report.Missing = append(report.Missing, name)
+			}
+			continue
+		}
+		used[srcName] = true
+		if mismatch := checkBlobs(name, want, srcLayer.Blobs); len(mismatch) > 0 {
+			report.Mismatched = append(report.Mismatched, mismatch...)
+			continue
+		}
+		layer.Blobs = make([]*BlobProto, len(srcLayer.Blobs))
+		copy(layer.Blobs, srcLayer.Blobs)
+		report.Copied = append(report.Copied, name)
+	}
+	for _, layer := range src.Layers {
+		if len(layer.Blobs) > 0 && !used[layer.GetName()] {
+			report.Extra = append(report.Extra, layer.GetName())
+		}
+	}
+	sort.Strings(report.Extra)
+	if opts.Strict && !report.OK() {
+		return report, fmt.Errorf("copy weights:\n%v", report)
+	}
+	return report, nil
+}
+
+// expectBlobDims gives the shapes of the blobs of a layer.
+// Returns nil if the layer does not have parameters.
+// If the input shape is not known, only the outputs are given
+// and the other dimensions are zero.
+func expectBlobDims(layer *LayerParameter, in Shape, known bool) []BlobDims {
+	var (
+		weights BlobDims
+		out     int
+		bias    bool
+	)
+	switch layer.GetType() {
+	case LayerParameter_CONVOLUTION:
+		param := layer.GetConvolutionParam()
+		out, bias = int(param.GetNumOutput()), param.GetBiasTerm()
+		k := param.Kernel()
+		weights = BlobDims{Width: k.X, Height: k.Y, Out: out}
+		if known && param.GetGroup() > 0 {
+			weights.In = in.Channels / int(param.GetGroup())
+		}
+	case LayerParameter_INNER_PRODUCT:
+		param := layer.GetInnerProductParam()
+		out, bias = int(param.GetNumOutput()), param.GetBiasTerm()
+		weights = BlobDims{Height: out, In: 1, Out: 1}
+		if known {
+			weights.Width = in.NumElems()
+		}
+	default:
+		return nil
+	}
+	dims := []BlobDims{weights}
+	if bias {
+		dims = append(dims, BlobDims{Width: out, Height: 1, In: 1, Out: 1})
+	}
+	return dims
+}
+
+// checkBlobs compares blobs to their expected shapes.
+// Zero dimensions in want are not checked.
+func checkBlobs(layer string, want []BlobDims, blobs []*BlobProto) []BlobMismatch {
+	if want == nil {
+		return nil
+	}
+	if len(blobs) != len(want) {
+		return []BlobMismatch{{Layer: layer, Blob: -1,
+			Want: BlobDims{Out: len(want)}, Got: BlobDims{Out: len(blobs)}}}
+	}
+	var mismatch []BlobMismatch
+	for i, blob := range blobs {
+		got := blobDims(blob)
+		if !dimsMatch(want[i], got) || len(blob.Data) != got.NumElems() {
+			mismatch = append(mismatch, BlobMismatch{layer, i, want[i], got})
+		}
+	}
+	return mismatch
+}
+
+func dimsMatch(want, got BlobDims) bool {
+	eq := func(a, b int) bool { return a == 0 || a == b }
+	return eq(want.Width, got.Width) && eq(want.Height, got.Height) &&
+		eq(want.In, got.In) && eq(want.Out, got.Out)
+}
+
+// ParseRenames parses a comma-separated list of dst=src pairs.
+func ParseRenames(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	if s == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid rename: %q", pair)
+		}
+		m[parts[0]] = parts[1]
+	}
+	return m, nil
+}
@@ -0,0 +1,121 @@
+package caffe
+
+import (
+	"reflect"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+const weightsTestNet = `
+name: "WeightsNet"
+input: "data"
+input_dim: 1 input_dim: 3 input_dim: 8 input_dim: 8
+layers { name: "conv1" type: CONVOLUTION bottom: "data" top: "conv1"
+  convolution_param { num_output: 4 kernel_size: 3 } }
+layers { name: "relu1" type: RELU bottom: "conv1" top: "conv1" }
+layers { name: "conv2" type: CONVOLUTION bottom: "conv1" top: "conv2"
+  convolution_param { num_output: 2 kernel_size: 3 } }
+layers { name: "fc" type: INNER_PRODUCT bottom: "conv2" top: "fc"
+  inner_product_param { num_output: 5 } }
+`
+
+// The source has conv1 under another name, lacks conv2,
+// has weights of the wrong shape for fc and an unused layer conv0.
+func weightsTestSource(t *testing.T) *NetParameter {
+	src := new(NetParameter)
+	if err := proto.UnmarshalText(weightsTestNet, src); err != nil {
+		t.Fatal(err)
+	}
+	randomWeights(t, src)
+	layerByName(src, "conv1").Name = proto.String("conv1_old")
+	layerByName(src, "conv2").Blobs = nil
+	fc := layerByName(src, "fc")
+	fc.Blobs[0].Width = proto.Int32(fc.Blobs[0].GetWidth() + 1)
+	extra := proto.Clone(layerByName(src, "conv1_old")).(*LayerParameter)
+	extra.Name = proto.String("conv0")
+	src.Layers = append(src.Layers, extra)
+	return src
+}
+
+func TestCopyWeights(t *testing.T) {
+	src := weightsTestSource(t)
+	opts := CopyOptions{Rename: map[string]string{"conv1": "conv1_old"}}
+	dst := new(NetParameter)
+	if err := proto.UnmarshalText(weightsTestNet, dst); err != nil {
+		t.Fatal(err)
+	}
+	report, err := CopyWeights(dst, src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() {
+		t.Error("report is OK despite missing and mismatched layers")
+	}
+	if want := []string{"conv1"}; !reflect.DeepEqual(report.Copied, want) {
+		t.Errorf("copied: got %v, want %v", report.Copied, want)
+	}
+	if want := []string{"conv2"}; !reflect.DeepEqual(report.Missing, want) {
+		t.Errorf("missing: got %v, want %v", report.Missing, want)
+	}
+	if want := []string{"conv0"}; !reflect.DeepEqual(report.Extra, want) {
+		t.Errorf("extra: got %v, want %v", report.Extra, want)
+	}
+	if len(report.Mismatched) != 1 || report.Mismatched[0].Layer != "fc" || report.Mismatched[0].Blob != 0 {
+		t.Errorf("mismatched: got %v, want fc blob 0", report.Mismatched)
+	}
+	if !reflect.DeepEqual(layerByName(dst, "conv1").Blobs, layerByName(src, "conv1_old").Blobs) {
+		t.Error("conv1: blobs were not copied")
+	}
+	for _, name := range []string{"conv2", "fc"} {
+		if n := len(layerByName(dst, name).Blobs); n != 0 {
+			t.Errorf("%s: got %d blobs, want none", name, n)
+		}
+	}
+
+	// Without the rename, conv1 is missing too.
+	dst = new(NetParameter)
+	if err := proto.UnmarshalText(weightsTestNet, dst); err != nil {
+		t.Fatal(err)
+	}
+	report, err = CopyWeights(dst, src, CopyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"conv1", "conv2"}; !reflect.DeepEqual(report.Missing, want) {
+		t.Errorf("missing without rename: got %v, want %v", report.Missing, want)
+	}
+
+	// Strict mode fails but still reports.
+	dst = new(NetParameter)
+	if err := proto.UnmarshalText(weightsTestNet, dst); err != nil {
+		t.Fatal(err)
+	}
+	opts.Strict = true
+	report, err = CopyWeights(dst, src, opts)
+	if err == nil {
+		t.Error("strict: expect error")
+	}
+	if report == nil || len(report.Missing) != 1 {
+		t.Errorf("strict: got report %v", report)
+	}
+}
+
+func TestParseRenames(t *testing.T) {
+	got, err := ParseRenames("fc6=fc6_old,conv1=conv1/7x7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"fc6": "fc6_old", "conv1": "conv1/7x7"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, err := ParseRenames(""); err != nil || len(got) != 0 {
+		t.Errorf("empty: got %v, %v", got, err)
+	}
+	for _, s := range []string{"fc6", "=fc6", "fc6=", "a=b,"} {
+		if _, err := ParseRenames(s); err == nil {
+			t.Errorf("%q: expect error", s)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package caffe
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"code.google.com/p/goprotobuf/proto"
+)
+
+// HalfWeightsExt is the extension of weights quantized to half precision.
+// These files can be read by LoadWeights but not by Caffe.
+const HalfWeightsExt = ".caffemodel16"
+
+// StripNet returns a copy of a network without the fields
+// which Caffe does not write to a caffemodel:
+// the diffs of blobs and the state of the network.
+// The phase rules of layers are kept, as in Caffe.
+func StripNet(net *NetParameter) *NetParameter {
+	net = proto.Clone(net).(*NetParameter)
+	net.State = nil
+	for _, layer := range net.Layers {
+		for _, blob := range layer.Blobs {
+			blob.Diff = nil
+		}
+	}
+	return net
+}
+
+// WriteWeights writes a network and its blobs in binary format
+// after removing the fields which are not part of a caffemodel.
+func WriteWeights(w io.Writer, net *NetParameter) error {
+	data, err := proto.Marshal(StripNet(net))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// SaveWeights writes a caffemodel and checks
+// that the file can be read back.
+// If the file name ends in HalfWeightsExt,
+// the blobs are quantized to half precision.
+func SaveWeights(fname string, net *NetParameter) error {
+	var msg proto.Message
+	if strings.HasSuffix(fname, HalfWeightsExt) {
+		msg = toHalf(net)
+	} else {
+		msg = StripNet(net)
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+		return err
+	}
+	return verifyWeights(fname, data)
+}
+
+// verifyWeights reads a weights file and checks
+// that it encodes to the data which was written.
+func verifyWeights(fname string, want []byte) error {
+	var (
+		msg proto.Message
+		err error
+	)
+	if strings.HasSuffix(fname, HalfWeightsExt) {
+		msg, err = loadHalf(fname)
+	} else {
+		msg, err = LoadWeights(fname)
+	}
+	if err != nil {
+		return fmt.Errorf("verify %s: %v", fname, err)
+	}
+	got, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("verify %s: %v", fname, err)
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("verify %s: round trip gives different data", fname)
+	}
+	return nil
+}
+
+func loadHalf(fname string) (*HalfNetParameter, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	h := new(HalfNetParameter)
+	if err := proto.Unmarshal(data, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -0,0 +1,164 @@
+// Package client requests features and predictions from a server
+// which was started by the serve command.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+	"github.com/jvlmdr/go-caffe/server"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// Client sends requests to a server.
+type Client struct {
+	// Address of the server, such as "http://localhost:8080".
+	URL string
+	// If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// Request features in JSON instead of the binary format.
+	JSON bool
+}
+
+// New creates a client for the server at a URL.
+func New(url string) *Client {
+	return &Client{URL: strings.TrimSuffix(url, "/")}
+}
+
+// Error is returned when the server responds with an error.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Health returns the names of the models which are served.
+func (c *Client) Health() ([]string, error) {
+	resp, err := c.httpClient().Get(c.URL + "/health")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	var health server.HealthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return nil, err
+	}
+	return health.Models, nil
+}
+
+// Features computes the output of each layer of a model for an image.
+// The image is sent losslessly as PNG.
+func (c *Client) Features(model string, im image.Image, layers ...string) (map[string]*rimg64.Multi, error) {
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("no layers")
+	}
+	query := url.Values{"layer": layers}
+	if c.JSON {
+		query.Set("format", "json")
+	}
+	resp, err := c.post(model, "features", query, im)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if c.JSON {
+		var feats server.FeaturesResponse
+		if err := json.NewDecoder(resp.Body).Decode(&feats); err != nil {
+			return nil, err
+		}
+		for _, layer := range layers {
+			if feats.Features[layer] == nil {
+				return nil, fmt.Errorf("response has no layer: %s", layer)
+			}
+		}
+		return feats.Features, nil
+	}
+	feats := make(map[string]*rimg64.Multi)
+	r := bufio.NewReader(resp.Body)
+	for _, layer := range layers {
+		f, err := caffe.ReadMulti(r)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("read layer %s: %v", layer, err)
+		}
+		feats[layer] = f
+	}
+	return feats, nil
+}
+
+// Predict returns the k most probable classes of an image.
+func (c *Client) Predict(model string, im image.Image, k int) ([]caffe.Prediction, error) {
+	query := url.Values{"k": {strconv.Itoa(k)}}
+	resp, err := c.post(model, "predict", query, im)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var pred server.PredictResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pred); err != nil {
+		return nil, err
+	}
+	return pred.Predictions, nil
+}
+
+// post sends an image to /models/{model}/{action}
+// and returns the response if it was successful.
+func (c *Client) post(model, action string, query url.Values, im image.Image) (*http.Response, error) {
+	var body bytes.Buffer
+	if err := png.Encode(&body, im); err != nil {
+		return nil, err
+	}
+	u := c.URL + "/models/" + url.PathEscape(model) + "/" + action + "?" + query.Encode()
+	resp, err := c.httpClient().Post(u, "image/png", &body)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// checkResponse returns an Error if the status is not 200 OK.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var e server.ErrorResponse
+	if err := json.Unmarshal(data, &e); err != nil || e.Error == "" {
+		e.Error = strings.TrimSpace(string(data))
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: e.Error}
+}
@@ -0,0 +1,336 @@
+package client
+
+import (
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jvlmdr/go-caffe/server"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// fakeModel computes simple functions of the pixels
+// and records the size of every batch.
+type fakeModel struct {
+	mu      sync.Mutex
+	batches []int
+	// If not nil, Map signals started and waits for release.
+	started, release chan struct{}
+}
+
+func (m *fakeModel) Map(layer string, ims []image.Image) ([]*rimg64.Multi, error) {
+	m.mu.Lock()
+	m.batches = append(m.batches, len(ims))
+	m.mu.Unlock()
+	if m.started != nil {
+		m.started <- struct{}{}
+		<-m.release
+	}
+	feats := make([]*rimg64.Multi, len(ims))
+	for i, im := range ims {
+		feats[i] = fakeFeature(layer, im)
+	}
+	return feats, nil
+}
+
+func (m *fakeModel) maxBatch() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int
+	for _, b := range m.batches {
+		if b > n {
+			n = b
+		}
+	}
+	return n
+}
+
+// fakeFeature gives the gray level at every pixel for "gray"
+// and the normalized sum of each channel for "prob".
+func fakeFeature(layer string, im image.Image) *rimg64.Multi {
+	b := im.Bounds()
+	switch layer {
+	case "gray":
+		f := rimg64.NewMulti(b.Dx(), b.Dy(), 1)
+		for x := 0; x < b.Dx(); x++ {
+			for y := 0; y < b.Dy(); y++ {
+				g := color.GrayModel.Convert(im.At(b.Min.X+x, b.Min.Y+y)).(color.Gray)
+				f.Set(x, y, 0, float64(g.Y))
+			}
+		}
+		return f
+	default:
+		f := rimg64.NewMulti(1, 1, 3)
+		var total float64
+		for x := b.Min.X; x < b.Max.X; x++ {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				r, g, b, _ := im.At(x, y).RGBA()
+				for k, v := range []uint32{r, g, b} {
+					f.Elems[k] += float64(v) + 1
+					total += float64(v) + 1
+				}
+			}
+		}
+		for k := range f.Elems {
+			f.Elems[k] /= total
+		}
+		return f
+	}
+}
+
+func newTestServer(opts server.Options) (*httptest.Server, *server.Server, *fakeModel) {
+	fake := new(fakeModel)
+	s := server.New(map[string]*server.Model{
+		"fake": {
+			Map:       fake.Map,
+			Layers:    []string{"gray", "prob"},
+			Labels:    []string{"red", "green", "blue"},
+			ProbLayer: "prob",
+		},
+	}, opts)
+	return httptest.NewServer(s), s, fake
+}
+
+func testImage(size image.Point, c color.Color) image.Image {
+	im := image.NewRGBA(image.Rectangle{Max: size})
+	for x := 0; x < size.X; x++ {
+		for y := 0; y < size.Y; y++ {
+			im.Set(x, y, c)
+		}
+	}
+	// Make the image non-uniform.
+	im.Set(0, 0, color.White)
+	return im
+}
+
+func TestClient_Features(t *testing.T) {
+	ts, s, _ := newTestServer(server.Options{})
+	defer ts.Close()
+	defer s.Close()
+
+	im := testImage(image.Pt(7, 5), color.RGBA{200, 40, 10, 255})
+	for _, useJSON := range []bool{false, true} {
+		c := New(ts.URL)
+		c.JSON = useJSON
+		feats, err := c.Features("fake", im, "gray", "prob")
+		if err != nil {
+			t.Fatalf("json %v: %v", useJSON, err)
+		}
+		for _, layer := range []string{"gray", "prob"} {
+			want, got := fakeFeature(layer, im), feats[layer]
+			if got == nil {
+				t.Fatalf("json %v: no layer %s", useJSON, layer)
+			}
+			if !got.Size().Eq(want.Size()) || got.Channels != want.Channels {
+				t.Fatalf("json %v, layer %s: got size %v x %d, want %v x %d",
+					useJSON, layer, got.Size(), got.Channels, want.Size(), want.Channels)
+			}
+			for i := range want.Elems {
+				if got.Elems[i] != want.Elems[i] {
+					t.Fatalf("json %v, layer %s: element %d: got %g, want %g",
+						useJSON, layer, i, got.Elems[i], want.Elems[i])
+				}
+			}
+		}
+	}
+}
+
+func TestClient_Predict(t *testing.T) {
+	ts, s, _ := newTestServer(server.Options{})
+	defer ts.Close()
+	defer s.Close()
+
+	c := New(ts.URL)
+	preds, err := c.Predict("fake", testImage(image.Pt(8, 8), color.RGBA{10, 20, 230, 255}), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preds) != 2 {
+		t.Fatalf("got %d predictions, want 2", len(preds))
+	}
+	if preds[0].Label != "blue" || preds[0].Index != 2 {
+		t.Errorf("got top prediction %+v, want blue", preds[0])
+	}
+	if preds[0].Prob < preds[1].Prob {
+		t.Errorf("predictions not in order: %+v", preds)
+	}
+
+	models, err := c.Health()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 1 || models[0] != "fake" {
+		t.Errorf("health: got models %v, want [fake]", models)
+	}
+}
+
+func TestClient_errors(t *testing.T) {
+	ts, s, _ := newTestServer(server.Options{})
+	defer ts.Close()
+	defer s.Close()
+
+	c := New(ts.URL)
+	im := testImage(image.Pt(4, 4), color.Black)
+	cases := []struct {
+		Name string
+		Err  error
+		Code int
+	}{
+		{"unknown model", errOf(c.Features("other", im, "gray")), http.StatusNotFound},
+		{"unknown layer", errOf(c.Features("fake", im, "conv9")), http.StatusNotFound},
+		{"invalid k", errOf(c.Predict("fake", im, 0)), http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		e, ok := tc.Err.(*Error)
+		if !ok {
+			t.Errorf("%s: got error %v, want *Error", tc.Name, tc.Err)
+			continue
+		}
+		if e.StatusCode != tc.Code {
+			t.Errorf("%s: got status %d, want %d", tc.Name, e.StatusCode, tc.Code)
+		}
+	}
+}
+
+func errOf(_ interface{}, err error) error { return err }
+
+// Images which are too large are rejected before they are decoded.
+func TestClient_imageLimits(t *testing.T) {
+	ts, s, _ := newTestServer(server.Options{MaxImageBytes: 200, MaxImagePixels: 100})
+	defer ts.Close()
+	defer s.Close()
+
+	c := New(ts.URL)
+	// Random colors do not compress, so the PNG is larger than 200 bytes.
+	noise := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	rand.Read(noise.Pix)
+	cases := []struct {
+		Name string
+		Im   image.Image
+		Code int
+	}{
+		{"small", testImage(image.Pt(4, 4), color.Black), http.StatusOK},
+		{"many bytes", noise, http.StatusRequestEntityTooLarge},
+		{"many pixels", testImage(image.Pt(11, 10), color.Black), http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range cases {
+		_, err := c.Features("fake", tc.Im, "gray")
+		code := http.StatusOK
+		if e, ok := err.(*Error); ok {
+			code = e.StatusCode
+		} else if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+		if code != tc.Code {
+			t.Errorf("%s: got status %d, want %d", tc.Name, code, tc.Code)
+		}
+	}
+
+	resp, err := http.Post(ts.URL+"/models/fake/features?layer=gray", "image/png", strings.NewReader("not an image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid image: got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+// Concurrent requests for the same layer are computed in one batch.
+func TestClient_batching(t *testing.T) {
+	const n = 8
+	ts, s, fake := newTestServer(server.Options{MaxBatch: n, BatchDelay: time.Second})
+	defer ts.Close()
+	defer s.Close()
+
+	c := New(ts.URL)
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = c.Features("fake", testImage(image.Pt(3, 3), color.Gray{uint8(i)}), "gray")
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if got := fake.maxBatch(); got != n {
+		t.Errorf("got largest batch %d, want %d", got, n)
+	}
+}
+
+// Requests beyond MaxPending are rejected and counted in the metrics.
+func TestClient_maxPending(t *testing.T) {
+	ts, s, fake := newTestServer(server.Options{MaxPending: 1})
+	defer ts.Close()
+	defer s.Close()
+	fake.started = make(chan struct{})
+	fake.release = make(chan struct{})
+
+	c := New(ts.URL)
+	im := testImage(image.Pt(3, 3), color.Black)
+	done := make(chan error)
+	go func() {
+		_, err := c.Features("fake", im, "gray")
+		done <- err
+	}()
+	<-fake.started
+	_, err := c.Features("fake", im, "gray")
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got error %v, want status 503", err)
+	}
+	close(fake.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Metrics are updated after the response is written.
+	want := []string{
+		"caffe_requests_rejected_total 1",
+		`caffe_requests_total{endpoint="features",code="200"} 1`,
+		`caffe_requests_total{endpoint="features",code="503"} 1`,
+		"caffe_batches_total 1",
+	}
+	var metrics string
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		metrics, err = getMetrics(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if containsLines(metrics, want) {
+			return
+		}
+	}
+	t.Errorf("metrics do not contain %q:\n%s", want, metrics)
+}
+
+func getMetrics(url string) (string, error) {
+	resp, err := http.Get(url + "/metrics")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	return string(data), err
+}
+
+func containsLines(s string, lines []string) bool {
+	for _, line := range lines {
+		if !strings.Contains(s, line+"\n") {
+			return false
+		}
+	}
+	return true
+}
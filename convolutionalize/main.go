@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s model.prototxt weights.caffemodel out.prototxt out.caffemodel\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Replaces inner product layers with convolutions.")
+		fmt.Fprintln(os.Stderr, "The kernel sizes are computed for the training input size.")
+		fmt.Fprintf(os.Stderr, "Weights are stored in half precision if out.caffemodel ends in %s.\n", caffe.HalfWeightsExt)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	var width, height int
+	flag.IntVar(&width, "width", 0, "Training input width (default from input_dim)")
+	flag.IntVar(&height, "height", 0, "Training input height (default from input_dim)")
+	flag.Parse()
+	if flag.NArg() != 4 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	var (
+		modelFile      = flag.Arg(0)
+		weightsFile    = flag.Arg(1)
+		outModelFile   = flag.Arg(2)
+		outWeightsFile = flag.Arg(3)
+	)
+
+	net := new(caffe.NetParameter)
+	if err := caffe.LoadMessage(modelFile, net); err != nil {
+		log.Fatalln(err)
+	}
+	weights, err := caffe.LoadWeights(weightsFile)
+	if err != nil {
+		log.Fatalln("load weights:", err)
+	}
+	if _, err := caffe.CopyWeights(net, weights, caffe.CopyOptions{Strict: true}); err != nil {
+		log.Fatalln(err)
+	}
+	in, err := caffe.InputShape(net)
+	if err != nil {
+		in = caffe.Shape{Channels: 3}
+	}
+	if width > 0 && height > 0 {
+		in.Width, in.Height = width, height
+	}
+	if in.Width <= 0 || in.Height <= 0 {
+		log.Fatalln("no input size: set -width and -height or input_dim")
+	}
+
+	conv, err := caffe.Convolutionalize(net, in)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := caffe.SaveWeights(outWeightsFile, conv); err != nil {
+		log.Fatalln(err)
+	}
+	// Write the architecture without blobs.
+	arch := proto.Clone(conv).(*caffe.NetParameter)
+	for _, layer := range arch.Layers {
+		layer.Blobs = nil
+	}
+	if err := caffe.SaveMessage(outModelFile, arch); err != nil {
+		log.Fatalln(err)
+	}
+}
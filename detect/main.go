@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+	"github.com/jvlmdr/go-file/fileutil"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s detector.json image.(jpeg|png)\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Prints one detection per line: score xmin ymin xmax ymax")
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	var (
+		threshold float64
+		overlap   float64
+	)
+	flag.StringVar(&caffe.ModelsDir, "models-dir", "models", "Directory which contains the model registry")
+	flag.StringVar(&caffe.ExtractScript, "script", "extract.py", "Script to extract features using Caffe")
+	flag.Float64Var(&threshold, "threshold", 0, "Score threshold (overrides detector)")
+	flag.Float64Var(&overlap, "overlap", 0, "Maximum overlap for non-maximum suppression (overrides detector)")
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	detFile, imageFile := flag.Arg(0), flag.Arg(1)
+
+	det := new(caffe.Detector)
+	if err := fileutil.LoadJSON(detFile, det); err != nil {
+		log.Fatalln("load detector:", err)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "threshold":
+			det.Threshold = threshold
+		case "overlap":
+			det.Overlap = overlap
+		}
+	})
+	im, err := caffe.LoadImage(imageFile)
+	if err != nil {
+		log.Fatalln("load image:", err)
+	}
+	dets, err := det.Detect(im)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, d := range dets {
+		r := d.Rect
+		fmt.Printf("%.6g %d %d %d %d\n", d.Score, r.Min.X, r.Min.Y, r.Max.X, r.Max.Y)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s dir stat\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s dir prune max-size\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "max-size is in bytes with an optional K, M or G suffix")
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	cache := &caffe.Cache{Dir: flag.Arg(0)}
+
+	switch cmd := flag.Arg(1); cmd {
+	case "stat":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		stats, err := cache.Stats()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("entries: %d\n", stats.Entries)
+		fmt.Printf("size:    %d bytes\n", stats.Size)
+		if stats.Entries > 0 {
+			fmt.Printf("oldest:  %v\n", stats.Oldest)
+			fmt.Printf("newest:  %v\n", stats.Newest)
+		}
+	case "prune":
+		if flag.NArg() != 3 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		maxSize, err := parseSize(flag.Arg(2))
+		if err != nil {
+			log.Fatalln("parse size:", err)
+		}
+		n, err := cache.Prune(maxSize)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("removed %d entries\n", n)
+	default:
+		fmt.Fprintln(os.Stderr, "unknown command:", cmd)
+		flag.Usage()
+		os.Exit(1)
+	}
+}
+
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s model.prototxt weights.caffemodel out.prototxt out.caffemodel\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Folds the scale, mean and channel order into the first convolution")
+		fmt.Fprintln(os.Stderr, "and merges POWER layers into adjacent convolutions and inner products.")
+		fmt.Fprintln(os.Stderr, "The output network takes RGB images with values in [0, 1].")
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	var (
+		meanStr string
+		check   string
+		noCheck bool
+		tol     float64
+	)
+	flag.StringVar(&meanStr, "mean", "0,0,0", "Mean pixel in RGB order")
+	flag.StringVar(&check, "check", "", "Check that the output of this layer is unchanged for a random image (default last layer)")
+	flag.BoolVar(&noCheck, "no-check", false, "Do not check the output")
+	flag.Float64Var(&tol, "tol", 1e-4, "Tolerance of check relative to the maximum output")
+	flag.Parse()
+	if flag.NArg() != 4 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	var (
+		modelFile      = flag.Arg(0)
+		weightsFile    = flag.Arg(1)
+		outModelFile   = flag.Arg(2)
+		outWeightsFile = flag.Arg(3)
+	)
+	mean, err := caffe.ParseMean(meanStr)
+	if err != nil {
+		log.Fatalln("parse mean:", err)
+	}
+
+	net := new(caffe.NetParameter)
+	if err := caffe.LoadMessage(modelFile, net); err != nil {
+		log.Fatalln(err)
+	}
+	weights, err := caffe.LoadWeights(weightsFile)
+	if err != nil {
+		log.Fatalln("load weights:", err)
+	}
+	if _, err := caffe.CopyWeights(net, weights, caffe.CopyOptions{Strict: true}); err != nil {
+		log.Fatalln(err)
+	}
+	opt, err := caffe.Optimize(net, mean)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("%d layers, was %d", len(opt.Layers), len(net.Layers))
+
+	if !noCheck {
+		if check == "" && len(opt.Layers) > 0 {
+			// Layers which remain after folding exist in both networks.
+			check = opt.Layers[len(opt.Layers)-1].GetName()
+		}
+		if err := caffe.VerifyFolded(net, opt, check, mean, nil, tol); err != nil {
+			log.Fatalln("check:", err)
+		}
+		log.Printf("check: outputs of %s are unchanged", check)
+	}
+
+	if err := caffe.SaveWeights(outWeightsFile, opt); err != nil {
+		log.Fatalln(err)
+	}
+	arch := proto.Clone(opt).(*caffe.NetParameter)
+	for _, layer := range arch.Layers {
+		layer.Blobs = nil
+	}
+	if err := caffe.SaveMessage(outModelFile, arch); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+	"github.com/jvlmdr/go-cv/featset"
+)
+
+var benchCmd = &command{
+	Args:  "image layer,...",
+	Short: "Benchmark Caffe and the native engine, with the time of each layer",
+	Flags: func(fs *flag.FlagSet) func([]string) {
+		var (
+			model     = addModelFlags(fs)
+			script    = fs.String("script", "extract.py", "Python script for Caffe")
+			numTrials = fs.Int("trials", 16, "Number of trials for benchmark")
+			warmup    = fs.Int("warmup", 2, "Number of trials to discard before measuring")
+			noPython  = fs.Bool("no-python", false, "Do not benchmark Caffe")
+			noNative  = fs.Bool("no-native", false, "Do not benchmark the native engine")
+			format    = addFormatFlag(fs, "text", "json")
+			label     = fs.String("label", "", "Label to include in the report, such as a commit")
+		)
+		return func(args []string) {
+			if len(args) != 2 {
+				usage(fs)
+			}
+			if err := checkFormat(*format, "text", "json"); err != nil {
+				log.Fatalln(err)
+			}
+			if *noPython && *noNative {
+				log.Fatalln("nothing to benchmark")
+			}
+			files, err := model.resolve()
+			if err != nil {
+				log.Fatalln(err)
+			}
+			r := bench(files, *script, args[0], strings.Split(args[1], ","), *warmup, *numTrials, !*noPython, !*noNative)
+			r.Label = *label
+			if *format == "json" {
+				data, err := json.MarshalIndent(r, "", "\t")
+				if err != nil {
+					log.Fatalln(err)
+				}
+				fmt.Println(string(data))
+				return
+			}
+			if err := r.WriteText(os.Stdout); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	},
+}
+
+func bench(files caffe.ModelFiles, scriptFile, imFile string, outputs []string, warmup, numTrials int, python, native bool) *report {
+	im, err := caffe.LoadImage(imFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	ims := []image.Image{im}
+	model, err := files.LoadArch()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// Extract subset of model for each layer.
+	models := make([]*caffe.NetParameter, len(outputs))
+	for i, output := range outputs {
+		models[i] = caffe.SubsetForOutput(model, output)
+		log.Printf("model for %s: %v", output, models[i])
+	}
+	if python && (files.Weights == "" || files.MeanFile == "") {
+		log.Fatalln("caffe needs -weights and -mean-file")
+	}
+
+	// Split native transform into stages.
+	var (
+		pres   []featset.Image
+		stages [][]caffe.Stage
+	)
+	if native {
+		if files.Mean == nil {
+			log.Fatalln("native engine needs -mean")
+		}
+		net, copied, err := files.LoadNet(caffe.CopyOptions{Strict: true})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Print(copied)
+		pres = make([]featset.Image, len(outputs))
+		stages = make([][]caffe.Stage, len(outputs))
+		for i, output := range outputs {
+			pres[i], stages[i], err = caffe.Stages(net, output, files.Mean)
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+	}
+
+	var (
+		pythonTimes = make([][]*caffe.ExtractTiming, len(outputs))
+		nativeTimes = make([][][]time.Duration, len(outputs))
+	)
+	for t := -warmup; t < numTrials; t++ {
+		// Visit layers in random order in each trial.
+		for _, i := range rand.Perm(len(outputs)) {
+			if python {
+				_, timing, err := caffe.ExtractTimed(scriptFile, ims, outputs[i], models[i], files.Weights, files.MeanFile)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				if t >= 0 {
+					pythonTimes[i] = append(pythonTimes[i], timing)
+				}
+			}
+			if native {
+				durs, err := caffe.StageTimes(pres[i], stages[i], im)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				if t >= 0 {
+					nativeTimes[i] = append(nativeTimes[i], durs)
+				}
+			}
+		}
+	}
+
+	r := &report{
+		Time:      time.Now(),
+		GoVersion: runtime.Version(),
+		NumCPU:    runtime.NumCPU(),
+		Image:     im.Bounds().Size(),
+		Warmup:    warmup,
+		Trials:    numTrials,
+	}
+	for i, output := range outputs {
+		l := layerReport{Layer: output}
+		if python {
+			l.Python = summarizePython(pythonTimes[i])
+		}
+		if native {
+			l.Native = summarizeNative(stages[i], nativeTimes[i])
+		}
+		r.Layers = append(r.Layers, l)
+	}
+	return r
+}
+
+// report can be saved as JSON to compare commits.
+type report struct {
+	Label     string `json:",omitempty"`
+	Time      time.Time
+	GoVersion string
+	NumCPU    int
+	Image     image.Point
+	Warmup    int
+	Trials    int
+	Layers    []layerReport
+}
+
+type layerReport struct {
+	Layer  string
+	Python *pythonStats `json:",omitempty"`
+	Native *nativeStats `json:",omitempty"`
+}
+
+type pythonStats struct {
+	Total, Startup, Load, Forward caffe.DurationStats
+}
+
+type nativeStats struct {
+	Total caffe.DurationStats
+	// The first stage is preprocessing.
+	Stages []stageStats
+}
+
+type stageStats struct {
+	Layer string
+	caffe.DurationStats
+}
+
+func summarizePython(timings []*caffe.ExtractTiming) *pythonStats {
+	var total, startup, load, forward []time.Duration
+	for _, t := range timings {
+		total = append(total, t.Total)
+		startup = append(startup, t.Startup)
+		load = append(load, t.Load)
+		forward = append(forward, t.Forward)
+	}
+	return &pythonStats{
+		Total:   caffe.ComputeDurationStats(total),
+		Startup: caffe.ComputeDurationStats(startup),
+		Load:    caffe.ComputeDurationStats(load),
+		Forward: caffe.ComputeDurationStats(forward),
+	}
+}
+
+// summarizeNative takes the durations of every stage in each trial.
+func summarizeNative(stages []caffe.Stage, trials [][]time.Duration) *nativeStats {
+	names := []string{"preprocess"}
+	for _, s := range stages {
+		names = append(names, s.Layer)
+	}
+	var total []time.Duration
+	perStage := make([][]time.Duration, len(names))
+	for _, durs := range trials {
+		var sum time.Duration
+		for j, d := range durs {
+			perStage[j] = append(perStage[j], d)
+			sum += d
+		}
+		total = append(total, sum)
+	}
+	s := &nativeStats{Total: caffe.ComputeDurationStats(total)}
+	for j, name := range names {
+		s.Stages = append(s.Stages, stageStats{name, caffe.ComputeDurationStats(perStage[j])})
+	}
+	return s
+}
+
+func (r *report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "layer\tengine\tpart\tmedian\tp90\tstd\t")
+	row := func(layer, engine, part string, s caffe.DurationStats) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.4g\t%.4g\t%.3g\t\n", layer, engine, part, s.Median, s.P90, s.Std)
+	}
+	for _, l := range r.Layers {
+		if p := l.Python; p != nil {
+			row(l.Layer, "caffe", "total", p.Total)
+			row(l.Layer, "caffe", "startup", p.Startup)
+			row(l.Layer, "caffe", "load", p.Load)
+			row(l.Layer, "caffe", "forward", p.Forward)
+		}
+		if n := l.Native; n != nil {
+			row(l.Layer, "native", "total", n.Total)
+			for _, s := range n.Stages {
+				row(l.Layer, "native", s.Layer, s.DurationStats)
+			}
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "seconds over %d trials after %d warm-up\n", r.Trials, r.Warmup)
+	return err
+}
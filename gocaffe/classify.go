@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+var classifyCmd = &command{
+	Args:  "image|dir ...",
+	Short: "Print the most probable labels of images; directories are searched for jpeg and png images",
+	Flags: func(fs *flag.FlagSet) func([]string) {
+		model := addModelFlags(fs)
+		fs.StringVar(&model.files.Labels, "labels", "", "File with one label per line (default from registry)")
+		var (
+			backend    = addBackendFlags(fs)
+			format     = addFormatFlag(fs, "text", "csv", "json")
+			layer      = fs.String("layer", "prob", "Layer which gives the probabilities")
+			k          = fs.Int("k", 5, "Number of labels to print")
+			resize     = fs.Int("resize", 256, "Resize images to this size before cropping (0 to resize to crop size)")
+			crop       = fs.Int("crop", 0, "Size of center crop (default input size of model)")
+			oversample = fs.Bool("oversample", false, "Combine corner and center crops and their mirror images")
+			mirror     = fs.Bool("mirror", false, "Also combine mirror images (implied by -oversample)")
+			aggregate  = fs.String("aggregate", "mean", "Combine crops by mean or max")
+			transform  = fs.String("transform", "", "Take crop and mirror from the data layer of this network, such as train_val.prototxt")
+			strict     = fs.Bool("strict", false, "Fail if weights are missing or have the wrong shape")
+		)
+		return func(args []string) {
+			if len(args) < 1 {
+				usage(fs)
+			}
+			if err := checkFormat(*format, "text", "csv", "json"); err != nil {
+				log.Fatalln(err)
+			}
+			if *k < 1 {
+				log.Fatalln("k must be positive:", *k)
+			}
+			if *oversample && *resize <= 0 {
+				log.Fatalln("-oversample requires -resize")
+			}
+			files, err := model.resolve()
+			if err != nil {
+				log.Fatalln(err)
+			}
+			b, err := backend.load(files, caffe.CopyOptions{Strict: *strict})
+			if err != nil {
+				log.Fatalln(err)
+			}
+			var labels []string
+			if files.Labels != "" {
+				var err error
+				labels, err = caffe.LoadLabels(files.Labels)
+				if err != nil {
+					log.Fatalln("load labels:", err)
+				}
+			}
+
+			t := caffe.TestTransform{Resize: image.Pt(*resize, *resize)}
+			if *transform != "" {
+				trainNet := new(caffe.NetParameter)
+				if err := caffe.LoadMessage(*transform, trainNet); err != nil {
+					log.Fatalln(err)
+				}
+				param := caffe.DataTransformParam(trainNet)
+				if param == nil {
+					log.Fatalln("no data layer with transform_param in", *transform)
+				}
+				var err error
+				t, err = caffe.TestTransformFromParam(param, b.arch, t.Resize)
+				if err != nil {
+					log.Fatalln(err)
+				}
+			} else if files.InputSize != (image.Point{}) {
+				t.Crop = files.InputSize
+			} else {
+				in, err := caffe.InputShape(b.arch)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				t.Crop = image.Pt(in.Width, in.Height)
+			}
+			if *crop > 0 {
+				t.Crop = image.Pt(*crop, *crop)
+			}
+			t.Oversample = *oversample
+			t.Mirror = t.Mirror || *mirror || *oversample
+			agg, err := caffe.ParseAggregation(*aggregate)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			t.Aggregate = agg
+
+			mapAll, err := b.mapper(*layer)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			imFiles, err := imageFiles(args)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			var results []classifyResult
+			for _, file := range imFiles {
+				im, err := caffe.LoadImage(file)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				probs, err := caffe.Classify(mapAll, im, t)
+				if err != nil {
+					log.Fatalf("classify %s: %v", file, err)
+				}
+				if labels != nil && len(labels) != len(probs) {
+					log.Fatalf("number of labels is %d, number of classes is %d", len(labels), len(probs))
+				}
+				r := classifyResult{Image: file, Predictions: caffe.TopK(probs, labels, *k)}
+				if *format == "text" {
+					writePredictions(os.Stdout, r)
+					continue
+				}
+				results = append(results, r)
+			}
+
+			switch *format {
+			case "csv":
+				err = writePredictionsCSV(os.Stdout, results)
+			case "json":
+				var data []byte
+				data, err = json.MarshalIndent(results, "", "\t")
+				if err == nil {
+					_, err = fmt.Println(string(data))
+				}
+			}
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+	},
+}
+
+type classifyResult struct {
+	Image       string
+	Predictions []caffe.Prediction
+}
+
+func writePredictions(w io.Writer, r classifyResult) {
+	fmt.Fprintln(w, r.Image)
+	for _, p := range r.Predictions {
+		fmt.Fprintf(w, "  %.4f  %d  %s\n", p.Prob, p.Index, p.Label)
+	}
+}
+
+func writePredictionsCSV(w io.Writer, results []classifyResult) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"image", "rank", "index", "label", "prob"})
+	for _, r := range results {
+		for i, p := range r.Predictions {
+			c.Write([]string{
+				r.Image,
+				strconv.Itoa(i + 1),
+				strconv.Itoa(p.Index),
+				p.Label,
+				strconv.FormatFloat(p.Prob, 'g', -1, 64),
+			})
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// imageFiles expands directories into the images which they contain.
+func imageFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		infos, err := ioutil.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			switch strings.ToLower(path.Ext(info.Name())) {
+			case ".jpg", ".jpeg", ".png":
+				files = append(files, path.Join(arg, info.Name()))
+			}
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// config maps flag names to default values.
+// A value which is an object maps the flags of the command of that name.
+type config map[string]json.RawMessage
+
+func loadConfig(fname string) (config, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// apply sets the flags of a command from the config.
+// Top-level values are ignored if the command does not have the flag.
+// Values in the section of the command must name flags of the command.
+func (c config) apply(fs *flag.FlagSet) error {
+	for name, raw := range c {
+		if isObject(raw) || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := setFlag(fs, name, raw); err != nil {
+			return err
+		}
+	}
+	raw, ok := c[fs.Name()]
+	if !ok {
+		return nil
+	}
+	var section map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &section); err != nil {
+		return fmt.Errorf("section %s: %v", fs.Name(), err)
+	}
+	for name, raw := range section {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("section %s: unknown flag: %s", fs.Name(), name)
+		}
+		if err := setFlag(fs, name, raw); err != nil {
+			return fmt.Errorf("section %s: %v", fs.Name(), err)
+		}
+	}
+	return nil
+}
+
+// setFlag sets a flag from a JSON string, number, boolean
+// or array, whose elements are joined by commas.
+func setFlag(fs *flag.FlagSet, name string, raw json.RawMessage) error {
+	value, err := flagValue(raw)
+	if err != nil {
+		return fmt.Errorf("flag %s: %v", name, err)
+	}
+	if err := fs.Set(name, value); err != nil {
+		return fmt.Errorf("flag %s: %v", name, err)
+	}
+	return nil
+}
+
+func flagValue(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	switch {
+	case len(raw) > 0 && raw[0] == '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case len(raw) > 0 && raw[0] == '[':
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return "", err
+		}
+		strs := make([]string, len(elems))
+		for i, elem := range elems {
+			s, err := flagValue(elem)
+			if err != nil {
+				return "", err
+			}
+			strs[i] = s
+		}
+		return strings.Join(strs, ","), nil
+	case isObject(raw):
+		return "", fmt.Errorf("value is an object")
+	default:
+		return string(raw), nil
+	}
+}
+
+func isObject(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) > 0 && raw[0] == '{'
+}
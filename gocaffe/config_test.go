@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestFlagValue(t *testing.T) {
+	cases := map[string]string{
+		`"native"`:         "native",
+		`  "a b"  `:        "a b",
+		`16`:               "16",
+		`1e-6`:             "1e-6",
+		`true`:             "true",
+		`[120, 110, 100]`:  "120,110,100",
+		`["conv1", "fc7"]`: "conv1,fc7",
+		`[[1, 2], 3]`:      "1,2,3",
+		`[]`:               "",
+	}
+	for in, want := range cases {
+		got, err := flagValue(json.RawMessage(in))
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", in, got, want)
+		}
+	}
+	for _, in := range []string{`{"a": 1}`, `[1, {"a": 1}]`, `"unterminated`} {
+		if _, err := flagValue(json.RawMessage(in)); err == nil {
+			t.Errorf("%s: expect error", in)
+		}
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	newFlags := func() (*flag.FlagSet, *string, *string, *int) {
+		fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+		backend := fs.String("backend", "native", "")
+		mean := fs.String("mean", "", "")
+		tile := fs.Int("tile", 0, "")
+		return fs, backend, mean, tile
+	}
+	var c config
+	err := json.Unmarshal([]byte(`{
+		"backend": "caffe",
+		"mean": [120, 110, 100],
+		"trials": 4,
+		"extract": {"backend": "native", "tile": 512},
+		"bench": {"unknown": 1}
+	}`), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The section of the command takes precedence over top-level values,
+	// which are ignored if the command does not have the flag.
+	// Sections of other commands are not checked.
+	fs, backend, mean, tile := newFlags()
+	if err := c.apply(fs); err != nil {
+		t.Fatal(err)
+	}
+	if *backend != "native" || *mean != "120,110,100" || *tile != 512 {
+		t.Errorf("got backend %q, mean %q, tile %d", *backend, *mean, *tile)
+	}
+	// The command line takes precedence over the config.
+	if err := fs.Parse([]string{"-tile", "64"}); err != nil {
+		t.Fatal(err)
+	}
+	if *tile != 64 {
+		t.Errorf("got tile %d, want 64", *tile)
+	}
+
+	errCases := map[string]string{
+		"unknown flag in section": `{"extract": {"trials": 4}}`,
+		"section is not object":   `{"extract": [1]}`,
+		"invalid value":           `{"tile": "large"}`,
+		"object in section":       `{"extract": {"mean": {"r": 120}}}`,
+	}
+	for name, data := range errCases {
+		var c config
+		if err := json.Unmarshal([]byte(data), &c); err != nil {
+			t.Fatal(err)
+		}
+		fs, _, _, _ := newFlags()
+		if err := c.apply(fs); err == nil {
+			t.Errorf("%s: expect error", name)
+		}
+	}
+}
+
+// The test command exits with status 2 on any error,
+// since status 1 means that the outputs diverge.
+func TestTestCmd_exitCode(t *testing.T) {
+	if args := os.Getenv("GOCAFFE_TEST_ARGS"); args != "" {
+		// Run the command in a subprocess.
+		fs := flag.NewFlagSet("test", flag.ExitOnError)
+		run := testCmd.Flags(fs)
+		fs.Parse(strings.Fields(args))
+		run(fs.Args())
+		os.Exit(0)
+	}
+	dir, err := ioutil.TempDir("", "gocaffe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cases := map[string]string{
+		"number of arguments": "conv1",
+		"unknown flag":        "-unknown conv1 im.png",
+		"unknown format":      "-format xml -arch net.prototxt conv1 im.png",
+		"no model":            "conv1 im.png",
+		"not in registry":     "-models-dir " + dir + " -model none conv1 im.png",
+		"invalid mean":        "-arch net.prototxt -mean 1,2 conv1 im.png",
+		"missing files":       "-arch net.prototxt conv1 im.png",
+		"missing arch":        "-arch " + dir + "/net.prototxt -weights w -mean-file m -mean 1,2,3 conv1 im.png",
+	}
+	for name, args := range cases {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestTestCmd_exitCode$")
+		cmd.Env = append(os.Environ(), "GOCAFFE_TEST_ARGS="+args)
+		err := cmd.Run()
+		exit, ok := err.(*exec.ExitError)
+		if !ok {
+			t.Errorf("%s: got %v, want exit status 2", name, err)
+			continue
+		}
+		if code := exit.ExitCode(); code != 2 {
+			t.Errorf("%s: got exit status %d, want 2", name, code)
+		}
+	}
+}
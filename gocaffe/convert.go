@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+	"github.com/jvlmdr/go-file/fileutil"
+)
+
+var convertCmd = &command{
+	Args:  "layer out.json",
+	Short: "Save the native feature transform of a layer as JSON",
+	Flags: func(fs *flag.FlagSet) func([]string) {
+		var (
+			model     = addModelFlags(fs)
+			strict    = fs.Bool("strict", false, "Fail if weights are missing or have the wrong shape")
+			renameStr = fs.String("rename", "", "Load weights of renamed layers (new=old,...)")
+		)
+		return func(args []string) {
+			if len(args) != 2 {
+				usage(fs)
+			}
+			layer, outFile := args[0], args[1]
+			rename, err := caffe.ParseRenames(*renameStr)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			files, err := model.resolve()
+			if err != nil {
+				log.Fatalln(err)
+			}
+			if files.Mean == nil {
+				files.Mean = []float64{0, 0, 0}
+			}
+			net, report, err := files.LoadNet(caffe.CopyOptions{Strict: *strict, Rename: rename})
+			if err != nil {
+				log.Fatalln(err)
+			}
+			log.Print(report)
+			phi, err := caffe.FromProto(net, layer, files.Mean)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			if err := fileutil.SaveJSON(outFile, phi.Marshaler()); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	},
+}
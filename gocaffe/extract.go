@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"os"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+var extractCmd = &command{
+	Args:  "image layer",
+	Short: "Compute the output of a layer for an image",
+	Flags: func(fs *flag.FlagSet) func([]string) {
+		var (
+			model      = addModelFlags(fs)
+			backend    = addBackendFlags(fs)
+			format     = addFormatFlag(fs, "text", "json", "binary")
+			tileSize   = fs.Int("tile", 0, "Process the image in tiles of at most this many pixels (0 for whole image)")
+			workers    = fs.Int("workers", 1, "Number of tiles to process concurrently")
+			resize     = fs.Int("resize", 0, "Resize the image to this size before cropping")
+			crop       = fs.Int("crop", 0, "Size of center crop (0 for no crop)")
+			oversample = fs.Bool("oversample", false, "Combine corner and center crops")
+			mirror     = fs.Bool("mirror", false, "Also combine mirror images of the crops")
+			aggregate  = fs.String("aggregate", "mean", "Combine crops by mean or max")
+			strict     = fs.Bool("strict", false, "Fail if weights are missing or have the wrong shape")
+		)
+		return func(args []string) {
+			if len(args) != 2 {
+				usage(fs)
+			}
+			if err := checkFormat(*format, "text", "json", "binary"); err != nil {
+				log.Fatalln(err)
+			}
+			agg, err := caffe.ParseAggregation(*aggregate)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			t := caffe.TestTransform{
+				Resize:     image.Pt(*resize, *resize),
+				Crop:       image.Pt(*crop, *crop),
+				Oversample: *oversample,
+				Mirror:     *mirror,
+				Aggregate:  agg,
+			}
+			if *oversample && (*resize <= 0 || *crop <= 0) {
+				log.Fatalln("-oversample requires -resize and -crop")
+			}
+			transformed := *resize > 0 || *crop > 0 || *oversample || *mirror
+			if transformed && *tileSize > 0 {
+				log.Fatalln("cannot combine -tile with -resize, -crop, -oversample or -mirror")
+			}
+
+			imFile, layer := args[0], args[1]
+			im, err := caffe.LoadImage(imFile)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			files, err := model.resolve()
+			if err != nil {
+				log.Fatalln(err)
+			}
+			b, err := backend.load(files, caffe.CopyOptions{Strict: *strict})
+			if err != nil {
+				log.Fatalln(err)
+			}
+			mapAll, err := b.mapper(layer)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			apply := func(im image.Image) (*rimg64.Multi, error) {
+				feats, err := mapAll([]image.Image{im})
+				if err != nil {
+					return nil, err
+				}
+				return feats[0], nil
+			}
+			var f *rimg64.Multi
+			switch {
+			case transformed:
+				f, err = caffe.ApplyTransformed(mapAll, im, t)
+			case *tileSize > 0:
+				opts := caffe.TileOptions{MaxSize: image.Pt(*tileSize, *tileSize), Workers: *workers}
+				f, err = caffe.ApplyTiled(apply, b.arch, layer, im, opts)
+			default:
+				f, err = apply(im)
+			}
+			if err != nil {
+				log.Fatalln(err)
+			}
+			log.Println(im.Bounds().Size(), "->", f.Size())
+			if err := writeFeature(f, *format); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	},
+}
+
+// writeFeature prints a feature image to stdout.
+// The text format has one line "x,y,channel,value" per element.
+func writeFeature(f *rimg64.Multi, format string) error {
+	w := bufio.NewWriter(os.Stdout)
+	switch format {
+	case "json":
+		data, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		w.Write(data)
+		w.WriteString("\n")
+	case "binary":
+		if err := caffe.WriteMulti(w, f); err != nil {
+			return err
+		}
+	default:
+		for i := 0; i < f.Width; i++ {
+			for j := 0; j < f.Height; j++ {
+				for k := 0; k < f.Channels; k++ {
+					fmt.Fprintf(w, "%d,%d,%d,%g\n", i, j, k, f.At(i, j, k))
+				}
+			}
+		}
+	}
+	return w.Flush()
+}
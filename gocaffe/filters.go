@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+var filtersCmd = &command{
+	Args:  "layer out.png",
+	Short: "Save the filters of a convolution layer as a montage",
+	Flags: func(fs *flag.FlagSet) func([]string) {
+		var (
+			model     = addModelFlags(fs)
+			columns   = fs.Int("columns", 0, "Number of filters in each row (0 for square)")
+			padding   = fs.Int("padding", 2, "Pixels between filters")
+			zoom      = fs.Int("zoom", 4, "Pixels per weight")
+			scale     = fs.Float64("scale", 1, "Contrast gain after normalization")
+			normalize = fs.String("normalize", "filter", "Normalize each filter or the whole layer: filter or global")
+		)
+		return func(args []string) {
+			if len(args) != 2 {
+				usage(fs)
+			}
+			layer, outFile := args[0], args[1]
+			norm, err := caffe.ParseNormalization(*normalize)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			files, err := model.resolve()
+			if err != nil {
+				log.Fatalln(err)
+			}
+			net, report, err := files.LoadNet(caffe.CopyOptions{})
+			if err != nil {
+				log.Fatalln(err)
+			}
+			if !report.OK() {
+				log.Print(report)
+			}
+			im, err := caffe.FilterMontage(net, layer, caffe.MontageOptions{
+				Columns:   *columns,
+				Padding:   *padding,
+				Zoom:      *zoom,
+				Scale:     *scale,
+				Normalize: norm,
+			})
+			if err != nil {
+				log.Fatalln(err)
+			}
+			if err := caffe.SavePNG(outFile, im); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	},
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// modelFlags select a model from the registry or by its files.
+type modelFlags struct {
+	files caffe.ModelFiles
+	mean  string
+}
+
+func addModelFlags(fs *flag.FlagSet) *modelFlags {
+	f := new(modelFlags)
+	fs.StringVar(&f.files.Name, "model", "", "Name of model in registry")
+	fs.StringVar(&caffe.ModelsDir, "models-dir", "models", "Directory which contains the model registry")
+	fs.StringVar(&f.files.Arch, "arch", "", "Network definition in text, JSON or binary (default from registry)")
+	fs.StringVar(&f.files.Weights, "weights", "", "Weights (default from registry)")
+	fs.StringVar(&f.files.MeanFile, "mean-file", "", "Mean numpy file for Caffe (default from registry)")
+	fs.StringVar(&f.mean, "mean", "", "Mean pixel as r,g,b for the native engine (default from registry)")
+	return f
+}
+
+// resolve parses the mean and takes the files which are not given from the registry.
+func (f *modelFlags) resolve() (caffe.ModelFiles, error) {
+	files := f.files
+	if f.mean != "" {
+		mean, err := caffe.ParseMean(f.mean)
+		if err != nil {
+			return caffe.ModelFiles{}, fmt.Errorf("parse mean: %v", err)
+		}
+		files.Mean = mean
+	}
+	files, err := files.Resolve()
+	if err != nil {
+		return caffe.ModelFiles{}, err
+	}
+	if files.Arch == "" {
+		return caffe.ModelFiles{}, fmt.Errorf("give -model or -arch")
+	}
+	return files, nil
+}
+
+// backendFlags choose between the native engine and Caffe.
+type backendFlags struct {
+	name   string
+	script string
+}
+
+func addBackendFlags(fs *flag.FlagSet) *backendFlags {
+	f := new(backendFlags)
+	fs.StringVar(&f.name, "backend", "caffe", "Compute with caffe or native")
+	fs.StringVar(&f.script, "script", "extract.py", "Python script for Caffe")
+	return f
+}
+
+// backend computes the layers of one model.
+type backend struct {
+	name, script string
+	files        caffe.ModelFiles
+	// Network without weights, for Caffe and geometry.
+	arch *caffe.NetParameter
+	// Network with weights, for the native engine.
+	net *caffe.NetParameter
+}
+
+// load reads the network and, for the native engine, its weights.
+func (f *backendFlags) load(files caffe.ModelFiles, opts caffe.CopyOptions) (*backend, error) {
+	b := &backend{name: f.name, script: f.script, files: files}
+	var err error
+	b.arch, err = files.LoadArch()
+	if err != nil {
+		return nil, err
+	}
+	switch f.name {
+	case "native":
+		if files.Mean == nil {
+			return nil, fmt.Errorf("native backend needs -mean")
+		}
+		var report *caffe.WeightsReport
+		b.net, report, err = files.LoadNet(opts)
+		if err != nil {
+			return nil, err
+		}
+		if !report.OK() {
+			log.Print(report)
+		}
+	case "caffe":
+		if files.Weights == "" || files.MeanFile == "" {
+			return nil, fmt.Errorf("caffe backend needs -weights and -mean-file")
+		}
+	default:
+		return nil, fmt.Errorf("unknown backend: %s", f.name)
+	}
+	return b, nil
+}
+
+// mapper returns a function which computes the output of a layer for a batch of images.
+func (b *backend) mapper(layer string) (func([]image.Image) ([]*rimg64.Multi, error), error) {
+	if b.net == nil {
+		subset := caffe.SubsetForOutput(b.arch, layer)
+		return func(ims []image.Image) ([]*rimg64.Multi, error) {
+			return caffe.Extract(b.script, ims, layer, subset, b.files.Weights, b.files.MeanFile)
+		}, nil
+	}
+	phi, err := caffe.FromProto(b.net, layer, b.files.Mean)
+	if err != nil {
+		return nil, err
+	}
+	return caffe.ApplyEach(phi), nil
+}
+
+// addFormatFlag adds the output format flag.
+// The first choice is the default.
+func addFormatFlag(fs *flag.FlagSet, choices ...string) *string {
+	return fs.String("format", choices[0], fmt.Sprintf("Output format: %s", strings.Join(choices, ", ")))
+}
+
+func checkFormat(format string, choices ...string) error {
+	for _, c := range choices {
+		if format == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown format: %s", format)
+}
+
+// usage prints the usage of a command and exits.
+func usage(fs *flag.FlagSet) {
+	fs.Usage()
+	os.Exit(1)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// command is a subcommand of gocaffe.
+type command struct {
+	// Arguments after the flags, for usage.
+	Args  string
+	Short string
+	// Flags registers the flags of the command
+	// and returns the function which runs it with the remaining arguments.
+	Flags func(fs *flag.FlagSet) func(args []string)
+}
+
+var commands = map[string]*command{
+	"bench":         benchCmd,
+	"classify":      classifyCmd,
+	"convert":       convertCmd,
+	"extract":       extractCmd,
+	"filters":       filtersCmd,
+	"model-to-json": modelToJSONCmd,
+	"test":          testCmd,
+	"visualize":     visualizeCmd,
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-config file] command [flags] args\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Commands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, commands[name].Short)
+		}
+		fmt.Fprintf(os.Stderr, "Run %s command -h for the flags of a command.\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "The config file gives default flags as JSON, such as:")
+		fmt.Fprintln(os.Stderr, `  {"models-dir": "/data/models", "backend": "native", "extract": {"format": "json"}}`)
+		fmt.Fprintln(os.Stderr, "Top-level values apply to every command which has the flag,")
+		fmt.Fprintln(os.Stderr, "objects apply to one command. Flags on the command line take precedence.")
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	var configFile string
+	flag.StringVar(&configFile, "config", os.Getenv("GOCAFFE_CONFIG"), "Config file with default flags (default $GOCAFFE_CONFIG)")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	name := flag.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "unknown command:", name)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s %s [flags] %s\n", os.Args[0], name, cmd.Args)
+		fmt.Fprintln(os.Stderr, cmd.Short)
+		fs.PrintDefaults()
+	}
+	run := cmd.Flags(fs)
+	if configFile != "" {
+		conf, err := loadConfig(configFile)
+		if err != nil {
+			log.Fatalln("load config:", err)
+		}
+		if err := conf.apply(fs); err != nil {
+			log.Fatalf("config %s: %v", configFile, err)
+		}
+	}
+	fs.Parse(flag.Args()[1:])
+	run(fs.Args())
+}
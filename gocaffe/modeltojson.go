@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+var modelToJSONCmd = &command{
+	Args:  "in.(prototxt|json|caffemodel) out.(prototxt|json|caffemodel)",
+	Short: "Convert a network or solver between text, JSON and binary",
+	Flags: func(fs *flag.FlagSet) func([]string) {
+		var (
+			msgType = fs.String("type", "net", "Message type (net or solver)")
+			fromStr = fs.String("from", "", "Input format (text, json or binary; default from extension)")
+			toStr   = fs.String("to", "", "Output format (text, json or binary; default from extension)")
+		)
+		return func(args []string) {
+			if len(args) != 2 {
+				usage(fs)
+			}
+			inFile, outFile := args[0], args[1]
+
+			var msg proto.Message
+			switch *msgType {
+			case "net":
+				msg = new(caffe.NetParameter)
+			case "solver":
+				msg = new(caffe.SolverParameter)
+			default:
+				log.Fatalln("unknown message type:", *msgType)
+			}
+			from, err := formatOf(inFile, *fromStr)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			to, err := formatOf(outFile, *toStr)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			// Convert in memory so that the input may also be the output
+			// and a failed conversion leaves no partial file.
+			data, err := ioutil.ReadFile(inFile)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			var out bytes.Buffer
+			if err := caffe.Convert(&out, bytes.NewReader(data), msg, from, to); err != nil {
+				log.Fatalln(err)
+			}
+			if err := writeFileAtomic(outFile, out.Bytes()); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	},
+}
+
+// writeFileAtomic writes to a temporary file in the same directory
+// and renames it, so that the file is either complete or unchanged.
+func writeFileAtomic(fname string, data []byte) error {
+	tmp, err := ioutil.TempFile(path.Dir(fname), "tmp-")
+	if err != nil {
+		return err
+	}
+	// Temporary files are only readable by the owner.
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), fname); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func formatOf(fname, name string) (caffe.Format, error) {
+	if name != "" {
+		return caffe.ParseFormat(name)
+	}
+	return caffe.FormatOf(fname)
+}
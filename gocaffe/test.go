@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+var testCmd = &command{
+	Args:  "layer image",
+	Short: "Compare every layer up to the given layer in Caffe and in Go; exit with 1 if they diverge and 2 on error",
+	Flags: func(fs *flag.FlagSet) func([]string) {
+		var (
+			model  = addModelFlags(fs)
+			script = fs.String("script", "extract.py", "Python script for Caffe")
+			epsRel = fs.Float64("eps-rel", 1e-6, "Relative error threshold")
+			epsAbs = fs.Float64("eps-abs", 1e-6, "Absolute error threshold")
+			trials = fs.Int("trials", 16, "Number of trials for benchmark (0 to skip)")
+			warmup = fs.Int("warmup", 1, "Number of benchmark trials to discard")
+			strict = fs.Bool("strict", false, "Fail if weights are missing or have the wrong shape")
+			format = addFormatFlag(fs, "text", "json")
+		)
+		return func(args []string) {
+			if len(args) != 2 {
+				fs.Usage()
+				os.Exit(2)
+			}
+			if err := checkFormat(*format, "text", "json"); err != nil {
+				fatal(err)
+			}
+			layer, imageFile := args[0], args[1]
+			files, err := model.resolve()
+			if err != nil {
+				fatal(err)
+			}
+			if files.Mean == nil || files.Weights == "" || files.MeanFile == "" {
+				fatal("test needs -weights, -mean-file and -mean")
+			}
+			arch, err := files.LoadArch()
+			if err != nil {
+				fatal("load architecture:", err)
+			}
+			net, copied, err := files.LoadNet(caffe.CopyOptions{Strict: *strict})
+			if err != nil {
+				fatal(err)
+			}
+			log.Print(copied)
+			im, err := caffe.LoadImage(imageFile)
+			if err != nil {
+				fatal("load image:", err)
+			}
+			res, err := test(im, net, layer, files.Mean, *script, arch, files.Weights, files.MeanFile, *epsRel, *epsAbs)
+			if err != nil {
+				fatal(err)
+			}
+			// Keep stdout for JSON.
+			out := io.Writer(os.Stdout)
+			if *format == "json" {
+				data, err := json.MarshalIndent(res, "", "\t")
+				if err != nil {
+					fatal(err)
+				}
+				fmt.Println(string(data))
+				out = os.Stderr
+			} else if err := res.WriteText(os.Stdout); err != nil {
+				fatal(err)
+			}
+			if *trials > 0 {
+				err = benchLayer(out, im, net, layer, files.Mean, *script, arch, files.Weights, files.MeanFile, *warmup, *trials)
+				if err != nil {
+					fatal(err)
+				}
+			}
+			if res.FirstDiverged != "" {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// fatal logs an error and exits with status 2,
+// which distinguishes errors from divergence.
+func fatal(v ...interface{}) {
+	log.Println(v...)
+	os.Exit(2)
+}
+
+// result is the comparison of every layer up to the output.
+type result struct {
+	Layers []layerResult
+	// Name of the first layer whose outputs are different.
+	FirstDiverged string `json:",omitempty"`
+}
+
+type layerResult struct {
+	Layer    string
+	Diverged bool
+	caffe.Divergence
+}
+
+func (r *result) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "layer\tsize\tmax abs\tmax rel\tworst\twant\tgot\tdiff\t")
+	for _, l := range r.Layers {
+		status := ""
+		if l.Diverged {
+			status = "  DIVERGED"
+		}
+		if l.WantSize != l.GotSize {
+			fmt.Fprintf(tw, "%s\twant %v, got %v\t\t\t\t\t\t\t%s\n", l.Layer, l.WantSize, l.GotSize, status)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%v\t%.3g\t%.3g\t%v\t%g\t%g\t%d\t%s\n",
+			l.Layer, l.WantSize, l.MaxAbs, l.MaxRel, l.Worst, l.Want, l.Got, l.NumDiff, status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if r.FirstDiverged != "" {
+		_, err := fmt.Fprintln(w, "FAIL: first divergence at layer", r.FirstDiverged)
+		return err
+	}
+	_, err := fmt.Fprintln(w, "PASS")
+	return err
+}
+
+// test compares the output of every layer up to the given layer.
+// net is a populated network, which will be converted to a native feature transform.
+// arch is the empty network whose architecture will be used to load weightsFile.
+func test(im image.Image, net *caffe.NetParameter, layer string, mean []float64, script string, arch *caffe.NetParameter, weightsFile, meanFile string, epsRel, epsAbs float64) (*result, error) {
+	chain, err := caffe.LayerChain(net, layer)
+	if err != nil {
+		return nil, err
+	}
+	res := new(result)
+	for _, name := range chain {
+		log.Println("test layer:", name)
+		phi, err := caffe.FromProto(net, name, mean)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: convert to feature transform: %v", name, err)
+		}
+		// Take the architecture subset necessary to compute this layer.
+		subset := caffe.SubsetForOutput(arch, name)
+		ys, err := caffe.Extract(script, []image.Image{im}, name, subset, weightsFile, meanFile)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: compute features using caffe: %v", name, err)
+		}
+		got, err := phi.Apply(im)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: compute features in go: %v", name, err)
+		}
+		d := caffe.Compare(ys[0], got, epsAbs, epsRel)
+		res.Layers = append(res.Layers, layerResult{Layer: name, Diverged: d.Diverged(), Divergence: d})
+		if d.Diverged() && res.FirstDiverged == "" {
+			res.FirstDiverged = name
+		}
+	}
+	return res, nil
+}
+
+// net is a populated network, which will be converted to a native feature transform.
+// arch is the empty network whose architecture will be used to load weightsFile.
+func benchLayer(w io.Writer, im image.Image, net *caffe.NetParameter, layer string, mean []float64, script string, arch *caffe.NetParameter, weightsFile, meanFile string, warmup, trials int) error {
+	log.Println("benchmark layer:", layer)
+	phi, err := caffe.FromProto(net, layer, mean)
+	if err != nil {
+		return fmt.Errorf("convert to feature transform: %v", err)
+	}
+	var durTotal, durForward, durNative []time.Duration
+	for i := -warmup; i < trials; i++ {
+		// Take the architecture subset necessary to compute this layer.
+		subset := caffe.SubsetForOutput(arch, layer)
+		log.Print("compute features using caffe")
+		_, timing, err := caffe.ExtractTimed(script, []image.Image{im}, layer, subset, weightsFile, meanFile)
+		if err != nil {
+			return fmt.Errorf("compute features using caffe: %v", err)
+		}
+		log.Print("compute features in go")
+		start := time.Now()
+		_, err = phi.Apply(im)
+		if err != nil {
+			return fmt.Errorf("compute features in go: %v", err)
+		}
+		if i >= 0 {
+			durTotal = append(durTotal, timing.Total)
+			durForward = append(durForward, timing.Forward)
+			durNative = append(durNative, time.Since(start))
+		}
+	}
+	fmt.Fprintln(w, "caffe total:", caffe.ComputeDurationStats(durTotal))
+	fmt.Fprintln(w, "caffe forward:", caffe.ComputeDurationStats(durForward))
+	fmt.Fprintln(w, "native:", caffe.ComputeDurationStats(durNative))
+	return nil
+}
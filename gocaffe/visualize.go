@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+var visualizeCmd = &command{
+	Args:  "image layer,...",
+	Short: "Save each channel of the output of layers as images with an HTML index",
+	Flags: func(fs *flag.FlagSet) func([]string) {
+		var (
+			model   = addModelFlags(fs)
+			backend = addBackendFlags(fs)
+			outDir  = fs.String("out", ".", "Directory in which to create a directory for each layer")
+		)
+		return func(args []string) {
+			if len(args) != 2 {
+				usage(fs)
+			}
+			im, err := caffe.LoadImage(args[0])
+			if err != nil {
+				log.Fatalln(err)
+			}
+			files, err := model.resolve()
+			if err != nil {
+				log.Fatalln(err)
+			}
+			b, err := backend.load(files, caffe.CopyOptions{})
+			if err != nil {
+				log.Fatalln(err)
+			}
+			for _, output := range strings.Split(args[1], ",") {
+				mapAll, err := b.mapper(output)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				feats, err := mapAll([]image.Image{im})
+				if err != nil {
+					log.Fatalln(err)
+				}
+				if err := visualize(feats[0], path.Join(*outDir, output)); err != nil {
+					log.Fatalln(err)
+				}
+			}
+		}
+	},
+}
+
+func visualize(f *rimg64.Multi, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// Save each channel as an image.
+	for k := 0; k < f.Channels; k++ {
+		im := rimg64.ToGray(normalize(f.Channel(k), 1e-3, true, false))
+		fname := fmt.Sprintf("%d.png", k)
+		if err := caffe.SavePNG(path.Join(dir, fname), im); err != nil {
+			return err
+		}
+	}
+	// Create HTML file.
+	file, err := os.Create(path.Join(dir, "index.html"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for k := 0; k < f.Channels; k++ {
+		fmt.Fprintf(file, "<img src=\"%d.png\" />\n", k)
+	}
+	return nil
+}
+
+func square(x float64) float64 { return x * x }
+
+func normMulti(f *rimg64.Multi, eps float64, pos bool, inv bool) *rimg64.Multi {
+	min, max := -eps, +eps
+	for i := 0; i < f.Width; i++ {
+		for j := 0; j < f.Height; j++ {
+			for k := 0; k < f.Channels; k++ {
+				min = math.Min(min, f.At(i, j, k))
+				max = math.Max(max, f.At(i, j, k))
+			}
+		}
+	}
+	if pos {
+		min = 0
+	}
+	if inv {
+		min, max = max, min
+	}
+	g := rimg64.NewMulti(f.Width, f.Height, f.Channels)
+	for i := 0; i < f.Width; i++ {
+		for j := 0; j < f.Height; j++ {
+			for k := 0; k < f.Channels; k++ {
+				g.Set(i, j, k, (f.At(i, j, k)-min)/(max-min))
+			}
+		}
+	}
+	return g
+}
+
+func normalize(f *rimg64.Image, eps float64, pos bool, inv bool) *rimg64.Image {
+	min, max := -eps, +eps
+	for i := 0; i < f.Width; i++ {
+		for j := 0; j < f.Height; j++ {
+			min = math.Min(min, f.At(i, j))
+			max = math.Max(max, f.At(i, j))
+		}
+	}
+	if pos {
+		min = 0
+	}
+	if inv {
+		min, max = max, min
+	}
+	g := rimg64.New(f.Width, f.Height)
+	for i := 0; i < f.Width; i++ {
+		for j := 0; j < f.Height; j++ {
+			g.Set(i, j, (f.At(i, j)-min)/(max-min))
+		}
+	}
+	return g
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s weights.caffemodel\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	var (
+		hist   string
+		bins   int
+		outDir string
+		eps    float64
+	)
+	flag.StringVar(&hist, "hist", "", "Render histograms as text or png")
+	flag.IntVar(&bins, "bins", 40, "Number of histogram bins")
+	flag.StringVar(&outDir, "out", "hist", "Output directory for png histograms")
+	flag.Float64Var(&eps, "eps", 1e-8, "Filters with all weights at most eps in magnitude are dead")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if hist != "" && hist != "text" && hist != "png" {
+		log.Fatalln("unknown histogram format:", hist)
+	}
+	if bins <= 0 {
+		log.Fatalln("number of bins must be positive:", bins)
+	}
+	weightsFile := flag.Arg(0)
+
+	data, err := ioutil.ReadFile(weightsFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	net := new(caffe.NetParameter)
+	if err := proto.Unmarshal(data, net); err != nil {
+		log.Fatalln(err)
+	}
+	if hist == "png" {
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "layer\tblob\tnum\tchannels\theight\twidth\tmean\tstd\tmin\tmax\tsparsity\tnan\tinf\tdead\t")
+	var dead []string
+	for _, layer := range net.Layers {
+		for i, blob := range layer.Blobs {
+			s := caffe.ComputeBlobStats(blob)
+			var numDead int
+			if i == 0 {
+				filts := caffe.DeadFilters(layer, eps)
+				numDead = len(filts)
+				if numDead > 0 {
+					dead = append(dead, fmt.Sprintf("%s: %d dead filters: %v", layer.GetName(), numDead, filts))
+				}
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%.4g\t%.4g\t%.4g\t%.4g\t%.3f\t%d\t%d\t%d\t\n",
+				layer.GetName(), i, s.Dims.Out, s.Dims.In, s.Dims.Height, s.Dims.Width,
+				s.Mean, s.Std, s.Min, s.Max, s.Sparsity, s.NaN, s.Inf, numDead)
+		}
+	}
+	w.Flush()
+	for _, msg := range dead {
+		fmt.Println("warning:", msg)
+	}
+
+	if hist == "" {
+		return
+	}
+	for _, layer := range net.Layers {
+		for i, blob := range layer.Blobs {
+			h := caffe.NewHistogram(blob.Data, bins)
+			switch hist {
+			case "text":
+				fmt.Printf("\n%s blob %d:\n", layer.GetName(), i)
+				if err := h.WriteText(os.Stdout, 60); err != nil {
+					log.Fatalln(err)
+				}
+			case "png":
+				// Layer names such as "conv1/3x3" are not valid file names.
+				name := strings.Replace(layer.GetName(), "/", "_", -1)
+				fname := path.Join(outDir, fmt.Sprintf("%s-%d.png", name, i))
+				if err := caffe.SavePNG(fname, h.Image(4*bins, 100)); err != nil {
+					log.Fatalln(err)
+				}
+			}
+		}
+	}
+}
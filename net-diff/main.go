@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s old.prototxt [old.caffemodel] new.prototxt [new.caffemodel]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Exits with status 1 if the networks differ and 2 on error.")
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	var asJSON bool
+	flag.BoolVar(&asJSON, "json", false, "Print JSON instead of text")
+	flag.Parse()
+
+	var a, b *caffe.NetParameter
+	switch flag.NArg() {
+	case 2:
+		a, b = load(flag.Arg(0), ""), load(flag.Arg(1), "")
+	case 4:
+		a, b = load(flag.Arg(0), flag.Arg(1)), load(flag.Arg(2), flag.Arg(3))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	d := caffe.DiffNets(a, b)
+	if asJSON {
+		data, err := json.MarshalIndent(d, "", "\t")
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(string(data))
+	} else if err := d.WriteText(os.Stdout); err != nil {
+		fatal(err)
+	}
+	if !d.Empty() {
+		os.Exit(1)
+	}
+}
+
+// fatal logs an error and exits with status 2,
+// which distinguishes errors from differences as in diff(1).
+func fatal(v ...interface{}) {
+	log.Println(v...)
+	os.Exit(2)
+}
+
+// load reads a network and copies in its weights if weightsFile is not empty.
+func load(modelFile, weightsFile string) *caffe.NetParameter {
+	net := new(caffe.NetParameter)
+	if err := caffe.LoadMessage(modelFile, net); err != nil {
+		fatal(err)
+	}
+	if weightsFile == "" {
+		return net
+	}
+	weights, err := caffe.LoadWeights(weightsFile)
+	if err != nil {
+		fatal("load weights:", err)
+	}
+	report, err := caffe.CopyWeights(net, weights, caffe.CopyOptions{})
+	if err != nil {
+		fatal(err)
+	}
+	if !report.OK() {
+		log.Printf("%s:\n%v", weightsFile, report)
+	}
+	return net
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s model.(prototxt|json) out.dot\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	var (
+		width, height int
+		params        bool
+		field         bool
+		highlight     string
+	)
+	flag.IntVar(&width, "width", 0, "Input width for shapes (default from input_dim)")
+	flag.IntVar(&height, "height", 0, "Input height for shapes (default from input_dim)")
+	flag.BoolVar(&params, "params", false, "Show number of parameters")
+	flag.BoolVar(&field, "field", false, "Show rate and receptive field")
+	flag.StringVar(&highlight, "highlight", "", "Highlight the layers needed to compute this layer")
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	var (
+		modelFile = flag.Arg(0)
+		outFile   = flag.Arg(1)
+	)
+
+	net := new(caffe.NetParameter)
+	if err := caffe.LoadMessage(modelFile, net); err != nil {
+		log.Fatalln(err)
+	}
+	var opts caffe.DOTOptions
+	if in, err := caffe.InputShape(net); err == nil {
+		opts.Input = &in
+	}
+	if width > 0 && height > 0 {
+		// Keep the number of channels of the input if it is known.
+		channels := 3
+		if opts.Input != nil {
+			channels = opts.Input.Channels
+		}
+		opts.Input = &caffe.Shape{Channels: channels, Height: height, Width: width}
+	}
+	opts.Params = params
+	opts.Field = field
+	if highlight != "" {
+		if !caffe.HasLayer(net, highlight) {
+			log.Fatalln("could not find layer:", highlight)
+		}
+		opts.Highlight = caffe.SubsetForOutput(net, highlight)
+	}
+
+	file, err := os.Create(outFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer file.Close()
+	if err := caffe.WriteDOT(file, net, opts); err != nil {
+		log.Fatalln(err)
+	}
+}
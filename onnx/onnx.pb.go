@@ -0,0 +1,645 @@
+// Code generated by protoc-gen-go.
+// source: onnx.proto
+// DO NOT EDIT!
+
+/*
+Package onnx is a generated protocol buffer package.
+
+It is generated from these files:
+	onnx.proto
+
+It has these top-level messages:
+	AttributeProto
+	ValueInfoProto
+	NodeProto
+	ModelProto
+	GraphProto
+	TensorProto
+	TensorShapeProto
+	TypeProto
+	OperatorSetIdProto
+*/
+package onnx
+
+import proto "code.google.com/p/goprotobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+type AttributeProto_AttributeType int32
+
+const (
+	AttributeProto_UNDEFINED AttributeProto_AttributeType = 0
+	AttributeProto_FLOAT     AttributeProto_AttributeType = 1
+	AttributeProto_INT       AttributeProto_AttributeType = 2
+	AttributeProto_STRING    AttributeProto_AttributeType = 3
+	AttributeProto_TENSOR    AttributeProto_AttributeType = 4
+	AttributeProto_GRAPH     AttributeProto_AttributeType = 5
+	AttributeProto_FLOATS    AttributeProto_AttributeType = 6
+	AttributeProto_INTS      AttributeProto_AttributeType = 7
+	AttributeProto_STRINGS   AttributeProto_AttributeType = 8
+	AttributeProto_TENSORS   AttributeProto_AttributeType = 9
+	AttributeProto_GRAPHS    AttributeProto_AttributeType = 10
+)
+
+var AttributeProto_AttributeType_name = map[int32]string{
+	0:  "UNDEFINED",
+	1:  "FLOAT",
+	2:  "INT",
+	3:  "STRING",
+	4:  "TENSOR",
+	5:  "GRAPH",
+	6:  "FLOATS",
+	7:  "INTS",
+	8:  "STRINGS",
+	9:  "TENSORS",
+	10: "GRAPHS",
+}
+var AttributeProto_AttributeType_value = map[string]int32{
+	"UNDEFINED": 0,
+	"FLOAT":     1,
+	"INT":       2,
+	"STRING":    3,
+	"TENSOR":    4,
+	"GRAPH":     5,
+	"FLOATS":    6,
+	"INTS":      7,
+	"STRINGS":   8,
+	"TENSORS":   9,
+	"GRAPHS":    10,
+}
+
+func (x AttributeProto_AttributeType) Enum() *AttributeProto_AttributeType {
+	p := new(AttributeProto_AttributeType)
+	*p = x
+	return p
+}
+func (x AttributeProto_AttributeType) String() string {
+	return proto.EnumName(AttributeProto_AttributeType_name, int32(x))
+}
+func (x *AttributeProto_AttributeType) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(AttributeProto_AttributeType_value, data, "AttributeProto_AttributeType")
+	if err != nil {
+		return err
+	}
+	*x = AttributeProto_AttributeType(value)
+	return nil
+}
+
+type TensorProto_DataType int32
+
+const (
+	TensorProto_UNDEFINED TensorProto_DataType = 0
+	TensorProto_FLOAT     TensorProto_DataType = 1
+	TensorProto_UINT8     TensorProto_DataType = 2
+	TensorProto_INT8      TensorProto_DataType = 3
+	TensorProto_UINT16    TensorProto_DataType = 4
+	TensorProto_INT16     TensorProto_DataType = 5
+	TensorProto_INT32     TensorProto_DataType = 6
+	TensorProto_INT64     TensorProto_DataType = 7
+	TensorProto_STRING    TensorProto_DataType = 8
+	TensorProto_BOOL      TensorProto_DataType = 9
+	TensorProto_FLOAT16   TensorProto_DataType = 10
+	TensorProto_DOUBLE    TensorProto_DataType = 11
+)
+
+var TensorProto_DataType_name = map[int32]string{
+	0:  "UNDEFINED",
+	1:  "FLOAT",
+	2:  "UINT8",
+	3:  "INT8",
+	4:  "UINT16",
+	5:  "INT16",
+	6:  "INT32",
+	7:  "INT64",
+	8:  "STRING",
+	9:  "BOOL",
+	10: "FLOAT16",
+	11: "DOUBLE",
+}
+var TensorProto_DataType_value = map[string]int32{
+	"UNDEFINED": 0,
+	"FLOAT":     1,
+	"UINT8":     2,
+	"INT8":      3,
+	"UINT16":    4,
+	"INT16":     5,
+	"INT32":     6,
+	"INT64":     7,
+	"STRING":    8,
+	"BOOL":      9,
+	"FLOAT16":   10,
+	"DOUBLE":    11,
+}
+
+func (x TensorProto_DataType) Enum() *TensorProto_DataType {
+	p := new(TensorProto_DataType)
+	*p = x
+	return p
+}
+func (x TensorProto_DataType) String() string {
+	return proto.EnumName(TensorProto_DataType_name, int32(x))
+}
+func (x *TensorProto_DataType) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(TensorProto_DataType_value, data, "TensorProto_DataType")
+	if err != nil {
+		return err
+	}
+	*x = TensorProto_DataType(value)
+	return nil
+}
+
+type AttributeProto struct {
+	Name             *string                       `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	DocString        *string                       `protobuf:"bytes,13,opt,name=doc_string" json:"doc_string,omitempty"`
+	Type             *AttributeProto_AttributeType `protobuf:"varint,20,opt,name=type,enum=onnx.AttributeProto_AttributeType" json:"type,omitempty"`
+	F                *float32                      `protobuf:"fixed32,2,opt,name=f" json:"f,omitempty"`
+	I                *int64                        `protobuf:"varint,3,opt,name=i" json:"i,omitempty"`
+	S                []byte                        `protobuf:"bytes,4,opt,name=s" json:"s,omitempty"`
+	T                *TensorProto                  `protobuf:"bytes,5,opt,name=t" json:"t,omitempty"`
+	Floats           []float32                     `protobuf:"fixed32,7,rep,name=floats" json:"floats,omitempty"`
+	Ints             []int64                       `protobuf:"varint,8,rep,name=ints" json:"ints,omitempty"`
+	Strings          [][]byte                      `protobuf:"bytes,9,rep,name=strings" json:"strings,omitempty"`
+	XXX_unrecognized []byte                        `json:"-"`
+}
+
+func (m *AttributeProto) Reset()         { *m = AttributeProto{} }
+func (m *AttributeProto) String() string { return proto.CompactTextString(m) }
+func (*AttributeProto) ProtoMessage()    {}
+
+func (m *AttributeProto) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *AttributeProto) GetDocString() string {
+	if m != nil && m.DocString != nil {
+		return *m.DocString
+	}
+	return ""
+}
+
+func (m *AttributeProto) GetType() AttributeProto_AttributeType {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return AttributeProto_UNDEFINED
+}
+
+func (m *AttributeProto) GetF() float32 {
+	if m != nil && m.F != nil {
+		return *m.F
+	}
+	return 0
+}
+
+func (m *AttributeProto) GetI() int64 {
+	if m != nil && m.I != nil {
+		return *m.I
+	}
+	return 0
+}
+
+func (m *AttributeProto) GetS() []byte {
+	if m != nil {
+		return m.S
+	}
+	return nil
+}
+
+func (m *AttributeProto) GetT() *TensorProto {
+	if m != nil {
+		return m.T
+	}
+	return nil
+}
+
+func (m *AttributeProto) GetFloats() []float32 {
+	if m != nil {
+		return m.Floats
+	}
+	return nil
+}
+
+func (m *AttributeProto) GetInts() []int64 {
+	if m != nil {
+		return m.Ints
+	}
+	return nil
+}
+
+func (m *AttributeProto) GetStrings() [][]byte {
+	if m != nil {
+		return m.Strings
+	}
+	return nil
+}
+
+type ValueInfoProto struct {
+	Name             *string    `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Type             *TypeProto `protobuf:"bytes,2,opt,name=type" json:"type,omitempty"`
+	DocString        *string    `protobuf:"bytes,3,opt,name=doc_string" json:"doc_string,omitempty"`
+	XXX_unrecognized []byte     `json:"-"`
+}
+
+func (m *ValueInfoProto) Reset()         { *m = ValueInfoProto{} }
+func (m *ValueInfoProto) String() string { return proto.CompactTextString(m) }
+func (*ValueInfoProto) ProtoMessage()    {}
+
+func (m *ValueInfoProto) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *ValueInfoProto) GetType() *TypeProto {
+	if m != nil {
+		return m.Type
+	}
+	return nil
+}
+
+func (m *ValueInfoProto) GetDocString() string {
+	if m != nil && m.DocString != nil {
+		return *m.DocString
+	}
+	return ""
+}
+
+type NodeProto struct {
+	Input            []string          `protobuf:"bytes,1,rep,name=input" json:"input,omitempty"`
+	Output           []string          `protobuf:"bytes,2,rep,name=output" json:"output,omitempty"`
+	Name             *string           `protobuf:"bytes,3,opt,name=name" json:"name,omitempty"`
+	OpType           *string           `protobuf:"bytes,4,opt,name=op_type" json:"op_type,omitempty"`
+	Domain           *string           `protobuf:"bytes,7,opt,name=domain" json:"domain,omitempty"`
+	Attribute        []*AttributeProto `protobuf:"bytes,5,rep,name=attribute" json:"attribute,omitempty"`
+	DocString        *string           `protobuf:"bytes,6,opt,name=doc_string" json:"doc_string,omitempty"`
+	XXX_unrecognized []byte            `json:"-"`
+}
+
+func (m *NodeProto) Reset()         { *m = NodeProto{} }
+func (m *NodeProto) String() string { return proto.CompactTextString(m) }
+func (*NodeProto) ProtoMessage()    {}
+
+func (m *NodeProto) GetInput() []string {
+	if m != nil {
+		return m.Input
+	}
+	return nil
+}
+
+func (m *NodeProto) GetOutput() []string {
+	if m != nil {
+		return m.Output
+	}
+	return nil
+}
+
+func (m *NodeProto) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *NodeProto) GetOpType() string {
+	if m != nil && m.OpType != nil {
+		return *m.OpType
+	}
+	return ""
+}
+
+func (m *NodeProto) GetDomain() string {
+	if m != nil && m.Domain != nil {
+		return *m.Domain
+	}
+	return ""
+}
+
+func (m *NodeProto) GetAttribute() []*AttributeProto {
+	if m != nil {
+		return m.Attribute
+	}
+	return nil
+}
+
+func (m *NodeProto) GetDocString() string {
+	if m != nil && m.DocString != nil {
+		return *m.DocString
+	}
+	return ""
+}
+
+type ModelProto struct {
+	IrVersion        *int64                `protobuf:"varint,1,opt,name=ir_version" json:"ir_version,omitempty"`
+	OpsetImport      []*OperatorSetIdProto `protobuf:"bytes,8,rep,name=opset_import" json:"opset_import,omitempty"`
+	ProducerName     *string               `protobuf:"bytes,2,opt,name=producer_name" json:"producer_name,omitempty"`
+	ProducerVersion  *string               `protobuf:"bytes,3,opt,name=producer_version" json:"producer_version,omitempty"`
+	Domain           *string               `protobuf:"bytes,4,opt,name=domain" json:"domain,omitempty"`
+	ModelVersion     *int64                `protobuf:"varint,5,opt,name=model_version" json:"model_version,omitempty"`
+	DocString        *string               `protobuf:"bytes,6,opt,name=doc_string" json:"doc_string,omitempty"`
+	Graph            *GraphProto           `protobuf:"bytes,7,opt,name=graph" json:"graph,omitempty"`
+	XXX_unrecognized []byte                `json:"-"`
+}
+
+func (m *ModelProto) Reset()         { *m = ModelProto{} }
+func (m *ModelProto) String() string { return proto.CompactTextString(m) }
+func (*ModelProto) ProtoMessage()    {}
+
+func (m *ModelProto) GetIrVersion() int64 {
+	if m != nil && m.IrVersion != nil {
+		return *m.IrVersion
+	}
+	return 0
+}
+
+func (m *ModelProto) GetOpsetImport() []*OperatorSetIdProto {
+	if m != nil {
+		return m.OpsetImport
+	}
+	return nil
+}
+
+func (m *ModelProto) GetProducerName() string {
+	if m != nil && m.ProducerName != nil {
+		return *m.ProducerName
+	}
+	return ""
+}
+
+func (m *ModelProto) GetProducerVersion() string {
+	if m != nil && m.ProducerVersion != nil {
+		return *m.ProducerVersion
+	}
+	return ""
+}
+
+func (m *ModelProto) GetDomain() string {
+	if m != nil && m.Domain != nil {
+		return *m.Domain
+	}
+	return ""
+}
+
+func (m *ModelProto) GetModelVersion() int64 {
+	if m != nil && m.ModelVersion != nil {
+		return *m.ModelVersion
+	}
+	return 0
+}
+
+func (m *ModelProto) GetDocString() string {
+	if m != nil && m.DocString != nil {
+		return *m.DocString
+	}
+	return ""
+}
+
+func (m *ModelProto) GetGraph() *GraphProto {
+	if m != nil {
+		return m.Graph
+	}
+	return nil
+}
+
+type GraphProto struct {
+	Node             []*NodeProto      `protobuf:"bytes,1,rep,name=node" json:"node,omitempty"`
+	Name             *string           `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Initializer      []*TensorProto    `protobuf:"bytes,5,rep,name=initializer" json:"initializer,omitempty"`
+	DocString        *string           `protobuf:"bytes,10,opt,name=doc_string" json:"doc_string,omitempty"`
+	Input            []*ValueInfoProto `protobuf:"bytes,11,rep,name=input" json:"input,omitempty"`
+	Output           []*ValueInfoProto `protobuf:"bytes,12,rep,name=output" json:"output,omitempty"`
+	ValueInfo        []*ValueInfoProto `protobuf:"bytes,13,rep,name=value_info" json:"value_info,omitempty"`
+	XXX_unrecognized []byte            `json:"-"`
+}
+
+func (m *GraphProto) Reset()         { *m = GraphProto{} }
+func (m *GraphProto) String() string { return proto.CompactTextString(m) }
+func (*GraphProto) ProtoMessage()    {}
+
+func (m *GraphProto) GetNode() []*NodeProto {
+	if m != nil {
+		return m.Node
+	}
+	return nil
+}
+
+func (m *GraphProto) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *GraphProto) GetInitializer() []*TensorProto {
+	if m != nil {
+		return m.Initializer
+	}
+	return nil
+}
+
+func (m *GraphProto) GetDocString() string {
+	if m != nil && m.DocString != nil {
+		return *m.DocString
+	}
+	return ""
+}
+
+func (m *GraphProto) GetInput() []*ValueInfoProto {
+	if m != nil {
+		return m.Input
+	}
+	return nil
+}
+
+func (m *GraphProto) GetOutput() []*ValueInfoProto {
+	if m != nil {
+		return m.Output
+	}
+	return nil
+}
+
+func (m *GraphProto) GetValueInfo() []*ValueInfoProto {
+	if m != nil {
+		return m.ValueInfo
+	}
+	return nil
+}
+
+type TensorProto struct {
+	Dims             []int64   `protobuf:"varint,1,rep,name=dims" json:"dims,omitempty"`
+	DataType         *int32    `protobuf:"varint,2,opt,name=data_type" json:"data_type,omitempty"`
+	FloatData        []float32 `protobuf:"fixed32,4,rep,packed,name=float_data" json:"float_data,omitempty"`
+	Int64Data        []int64   `protobuf:"varint,7,rep,packed,name=int64_data" json:"int64_data,omitempty"`
+	Name             *string   `protobuf:"bytes,8,opt,name=name" json:"name,omitempty"`
+	DocString        *string   `protobuf:"bytes,12,opt,name=doc_string" json:"doc_string,omitempty"`
+	RawData          []byte    `protobuf:"bytes,9,opt,name=raw_data" json:"raw_data,omitempty"`
+	XXX_unrecognized []byte    `json:"-"`
+}
+
+func (m *TensorProto) Reset()         { *m = TensorProto{} }
+func (m *TensorProto) String() string { return proto.CompactTextString(m) }
+func (*TensorProto) ProtoMessage()    {}
+
+func (m *TensorProto) GetDims() []int64 {
+	if m != nil {
+		return m.Dims
+	}
+	return nil
+}
+
+func (m *TensorProto) GetDataType() int32 {
+	if m != nil && m.DataType != nil {
+		return *m.DataType
+	}
+	return 0
+}
+
+func (m *TensorProto) GetFloatData() []float32 {
+	if m != nil {
+		return m.FloatData
+	}
+	return nil
+}
+
+func (m *TensorProto) GetInt64Data() []int64 {
+	if m != nil {
+		return m.Int64Data
+	}
+	return nil
+}
+
+func (m *TensorProto) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *TensorProto) GetDocString() string {
+	if m != nil && m.DocString != nil {
+		return *m.DocString
+	}
+	return ""
+}
+
+func (m *TensorProto) GetRawData() []byte {
+	if m != nil {
+		return m.RawData
+	}
+	return nil
+}
+
+type TensorShapeProto struct {
+	Dim              []*TensorShapeProto_Dimension `protobuf:"bytes,1,rep,name=dim" json:"dim,omitempty"`
+	XXX_unrecognized []byte                        `json:"-"`
+}
+
+func (m *TensorShapeProto) Reset()         { *m = TensorShapeProto{} }
+func (m *TensorShapeProto) String() string { return proto.CompactTextString(m) }
+func (*TensorShapeProto) ProtoMessage()    {}
+
+func (m *TensorShapeProto) GetDim() []*TensorShapeProto_Dimension {
+	if m != nil {
+		return m.Dim
+	}
+	return nil
+}
+
+type TensorShapeProto_Dimension struct {
+	DimValue         *int64  `protobuf:"varint,1,opt,name=dim_value" json:"dim_value,omitempty"`
+	DimParam         *string `protobuf:"bytes,2,opt,name=dim_param" json:"dim_param,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *TensorShapeProto_Dimension) Reset()         { *m = TensorShapeProto_Dimension{} }
+func (m *TensorShapeProto_Dimension) String() string { return proto.CompactTextString(m) }
+func (*TensorShapeProto_Dimension) ProtoMessage()    {}
+
+func (m *TensorShapeProto_Dimension) GetDimValue() int64 {
+	if m != nil && m.DimValue != nil {
+		return *m.DimValue
+	}
+	return 0
+}
+
+func (m *TensorShapeProto_Dimension) GetDimParam() string {
+	if m != nil && m.DimParam != nil {
+		return *m.DimParam
+	}
+	return ""
+}
+
+type TypeProto struct {
+	TensorType       *TypeProto_Tensor `protobuf:"bytes,1,opt,name=tensor_type" json:"tensor_type,omitempty"`
+	XXX_unrecognized []byte            `json:"-"`
+}
+
+func (m *TypeProto) Reset()         { *m = TypeProto{} }
+func (m *TypeProto) String() string { return proto.CompactTextString(m) }
+func (*TypeProto) ProtoMessage()    {}
+
+func (m *TypeProto) GetTensorType() *TypeProto_Tensor {
+	if m != nil {
+		return m.TensorType
+	}
+	return nil
+}
+
+type TypeProto_Tensor struct {
+	ElemType         *int32            `protobuf:"varint,1,opt,name=elem_type" json:"elem_type,omitempty"`
+	Shape            *TensorShapeProto `protobuf:"bytes,2,opt,name=shape" json:"shape,omitempty"`
+	XXX_unrecognized []byte            `json:"-"`
+}
+
+func (m *TypeProto_Tensor) Reset()         { *m = TypeProto_Tensor{} }
+func (m *TypeProto_Tensor) String() string { return proto.CompactTextString(m) }
+func (*TypeProto_Tensor) ProtoMessage()    {}
+
+func (m *TypeProto_Tensor) GetElemType() int32 {
+	if m != nil && m.ElemType != nil {
+		return *m.ElemType
+	}
+	return 0
+}
+
+func (m *TypeProto_Tensor) GetShape() *TensorShapeProto {
+	if m != nil {
+		return m.Shape
+	}
+	return nil
+}
+
+type OperatorSetIdProto struct {
+	Domain           *string `protobuf:"bytes,1,opt,name=domain" json:"domain,omitempty"`
+	Version          *int64  `protobuf:"varint,2,opt,name=version" json:"version,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *OperatorSetIdProto) Reset()         { *m = OperatorSetIdProto{} }
+func (m *OperatorSetIdProto) String() string { return proto.CompactTextString(m) }
+func (*OperatorSetIdProto) ProtoMessage()    {}
+
+func (m *OperatorSetIdProto) GetDomain() string {
+	if m != nil && m.Domain != nil {
+		return *m.Domain
+	}
+	return ""
+}
+
+func (m *OperatorSetIdProto) GetVersion() int64 {
+	if m != nil && m.Version != nil {
+		return *m.Version
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterEnum("onnx.AttributeProto_AttributeType", AttributeProto_AttributeType_name, AttributeProto_AttributeType_value)
+	proto.RegisterEnum("onnx.TensorProto_DataType", TensorProto_DataType_name, TensorProto_DataType_value)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+	"github.com/jvlmdr/go-caffe/server"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] model ...\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Serves models from the registry, which are loaded once at startup.")
+		fmt.Fprintln(os.Stderr, "Endpoints:")
+		fmt.Fprintln(os.Stderr, "  GET  /health")
+		fmt.Fprintln(os.Stderr, "  GET  /metrics")
+		fmt.Fprintln(os.Stderr, "  POST /models/{model}/features?layer={layer}&format=binary|json")
+		fmt.Fprintln(os.Stderr, "  POST /models/{model}/predict?k={k}")
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	var (
+		addr          string
+		backend       string
+		script        string
+		probLayer     string
+		resize        int
+		oversample    bool
+		maxBatch      int
+		batchDelay    time.Duration
+		maxConcurrent int
+		maxPending    int
+	)
+	flag.StringVar(&addr, "addr", ":8080", "Address to listen on")
+	flag.StringVar(&caffe.ModelsDir, "models-dir", "models", "Directory which contains the model registry")
+	flag.StringVar(&backend, "backend", "native", "Compute with native or caffe")
+	flag.StringVar(&script, "script", "extract.py", "Python script for the caffe backend")
+	flag.StringVar(&probLayer, "prob-layer", "prob", "Layer which gives class probabilities, if present")
+	flag.IntVar(&resize, "resize", 256, "Resize images to this size before cropping for predictions")
+	flag.BoolVar(&oversample, "oversample", false, "Combine corner and center crops and their mirror images for predictions")
+	flag.IntVar(&maxBatch, "max-batch", server.DefaultOptions.MaxBatch, "Maximum number of images in a batch")
+	flag.DurationVar(&batchDelay, "batch-delay", server.DefaultOptions.BatchDelay, "Time to wait for more images before computing a batch")
+	flag.IntVar(&maxConcurrent, "max-concurrent", runtime.NumCPU(), "Maximum number of batches computed at once")
+	flag.IntVar(&maxPending, "max-pending", 64, "Maximum number of requests in progress (0 for no limit)")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if backend != "native" && backend != "caffe" {
+		log.Fatalln("unknown backend:", backend)
+	}
+	if oversample && resize <= 0 {
+		log.Fatalln("-oversample requires -resize")
+	}
+
+	models := make(map[string]*server.Model)
+	for _, name := range flag.Args() {
+		m, err := loadModel(name, backend, script, probLayer)
+		if err != nil {
+			log.Fatalf("load model %s: %v", name, err)
+		}
+		if m.ProbLayer != "" {
+			m.Transform.Resize = image.Pt(resize, resize)
+			m.Transform.Oversample = oversample
+			m.Transform.Mirror = oversample
+		}
+		models[name] = m
+		log.Printf("loaded model %s: %d layers, %d labels", name, len(m.Layers), len(m.Labels))
+	}
+
+	s := server.New(models, server.Options{
+		MaxBatch:      maxBatch,
+		BatchDelay:    batchDelay,
+		MaxConcurrent: maxConcurrent,
+		MaxPending:    maxPending,
+	})
+	defer s.Close()
+	log.Println("listening on", addr)
+	log.Fatalln(http.ListenAndServe(addr, s))
+}
+
+func loadModel(name, backend, script, probLayer string) (*server.Model, error) {
+	m, err := caffe.LoadModel(name)
+	if err != nil {
+		return nil, err
+	}
+	net, err := m.LoadDeploy()
+	if err != nil {
+		return nil, err
+	}
+	var model *server.Model
+	switch backend {
+	case "native":
+		if m.Mean == nil {
+			return nil, fmt.Errorf("native backend needs mean in manifest")
+		}
+		weights, err := caffe.LoadWeights(m.WeightsFile())
+		if err != nil {
+			return nil, err
+		}
+		report, err := caffe.CopyWeights(net, weights, caffe.CopyOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if !report.OK() {
+			log.Print(report)
+		}
+		model = server.NativeModel(net, m.Mean)
+	case "caffe":
+		if m.MeanFilePath() == "" {
+			return nil, fmt.Errorf("caffe backend needs mean_file in manifest")
+		}
+		model = server.CaffeModel(script, net, m.WeightsFile(), m.MeanFilePath())
+	}
+
+	if !caffe.HasLayer(net, probLayer) {
+		return model, nil
+	}
+	model.ProbLayer = probLayer
+	model.Transform.Crop = m.InputSize()
+	if model.Transform.Crop == (image.Point{}) {
+		in, err := caffe.InputShape(net)
+		if err != nil {
+			return nil, err
+		}
+		model.Transform.Crop = image.Pt(in.Width, in.Height)
+	}
+	if m.Labels != "" {
+		model.Labels, err = m.LoadLabels()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return model, nil
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+var errClosed = errors.New("server is closed")
+
+// batcher collects the images of concurrent requests for one layer of a model
+// so that they are computed by a single call to Map.
+type batcher struct {
+	s     *Server
+	model *Model
+	layer string
+	items chan *batchItem
+}
+
+type batchItem struct {
+	ims  []image.Image
+	done chan batchResult
+}
+
+type batchResult struct {
+	feats []*rimg64.Multi
+	err   error
+}
+
+func newBatcher(s *Server, model *Model, layer string) *batcher {
+	b := &batcher{s: s, model: model, layer: layer, items: make(chan *batchItem)}
+	go b.loop()
+	return b
+}
+
+// Map computes the outputs for some images as part of the next batch.
+func (b *batcher) Map(ims []image.Image) ([]*rimg64.Multi, error) {
+	item := &batchItem{ims: ims, done: make(chan batchResult, 1)}
+	select {
+	case b.items <- item:
+	case <-b.s.quit:
+		return nil, errClosed
+	}
+	r := <-item.done
+	return r.feats, r.err
+}
+
+// loop starts a batch with the first image to arrive
+// and closes it once it has MaxBatch images or BatchDelay has passed.
+// At most MaxConcurrent batches are computed at once across the server.
+func (b *batcher) loop() {
+	opts := b.s.opts
+	for {
+		var batch []*batchItem
+		select {
+		case item := <-b.items:
+			batch = append(batch, item)
+		case <-b.s.quit:
+			return
+		}
+		n := len(batch[0].ims)
+		timer := time.NewTimer(opts.BatchDelay)
+	collect:
+		for n < opts.MaxBatch {
+			select {
+			case item := <-b.items:
+				batch = append(batch, item)
+				n += len(item.ims)
+			case <-timer.C:
+				break collect
+			case <-b.s.quit:
+				timer.Stop()
+				finish(batch, nil, errClosed)
+				return
+			}
+		}
+		timer.Stop()
+		select {
+		case b.s.sem <- struct{}{}:
+		case <-b.s.quit:
+			finish(batch, nil, errClosed)
+			return
+		}
+		go func(batch []*batchItem, n int) {
+			defer func() { <-b.s.sem }()
+			b.run(batch, n)
+		}(batch, n)
+	}
+}
+
+func (b *batcher) run(batch []*batchItem, n int) {
+	ims := make([]image.Image, 0, n)
+	for _, item := range batch {
+		ims = append(ims, item.ims...)
+	}
+	start := time.Now()
+	feats, err := b.model.Map(b.layer, ims)
+	if err == nil && len(feats) != len(ims) {
+		err = fmt.Errorf("number of outputs is %d, number of images is %d", len(feats), len(ims))
+	}
+	b.s.metrics.batch(len(ims), time.Since(start))
+	finish(batch, feats, err)
+}
+
+// finish gives each item its part of the outputs.
+func finish(batch []*batchItem, feats []*rimg64.Multi, err error) {
+	var i int
+	for _, item := range batch {
+		if err != nil {
+			item.done <- batchResult{err: err}
+			continue
+		}
+		item.done <- batchResult{feats: feats[i : i+len(item.ims)]}
+		i += len(item.ims)
+	}
+}
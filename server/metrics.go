@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// metrics are exported in the Prometheus text format.
+type metrics struct {
+	mu sync.Mutex
+	// Number of responses by endpoint and status code.
+	requests map[requestKey]int64
+	// Total time spent handling requests by endpoint.
+	seconds  map[string]float64
+	inFlight int64
+	rejected int64
+	// Batches and the images and time which they took.
+	batches      int64
+	batchImages  int64
+	batchSeconds float64
+}
+
+type requestKey struct {
+	Endpoint string
+	Code     int
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: make(map[requestKey]int64),
+		seconds:  make(map[string]float64),
+	}
+}
+
+func (m *metrics) begin() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight++
+}
+
+func (m *metrics) end(endpoint string, code int, dur time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight--
+	m.requests[requestKey{endpoint, code}]++
+	m.seconds[endpoint] += dur.Seconds()
+}
+
+func (m *metrics) reject() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejected++
+}
+
+func (m *metrics) batch(n int, dur time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches++
+	m.batchImages += int64(n)
+	m.batchSeconds += dur.Seconds()
+}
+
+func (m *metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cw := &countWriter{w: w}
+	keys := make([]requestKey, 0, len(m.requests))
+	counts := make(map[string]int64)
+	for k, n := range m.requests {
+		keys = append(keys, k)
+		counts[k.Endpoint] += n
+	}
+	sort.Sort(byEndpointCode(keys))
+	fmt.Fprintln(cw, "# TYPE caffe_requests_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(cw, "caffe_requests_total{endpoint=%q,code=\"%d\"} %d\n", k.Endpoint, k.Code, m.requests[k])
+	}
+	endpoints := make([]string, 0, len(m.seconds))
+	for e := range m.seconds {
+		endpoints = append(endpoints, e)
+	}
+	sort.Strings(endpoints)
+	fmt.Fprintln(cw, "# TYPE caffe_request_seconds summary")
+	for _, e := range endpoints {
+		fmt.Fprintf(cw, "caffe_request_seconds_sum{endpoint=%q} %g\n", e, m.seconds[e])
+		fmt.Fprintf(cw, "caffe_request_seconds_count{endpoint=%q} %d\n", e, counts[e])
+	}
+	fmt.Fprintln(cw, "# TYPE caffe_requests_in_flight gauge")
+	fmt.Fprintf(cw, "caffe_requests_in_flight %d\n", m.inFlight)
+	fmt.Fprintln(cw, "# TYPE caffe_requests_rejected_total counter")
+	fmt.Fprintf(cw, "caffe_requests_rejected_total %d\n", m.rejected)
+	fmt.Fprintln(cw, "# TYPE caffe_batches_total counter")
+	fmt.Fprintf(cw, "caffe_batches_total %d\n", m.batches)
+	fmt.Fprintln(cw, "# TYPE caffe_batch_images_total counter")
+	fmt.Fprintf(cw, "caffe_batch_images_total %d\n", m.batchImages)
+	fmt.Fprintln(cw, "# TYPE caffe_batch_seconds_total counter")
+	fmt.Fprintf(cw, "caffe_batch_seconds_total %g\n", m.batchSeconds)
+	return cw.n, cw.err
+}
+
+// countWriter remembers the first error so that
+// the result of every Fprintf need not be checked.
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
+
+type byEndpointCode []requestKey
+
+func (s byEndpointCode) Len() int { return len(s) }
+func (s byEndpointCode) Less(i, j int) bool {
+	if s[i].Endpoint != s[j].Endpoint {
+		return s[i].Endpoint < s[j].Endpoint
+	}
+	return s[i].Code < s[j].Code
+}
+func (s byEndpointCode) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
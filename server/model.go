@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+	"github.com/jvlmdr/go-cv/featset"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// Model is a network which is served under a name.
+type Model struct {
+	// Map computes the output of a layer for a batch of images.
+	// It may be called concurrently.
+	Map func(layer string, ims []image.Image) ([]*rimg64.Multi, error)
+	// Layers which clients may request.
+	// If empty, every layer is passed to Map.
+	Layers []string
+	// Labels of the classes in order, may be nil.
+	Labels []string
+	// Layer which gives the probability of each class at a single position.
+	// Predictions are not available if empty.
+	ProbLayer string
+	// Preprocessing of images for predictions.
+	// Features are computed at the resolution of the uploaded image.
+	Transform caffe.TestTransform
+}
+
+func (m *Model) hasLayer(name string) bool {
+	if len(m.Layers) == 0 {
+		return true
+	}
+	for _, l := range m.Layers {
+		if l == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NativeModel serves a network which has weights with the native engine.
+// The transform of each layer is constructed once, when it is first requested.
+// The images of a batch are computed concurrently.
+func NativeModel(net *caffe.NetParameter, mean []float64) *Model {
+	var (
+		mu   sync.Mutex
+		phis = make(map[string]featset.Image)
+	)
+	transform := func(layer string) (featset.Image, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if phi, ok := phis[layer]; ok {
+			return phi, nil
+		}
+		phi, err := caffe.FromProto(net, layer, mean)
+		if err != nil {
+			return nil, err
+		}
+		phis[layer] = phi
+		return phi, nil
+	}
+	return &Model{
+		Map: func(layer string, ims []image.Image) ([]*rimg64.Multi, error) {
+			phi, err := transform(layer)
+			if err != nil {
+				return nil, err
+			}
+			// Compute the images of a batch in parallel,
+			// otherwise batching would only add latency.
+			var (
+				feats = make([]*rimg64.Multi, len(ims))
+				errs  = make([]error, len(ims))
+				wg    sync.WaitGroup
+			)
+			for i, im := range ims {
+				wg.Add(1)
+				go func(i int, im image.Image) {
+					defer wg.Done()
+					feats[i], errs[i] = phi.Apply(im)
+				}(i, im)
+			}
+			wg.Wait()
+			for _, err := range errs {
+				if err != nil {
+					return nil, err
+				}
+			}
+			return feats, nil
+		},
+		Layers: layerNames(net),
+	}
+}
+
+// CaffeModel serves a network with Caffe through the Python script.
+// A new process is started for every batch.
+func CaffeModel(script string, net *caffe.NetParameter, weightsFile, meanFile string) *Model {
+	var (
+		mu      sync.Mutex
+		subsets = make(map[string]*caffe.NetParameter)
+	)
+	subset := func(layer string) *caffe.NetParameter {
+		mu.Lock()
+		defer mu.Unlock()
+		if s, ok := subsets[layer]; ok {
+			return s
+		}
+		s := caffe.SubsetForOutput(net, layer)
+		subsets[layer] = s
+		return s
+	}
+	return &Model{
+		Map: func(layer string, ims []image.Image) ([]*rimg64.Multi, error) {
+			feats, err := caffe.Extract(script, ims, layer, subset(layer), weightsFile, meanFile)
+			if err != nil {
+				return nil, fmt.Errorf("extract %s: %v", layer, err)
+			}
+			return feats, nil
+		},
+		Layers: layerNames(net),
+	}
+}
+
+func layerNames(net *caffe.NetParameter) []string {
+	var names []string
+	for _, layer := range net.Layers {
+		names = append(names, layer.GetName())
+	}
+	return names
+}
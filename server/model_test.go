@@ -0,0 +1,51 @@
+package server
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+const nativeTestNet = `
+name: "NativeNet"
+input: "data"
+input_dim: 1 input_dim: 3 input_dim: 4 input_dim: 4
+layers { name: "conv" type: CONVOLUTION bottom: "data" top: "conv"
+  convolution_param { num_output: 1 kernel_size: 1 }
+  blobs { num: 1 channels: 3 height: 1 width: 1 data: 1 data: 0 data: 0 }
+  blobs { num: 1 channels: 1 height: 1 width: 1 data: 0 } }
+`
+
+// The images of a batch are computed concurrently and in order.
+func TestNativeModel(t *testing.T) {
+	net := new(caffe.NetParameter)
+	if err := proto.UnmarshalText(nativeTestNet, net); err != nil {
+		t.Fatal(err)
+	}
+	m := NativeModel(net, []float64{0, 0, 0})
+	const n = 8
+	ims := make([]image.Image, n)
+	for i := range ims {
+		im := image.NewRGBA(image.Rect(0, 0, 4, 4))
+		for x := 0; x < 4; x++ {
+			for y := 0; y < 4; y++ {
+				// The first channel of the network is blue.
+				im.Set(x, y, color.RGBA{0, 0, uint8(10 * i), 255})
+			}
+		}
+		ims[i] = im
+	}
+	feats, err := m.Map("conv", ims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range feats {
+		if got, want := f.At(1, 2, 0), float64(10*i); math.Abs(got-want) > 1e-9 {
+			t.Errorf("image %d: got %g, want %g", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+// Package server serves features and predictions of Caffe models over HTTP.
+//
+// Endpoints:
+//
+//	GET  /health
+//	GET  /metrics
+//	POST /models/{model}/features?layer={layer}&layer=...&format=binary|json
+//	POST /models/{model}/predict?k={k}
+//
+// The body of a POST request is an encoded image.
+// The binary format is the Multi message of each layer in order,
+// as written by caffe.WriteMulti.
+// Errors are returned as an ErrorResponse.
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+	"github.com/jvlmdr/go-cv/rimg64"
+)
+
+// BinaryType is the content type of features in the binary format.
+const BinaryType = "application/x-protobuf"
+
+// Options limits the work of a server.
+type Options struct {
+	// Maximum number of images in a batch.
+	MaxBatch int
+	// How long to wait for more images before computing an incomplete batch.
+	BatchDelay time.Duration
+	// Maximum number of batches which are computed at once.
+	MaxConcurrent int
+	// Maximum number of requests for features or predictions
+	// which are handled at once.
+	// Further requests are rejected with 503 Service Unavailable.
+	// Zero means no limit.
+	MaxPending int
+	// Maximum size of an uploaded image in bytes.
+	// Larger images are rejected with 413 Request Entity Too Large.
+	MaxImageBytes int64
+	// Maximum width times height of an uploaded image,
+	// which is checked before the image is decoded.
+	MaxImagePixels int64
+}
+
+// DefaultOptions replace MaxBatch, MaxConcurrent,
+// MaxImageBytes and MaxImagePixels if they are zero.
+var DefaultOptions = Options{
+	MaxBatch:       16,
+	BatchDelay:     5 * time.Millisecond,
+	MaxConcurrent:  runtime.NumCPU(),
+	MaxImageBytes:  32 << 20,
+	MaxImagePixels: 64 << 20,
+}
+
+// Server is an http.Handler which serves a set of models.
+type Server struct {
+	models  map[string]*Model
+	opts    Options
+	sem     chan struct{}
+	pending chan struct{}
+	quit    chan struct{}
+	metrics *metrics
+
+	mu       sync.Mutex
+	closed   bool
+	batchers map[batchKey]*batcher
+}
+
+type batchKey struct {
+	Model, Layer string
+}
+
+// New creates a server for models by name.
+// Call Close to stop the batching goroutines.
+func New(models map[string]*Model, opts Options) *Server {
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = DefaultOptions.MaxBatch
+	}
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = DefaultOptions.MaxConcurrent
+	}
+	if opts.MaxImageBytes <= 0 {
+		opts.MaxImageBytes = DefaultOptions.MaxImageBytes
+	}
+	if opts.MaxImagePixels <= 0 {
+		opts.MaxImagePixels = DefaultOptions.MaxImagePixels
+	}
+	s := &Server{
+		models:   models,
+		opts:     opts,
+		sem:      make(chan struct{}, opts.MaxConcurrent),
+		quit:     make(chan struct{}),
+		metrics:  newMetrics(),
+		batchers: make(map[batchKey]*batcher),
+	}
+	if opts.MaxPending > 0 {
+		s.pending = make(chan struct{}, opts.MaxPending)
+	}
+	return s
+}
+
+// Close stops batching.
+// Requests which are waiting for a batch fail.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.quit)
+	}
+}
+
+// HealthResponse is the result of GET /health.
+type HealthResponse struct {
+	Status string
+	Models []string
+}
+
+// FeaturesResponse is the result of a request for features in JSON.
+type FeaturesResponse struct {
+	Features map[string]*rimg64.Multi
+}
+
+// PredictResponse is the result of a request for predictions.
+type PredictResponse struct {
+	Predictions []caffe.Prediction
+}
+
+// ErrorResponse describes why a request failed.
+type ErrorResponse struct {
+	Error string
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/health":
+		s.serveHealth(w, r)
+	case r.URL.Path == "/metrics":
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed: %s", r.Method)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		s.metrics.WriteTo(w)
+	case strings.HasPrefix(r.URL.Path, "/models/"):
+		s.serveModel(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "not found: %s", r.URL.Path)
+	}
+}
+
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(s.models))
+	for name := range s.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	resp := HealthResponse{Status: "ok", Models: names}
+	code := http.StatusOK
+	if closed {
+		resp.Status, code = "closed", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, resp)
+}
+
+// serveModel handles /models/{model}/{action}.
+func (s *Server) serveModel(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/models/"), "/")
+	if len(parts) != 2 || (parts[1] != "features" && parts[1] != "predict") {
+		writeError(w, http.StatusNotFound, "not found: %s", r.URL.Path)
+		return
+	}
+	name, action := parts[0], parts[1]
+
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+	s.metrics.begin()
+	defer func() { s.metrics.end(action, sw.code, time.Since(start)) }()
+
+	if s.pending != nil {
+		select {
+		case s.pending <- struct{}{}:
+			defer func() { <-s.pending }()
+		default:
+			s.metrics.reject()
+			writeError(sw, http.StatusServiceUnavailable, "too many requests in progress")
+			return
+		}
+	}
+	if r.Method != "POST" {
+		writeError(sw, http.StatusMethodNotAllowed, "method not allowed: %s", r.Method)
+		return
+	}
+	model, ok := s.models[name]
+	if !ok {
+		writeError(sw, http.StatusNotFound, "unknown model: %s", name)
+		return
+	}
+	im, code, err := s.readImage(r)
+	if err != nil {
+		writeError(sw, code, "%v", err)
+		return
+	}
+	switch action {
+	case "features":
+		s.serveFeatures(sw, r, name, model, im)
+	case "predict":
+		s.servePredict(sw, r, name, model, im)
+	}
+}
+
+func (s *Server) serveFeatures(w http.ResponseWriter, r *http.Request, name string, model *Model, im image.Image) {
+	query := r.URL.Query()
+	layers := query["layer"]
+	if len(layers) == 0 {
+		writeError(w, http.StatusBadRequest, "no layer requested")
+		return
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = "binary"
+	}
+	if format != "binary" && format != "json" {
+		writeError(w, http.StatusBadRequest, "unknown format: %s", format)
+		return
+	}
+	for _, layer := range layers {
+		if !model.hasLayer(layer) {
+			writeError(w, http.StatusNotFound, "model %s: unknown layer: %s", name, layer)
+			return
+		}
+	}
+
+	// Compute all layers concurrently in their own batches.
+	var (
+		feats = make([]*rimg64.Multi, len(layers))
+		errs  = make([]error, len(layers))
+		wg    sync.WaitGroup
+	)
+	for i, layer := range layers {
+		wg.Add(1)
+		go func(i int, layer string) {
+			defer wg.Done()
+			out, err := s.batcher(name, model, layer).Map([]image.Image{im})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			feats[i] = out[0]
+		}(i, layer)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			writeError(w, computeStatus(err), "layer %s: %v", layers[i], err)
+			return
+		}
+	}
+
+	if format == "json" {
+		resp := FeaturesResponse{Features: make(map[string]*rimg64.Multi)}
+		for i, layer := range layers {
+			resp.Features[layer] = feats[i]
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	var buf bytes.Buffer
+	for _, f := range feats {
+		if err := caffe.WriteMulti(&buf, f); err != nil {
+			writeError(w, http.StatusInternalServerError, "encode: %v", err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", BinaryType)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+func (s *Server) servePredict(w http.ResponseWriter, r *http.Request, name string, model *Model, im image.Image) {
+	if model.ProbLayer == "" {
+		writeError(w, http.StatusNotFound, "model %s does not give predictions", name)
+		return
+	}
+	k := 5
+	if str := r.URL.Query().Get("k"); str != "" {
+		var err error
+		k, err = strconv.Atoi(str)
+		if err != nil || k < 1 {
+			writeError(w, http.StatusBadRequest, "invalid k: %s", str)
+			return
+		}
+	}
+	mapAll := s.batcher(name, model, model.ProbLayer).Map
+	probs, err := caffe.Classify(mapAll, im, model.Transform)
+	if err != nil {
+		writeError(w, computeStatus(err), "classify: %v", err)
+		return
+	}
+	if model.Labels != nil && len(model.Labels) != len(probs) {
+		writeError(w, http.StatusInternalServerError,
+			"number of labels is %d, number of classes is %d", len(model.Labels), len(probs))
+		return
+	}
+	writeJSON(w, http.StatusOK, PredictResponse{caffe.TopK(probs, model.Labels, k)})
+}
+
+// batcher returns the batcher of a layer, creating it if necessary.
+func (s *Server) batcher(name string, model *Model, layer string) *batcher {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := batchKey{name, layer}
+	b, ok := s.batchers[key]
+	if !ok {
+		b = newBatcher(s, model, layer)
+		s.batchers[key] = b
+	}
+	return b
+}
+
+// readImage decodes the image in the body of a request.
+// If it fails, it also returns the status code of the response.
+func (s *Server) readImage(r *http.Request) (image.Image, int, error) {
+	defer r.Body.Close()
+	// Read one byte more than the limit to detect a larger body.
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, s.opts.MaxImageBytes+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("read image: %v", err)
+	}
+	if int64(len(data)) > s.opts.MaxImageBytes {
+		return nil, http.StatusRequestEntityTooLarge,
+			fmt.Errorf("image larger than %d bytes", s.opts.MaxImageBytes)
+	}
+	// Check the dimensions before allocating the pixels.
+	conf, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("decode image: %v", err)
+	}
+	if n := int64(conf.Width) * int64(conf.Height); n > s.opts.MaxImagePixels {
+		return nil, http.StatusRequestEntityTooLarge,
+			fmt.Errorf("image of %dx%d has more than %d pixels", conf.Width, conf.Height, s.opts.MaxImagePixels)
+	}
+	im, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("decode image: %v", err)
+	}
+	return im, 0, nil
+}
+
+func computeStatus(err error) int {
+	if err == errClosed {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		code = http.StatusInternalServerError
+		data, _ = json.Marshal(ErrorResponse{err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	writeJSON(w, code, ErrorResponse{fmt.Sprintf(format, args...)})
+}
+
+// statusWriter remembers the status code for metrics.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s model.(prototxt|json) [weights]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	var (
+		width, height int
+		asJSON        bool
+	)
+	flag.IntVar(&width, "width", 0, "Input width (default from input_dim)")
+	flag.IntVar(&height, "height", 0, "Input height (default from input_dim)")
+	flag.BoolVar(&asJSON, "json", false, "Print JSON instead of a table")
+	flag.Parse()
+	if flag.NArg() != 1 && flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	modelFile := flag.Arg(0)
+
+	net := new(caffe.NetParameter)
+	if err := caffe.LoadMessage(modelFile, net); err != nil {
+		log.Fatalln(err)
+	}
+	if flag.NArg() == 2 {
+		weights, err := caffe.LoadWeights(flag.Arg(1))
+		if err != nil {
+			log.Fatalln("load weights:", err)
+		}
+		report, err := caffe.CopyWeights(net, weights, caffe.CopyOptions{})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if !report.OK() {
+			log.Print(report)
+		}
+	}
+	in, err := caffe.InputShape(net)
+	if err != nil {
+		in = caffe.Shape{Channels: 3}
+	}
+	if width > 0 && height > 0 {
+		in.Width, in.Height = width, height
+	}
+	if in.Width <= 0 || in.Height <= 0 {
+		log.Fatalln("no input size: set -width and -height or input_dim")
+	}
+
+	s, err := caffe.Summarize(net, in)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if asJSON {
+		data, err := json.MarshalIndent(s, "", "\t")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "layer\ttype\toutput\trate\tfield\tparams\tmacs\tmemory\t")
+	fmt.Fprintf(w, "input\t\t%v\t1\t1x1\t\t\t%s\t\n", s.Input, bytes(s.Memory-totalMemory(s)))
+	for _, l := range s.Layers {
+		rate, field := "-", "-"
+		if l.Rate > 0 {
+			rate = fmt.Sprint(l.Rate)
+			field = fmt.Sprintf("%dx%d", l.Field.X, l.Field.Y)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\t%d\t%d\t%s\t\n",
+			l.Name, l.Type, l.Output, rate, field, l.Params, l.MACs, bytes(l.Memory))
+	}
+	fmt.Fprintf(w, "total\t\t\t\t\t%d\t%d\t%s\t\n", s.Params, s.MACs, bytes(s.Memory))
+	w.Flush()
+}
+
+// totalMemory sums the memory of the layers, excluding the input.
+func totalMemory(s *caffe.Summary) int64 {
+	var n int64
+	for _, l := range s.Layers {
+		n += l.Memory
+	}
+	return n
+}
+
+func bytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fK", float64(n)/(1<<10))
+	default:
+		return fmt.Sprint(n)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s model.prototxt weights.caffemodel layer out.onnx\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Exports the layers up to and including layer.")
+		fmt.Fprintf(os.Stderr, "The model takes an RGB image %q in [0, 1] of size 1 x 3 x height x width.\n", caffe.ONNXInput)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	var meanStr string
+	flag.StringVar(&meanStr, "mean", "0,0,0", "Mean pixel in RGB order")
+	flag.Parse()
+	if flag.NArg() != 4 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	var (
+		modelFile   = flag.Arg(0)
+		weightsFile = flag.Arg(1)
+		layer       = flag.Arg(2)
+		outFile     = flag.Arg(3)
+	)
+	mean, err := caffe.ParseMean(meanStr)
+	if err != nil {
+		log.Fatalln("parse mean:", err)
+	}
+
+	net := new(caffe.NetParameter)
+	if err := caffe.LoadMessage(modelFile, net); err != nil {
+		log.Fatalln(err)
+	}
+	weights, err := caffe.LoadWeights(weightsFile)
+	if err != nil {
+		log.Fatalln("load weights:", err)
+	}
+	if _, err := caffe.CopyWeights(net, weights, caffe.CopyOptions{Strict: true}); err != nil {
+		log.Fatalln(err)
+	}
+	model, err := caffe.ExportONNX(net, layer, mean)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	data, err := proto.Marshal(model)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := ioutil.WriteFile(outFile, data, 0644); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jvlmdr/go-caffe/caffe"
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s model.(prototxt|json)\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Exits with status 1 if the network has errors (or warnings with -strict).")
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	var (
+		width, height int
+		strict        bool
+	)
+	flag.IntVar(&width, "width", 0, "Input width (overrides input_dim)")
+	flag.IntVar(&height, "height", 0, "Input height (overrides input_dim)")
+	flag.BoolVar(&strict, "strict", false, "Treat warnings as errors")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	modelFile := flag.Arg(0)
+
+	net := new(caffe.NetParameter)
+	if err := caffe.LoadMessage(modelFile, net); err != nil {
+		log.Fatalln(err)
+	}
+	if width > 0 && height > 0 {
+		if len(net.InputDim) < 4 {
+			net.InputDim = []int32{1, 3, 0, 0}
+		}
+		net.InputDim[2], net.InputDim[3] = int32(height), int32(width)
+	}
+
+	problems := caffe.Validate(net)
+	var numErr, numWarn int
+	for _, p := range problems {
+		if p.Warning {
+			numWarn++
+			fmt.Println("warning:", p.Error())
+		} else {
+			numErr++
+			fmt.Println("error:", p.Error())
+		}
+	}
+	fmt.Printf("%s: %d errors, %d warnings\n", modelFile, numErr, numWarn)
+	if numErr > 0 || (strict && numWarn > 0) {
+		os.Exit(1)
+	}
+}